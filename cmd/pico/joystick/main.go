@@ -10,25 +10,77 @@ package main
  */
 
 import (
-	"errors"
+	"image/color"
 	"joystick/internal/hardware"
+	"joystick/internal/hardware/joystick"
+	"joystick/internal/pkg/axis"
+	"joystick/pkg/bind"
+	"joystick/pkg/failsafe"
+	"joystick/pkg/link"
 	"joystick/pkg/nrf24l01"
+	"joystick/pkg/protocol"
 	"machine"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
+
+	"tinygo.org/x/drivers/ssd1306"
+	"tinygo.org/x/tinyfont"
+	"tinygo.org/x/tinyfont/proggy"
 )
 
 const (
-	BUFF_LENGTH     = 12
-	TX_IDENTIFIER   = 0b00000001 // Idetifier for TX
-	PRINT_RF_STATUS = false      // print rf status
-	PRINT_MSG       = true       // print message
+	BUFF_LENGTH     = protocol.AuthSize
+	RF_ADDRESS      = "JSTK0" // TX_ADDR and RX_ADDR_P0 before bind, the binding has its own address
+	PRINT_RF_STATUS = false   // print rf status
+	PRINT_MSG       = true    // print message
+	PRINT_TELEMETRY = true    // print telemetry of the vehicle
+	DISPLAY         = true    // SSD1306 on I2C1, shows the selected vehicle and its telemetry
+
+	SEND_TIMEOUT = time.Millisecond * 100 // wait for TX_DS or MAX_RT
+	SEND_PERIOD  = time.Millisecond * 150 // pause between packets, a packet every 150 to 250ms
+
+	CALIBRATION_CENTER = time.Second * 2 // hold the sticks centered
+	CALIBRATION_SWEEP  = time.Second * 5 // sweep the sticks to all sides
+
+	DEADZONE = 1500 // radial, of 32767, hides the noise of the center
+	EXPO     = 30   // %, softer around the center
+	RATE     = 100  // %, lower for beginners
 )
 
-// Dispositivo de destino
+// Dispositivo de destino, ID del vehiculo seleccionado
 var destControlled uint8 = 0x00000000
 
 var nrf *nrf24l01.Device
+var rf *link.Controller
+var dev ssd1306.Device
+
+// Vehiculos vinculados, ambos sticks presionados pasan al siguiente
+var bindings bind.Table
+var selected int
+var combo bool
+
+var joyLeft *joystick.Joystick
+var joyRight *joystick.Joystick
+
+// Mensaje a enviar, se reutiliza en cada envio. Sender es el ID del
+// control, elegido al vincular el primer vehiculo
+var rfPacket = protocol.Packet{
+	Type: protocol.TypeControl,
+}
+var rfMessage [protocol.AuthSize]byte
+
+// Telemetria del vehiculo, llega en el ACK de los paquetes
+var telemetry protocol.Telemetry
+var telemetryMessage [nrf24l01.MaxPayloadWidth]byte
+
+// Telemetria en el display, se redibuja solo si cambia
+var telemetryLine string
+
+// Autenticacion o cifrado de paquetes, nil si el vinculo no lo usa
+var rfAuth *protocol.Auth
+var rfCipher *protocol.Cipher
 
 func main() {
 
@@ -40,65 +92,261 @@ func main() {
 
 	println("initializing...")
 
+	if DISPLAY {
+		dev = hardware.NewDisplay(hardware.NewIC2(machine.I2C1, machine.GPIO3, machine.GPIO2))
+	}
+
 	machine.InitADC()
 
+	joyLeft = joystick.NewJoystick(
+		"Left",
+		joystick.NewkHardware(
+			machine.ADC{Pin: machine.ADC1},
+			machine.ADC{Pin: machine.ADC0},
+			machine.GPIO22,
+		))
+	joyLeft.Init()
+
+	joyRight = joystick.NewJoystick(
+		"Right",
+		joystick.NewkHardware(
+			machine.ADC{Pin: machine.ADC3},
+			machine.ADC{Pin: machine.ADC2},
+			machine.GPIO21,
+		))
+	joyRight.Init()
+
+	// Respuesta de los ejes despues de la calibracion
+	joyLeft.Response = response()
+	joyRight.Response = response()
+
 	time.Sleep(time.Second)
 
+	// Stick derecho presionado al iniciar, o sin calibracion en flash: calibrar
+	_, _, released := joyRight.Read()
+	err := hardware.LoadCalibration(joyLeft, joyRight)
+	if err != nil || !released {
+		calibrate()
+	}
+
 	println("init RF24L01")
 
-	nrf = hardware.NewTX(BUFF_LENGTH)
+	nrf, err = hardware.NewTX(BUFF_LENGTH, []byte(RF_ADDRESS))
+	if err != nil {
+		panic("init RF24L01: " + err.Error())
+	}
 
 	time.Sleep(time.Second)
 
-	if nrf != nil {
-		println("initialized RF24L01")
+	println("initialized RF24L01")
+
+	// Stick izquierdo presionado al iniciar: vincular otro vehiculo,
+	// mantenido 3s: desvincular todos
+	mode := hardware.ButtonBindMode(func() bool {
+		_, _, released := joyLeft.Read()
+		return !released
+	})
+	bindings, err = hardware.ControllerBindings(nrf, mode, SEND_TIMEOUT)
+	if err != nil {
+		panic("bind: " + err.Error())
 	}
+	selectVehicle(bindings.Len - 1)
 
 	for {
-		send, err := rfSend(nrf, prepareRFMessage())
-		time.Sleep(time.Millisecond * 150)
+		msg := prepareRFMessage()
+
+		// Ambos sticks presionados: siguiente vehiculo
+		pressed := rfPacket.Pressed(protocol.ButtonLeft) && rfPacket.Pressed(protocol.ButtonRight)
+		if pressed && !combo && bindings.Len > 1 {
+			combo = true
+			selectVehicle((selected + 1) % bindings.Len)
+			continue
+		}
+		combo = pressed
+
+		res, err := rf.Send(msg)
+		if err != nil && err != link.ErrNotLinked {
+			println("TX: error:", err.Error())
+		}
+		if PRINT_RF_STATUS {
+			println("TX: link:", rf.State().String(), "channel:", rf.Channel())
+			println("TX: delivered:", res.Delivered, "retries:", res.Retries, "lost:", res.Lost)
+			println("TX: stats:", rf.Stats().String())
+		}
+		readTelemetry()
+		time.Sleep(SEND_PERIOD)
 	}
 
 }
 
-// rfSend sends data to the given nrf24l01 device.
-func rfSend(nrf *nrf24l01.Device, w []byte) (bool, error) {
+// prepareRFMessage lee los joysticks y arma el paquete a enviar
+func prepareRFMessage() []byte {
+	lx, ly, ls := joyLeft.ReadAxes()
+	rx, ry, rs := joyRight.ReadAxes()
+
+	rfPacket.Target = destControlled
+	rfPacket.Seq++
+	rfPacket.Axes[protocol.AxisLeftX] = lx
+	rfPacket.Axes[protocol.AxisLeftY] = ly
+	rfPacket.Axes[protocol.AxisRightX] = rx
+	rfPacket.Axes[protocol.AxisRightY] = ry
 
-	if nrf == nil {
-		return false, errors.New("no nrf24l01 device")
+	// Pull-up, presionado es false
+	rfPacket.Buttons = 0
+	if !ls {
+		rfPacket.Buttons |= protocol.ButtonLeft
+	}
+	if !rs {
+		rfPacket.Buttons |= protocol.ButtonRight
 	}
 
-	if err := nrf.TransmitDataWithoutAck(w); err != nil {
-		return false, err
+	if rfPacket.Seq == 0 && (rfAuth != nil || rfCipher != nil) {
+		// Seq dio la vuelta, el contador no se puede repetir
+		nextEpoch()
 	}
 
-	if PRINT_RF_STATUS {
-		// Show status
-		config, err := nrf.GetRegisterState(nrf24l01.CONFIG)
-		println("TX: CONFIG:              ", config)
+	var n int
+	switch {
+	case rfCipher != nil:
+		n, _ = rfPacket.MarshalSealed(rfMessage[:], rfCipher)
+	case rfAuth != nil:
+		n, _ = rfPacket.MarshalAuth(rfMessage[:], rfAuth)
+	default:
+		n, _ = rfPacket.Marshal(rfMessage[:])
+	}
+	if PRINT_MSG {
+		println("TX: seq:", rfPacket.Seq,
+			"left:", rfPacket.Axes[protocol.AxisLeftX], rfPacket.Axes[protocol.AxisLeftY],
+			"right:", rfPacket.Axes[protocol.AxisRightX], rfPacket.Axes[protocol.AxisRightY],
+			"buttons:", rfPacket.Buttons)
+	}
+	return rfMessage[:n]
+}
 
-		res, _ := nrf.GetRegisterState(nrf24l01.RF_CH)
-		println("TX: RF_CH:               ", res)
+// selectVehicle usa el vinculo i: direccion, canal y clave del vehiculo
+func selectVehicle(i int) {
+	selected = i
+	binding := bindings.Bindings[i]
+	destControlled = binding.Vehicle
+	rfPacket.Sender = binding.Controller
+	println("TX: controller:", binding.Controller, "vehicle:", binding.Vehicle, "channel:", binding.Channel)
+	showTarget()
 
-		res, _ = nrf.GetRegisterState(nrf24l01.OBSERVE_TX)
-		println("TX: OBSERVE_TX:          ", res)
+	err := hardware.UseBinding(nrf, BUFF_LENGTH, binding)
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
 
-		res, _ = nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-		println("TX: FIFO_STATUS:         ", res)
-		println("TX: FIFO_STATUS.TX_REUSE:", res&0b01000000 > 0)
-		println("TX: FIFO_STATUS.TX_FULL: ", res&0b00100000 > 0)
+	rfAuth, rfCipher = nil, nil
+	if binding.Auth() {
+		rfAuth = protocol.NewAuth(binding.Key[:])
+	}
+	if binding.Sealed() {
+		rfCipher, err = protocol.NewCipher(binding.Key[:])
+		if err != nil {
+			panic("cipher: " + err.Error())
+		}
+	}
+	if rfAuth != nil || rfCipher != nil {
+		nextEpoch()
+	}
 
-		status, _ := nrf.GetRegisterState(nrf24l01.STATUS)
-		println("TX: STATUS:              ", status)
-		println("TX: STATUS.TX_DS:        ", status&0b00100000>>5)
+	rf = link.NewController(nrf, hardware.LinkConfig(SEND_TIMEOUT, binding))
+	err = rf.Start()
+	if err != nil {
+		panic("start link: " + err.Error())
+	}
+}
 
-		res, _ = nrf.GetRegisterState(nrf24l01.FEATURE)
-		println("TX: FEATURE:             ", res)
-		println("------------------------------------------------")
-		println("")
-		if err != nil {
-			return false, err
+// response arma zona muerta, expo y escala de un stick
+func response() axis.Stick {
+	pipeline := axis.Pipeline{axis.Expo(EXPO), axis.Scale(RATE)}
+	return axis.Stick{Radial: DEADZONE, X: pipeline, Y: pipeline}
+}
+
+// calibrate calibra los joysticks y guarda la calibracion en flash,
+// hasta que la calibracion es valida
+func calibrate() {
+	show := func(step string) {
+		println(step)
+		showText("calibration", strings.TrimPrefix(step, "calibration: "))
+	}
+	for {
+		err := joystick.Calibrate([]*joystick.Joystick{joyLeft, joyRight}, CALIBRATION_CENTER, CALIBRATION_SWEEP, show)
+		if err == nil {
+			break
 		}
+		time.Sleep(time.Second)
+	}
+	err := hardware.SaveCalibration(joyLeft, joyRight)
+	if err != nil {
+		println("calibration: save:", err.Error())
+	}
+}
+
+// showTarget muestra el vehiculo seleccionado en el display
+func showTarget() {
+	telemetryLine = ""
+	showText("vehicle "+strconv.Itoa(int(destControlled)),
+		strconv.Itoa(selected+1)+"/"+strconv.Itoa(bindings.Len)+" both sticks: next")
+}
+
+// showTelemetry muestra bateria, failsafe y perdida de paquetes del
+// vehiculo en la segunda linea del display
+func showTelemetry() {
+	mV := int(telemetry.Battery)
+	line := strconv.Itoa(mV/1000) + "." + strconv.Itoa(mV%1000/100) + "V " +
+		failsafe.State(telemetry.Failsafe).String() +
+		" loss " + strconv.Itoa(int(telemetry.Loss)) + "%"
+	if line == telemetryLine {
+		return
+	}
+	telemetryLine = line
+	showText("vehicle "+strconv.Itoa(int(destControlled))+" "+
+		strconv.Itoa(selected+1)+"/"+strconv.Itoa(bindings.Len), line)
+}
+
+// showText muestra dos lineas en el display
+func showText(line1, line2 string) {
+	if !DISPLAY {
+		return
+	}
+	dev.ClearDisplay()
+	tinyfont.WriteLine(&dev, &proggy.TinySZ8pt7b, 0, 0x09, line1, color.RGBA{255, 255, 255, 255})
+	tinyfont.WriteLine(&dev, &proggy.TinySZ8pt7b, 0, 0x13, line2, color.RGBA{255, 255, 255, 255})
+	dev.Display()
+}
+
+// readTelemetry lee la ultima telemetria del vehiculo, si llego
+func readTelemetry() {
+	n, ok := rf.ReadReply(telemetryMessage[:])
+	if !ok {
+		return
+	}
+	err := telemetry.Unmarshal(telemetryMessage[:n])
+	if err != nil {
+		println("TX: telemetry:", err.Error())
+		return
+	}
+	if telemetry.Target != rfPacket.Sender || telemetry.Sender != destControlled {
+		return
+	}
+	if PRINT_TELEMETRY {
+		println("TX: telemetry:", telemetry.String(failsafe.State(telemetry.Failsafe).String()))
+	}
+	showTelemetry()
+}
+
+// nextEpoch toma la siguiente epoca de flash para autenticar o cifrar
+func nextEpoch() {
+	epoch, err := hardware.NextEpoch()
+	if err != nil {
+		panic("epoch: " + err.Error())
+	}
+	if rfAuth != nil {
+		rfAuth.Epoch = epoch
+	}
+	if rfCipher != nil {
+		rfCipher.Epoch = epoch
 	}
-	return true, nil
 }
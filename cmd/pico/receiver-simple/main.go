@@ -10,10 +10,13 @@ package main
  */
 
 import (
-	"bytes"
 	"image/color"
 	"joystick/internal/hardware"
+	"joystick/internal/hardware/button"
+	"joystick/pkg/bind"
+	"joystick/pkg/link"
 	"joystick/pkg/nrf24l01"
+	"joystick/pkg/protocol"
 	"machine"
 	"strconv"
 	"strings"
@@ -24,9 +27,15 @@ import (
 )
 
 const (
-	BUFF_LENGTH   = 12
-	RX_IDENTIFIER = 0b00000000
-	TX_CONTROLLER = 0b00000001
+	BUFF_LENGTH   = protocol.AuthSize
+	AUTHENTICATED = true    // new bindings authenticate packets with a pre-shared key
+	ENCRYPTED     = false   // new bindings encrypt packets, implies AUTHENTICATED
+	RF_ADDRESS    = "JSTK0" // TX_ADDR and RX_ADDR_P0 before bind, the binding has its own address
+
+	RF_IRQ_PIN = machine.GPIO13 // IRQ of RF24L01, active low
+	BIND_PIN   = machine.GPIO15 // button to GND, pressed at boot: bind one more controller, held 3s: unbind
+
+	STATS_INTERVAL = time.Second * 5 // print link statistics
 )
 
 func main() {
@@ -36,79 +45,118 @@ func main() {
 	dev := hardware.NewDisplay(hardware.NewIC2(machine.I2C1, machine.GPIO3, machine.GPIO2))
 
 	println("init RF24L01")
-	nrf := hardware.NewRX(BUFF_LENGTH)
+	nrf, err := hardware.NewRX(BUFF_LENGTH, []byte(RF_ADDRESS))
+	if err != nil {
+		panic("init RF24L01: " + err.Error())
+	}
+	err = nrf.UseIRQ(hardware.NewIRQ(RF_IRQ_PIN))
+	if err != nil {
+		println("failed with nrf.UseIRQ():", err.Error())
+	}
 
-	rfMessage := make([]byte, BUFF_LENGTH)
+	bindButton := button.NewButton(BIND_PIN, machine.PinInputPullup)
+	var flags byte
+	if AUTHENTICATED {
+		flags |= bind.FlagAuth
+	}
+	if ENCRYPTED {
+		flags |= bind.FlagSeal
+	}
+	mode := hardware.ButtonBindMode(func() bool { return !bindButton.Get() })
+	bindings, err := hardware.VehicleBindings(nrf, mode, flags)
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
+	// ID del vehiculo, elegido al vincular el primer control
+	vehicle := bindings.Bindings[0].Vehicle
+	println("RX: vehicle:", vehicle)
+	err = hardware.UseVehicleBindings(nrf, BUFF_LENGTH, &bindings)
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
+	err = nrf.SetRXMode()
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
 
-	for {
-		// Esperar mensajes ...
-		newMessage := rfReceive(nrf)
+	decoder, err := hardware.NewDecoder(&bindings)
+	if err != nil {
+		panic("decoder: " + err.Error())
+	}
 
-		if newMessage == nil {
-			continue
-		}
+	rf := link.NewReceiver(nrf, hardware.VehicleLinkConfig(&bindings))
+	err = rf.Start()
+	if err != nil {
+		panic("start link: " + err.Error())
+	}
+	println("RX: channel:", rf.Channel())
+
+	var packet protocol.Packet
+	lastStats := time.Now()
+	newMessage := make([]byte, BUFF_LENGTH)
 
-		if bytes.Equal(newMessage[:], make([]byte, BUFF_LENGTH)) {
+	for {
+		pipe, n, ok, err := rf.ReceiveFrom(newMessage)
+		if err != nil {
+			println("RX: error:", err.Error())
 			continue
 		}
 
-		if !bytes.Equal(newMessage[:], rfMessage[:]) {
-			rfMessage = newMessage
+		if !ok {
+			// Sin paquetes pendientes: guardar la epoca nueva en flash
+			err = decoder.SaveEpochs()
+			if err != nil {
+				println("RX: epochs:", err.Error())
+			}
 
-			ints := make([]int, BUFF_LENGTH)
-			strs := make([]string, BUFF_LENGTH)
-			for i := 0; i < BUFF_LENGTH; i++ {
-				ints[i] = int(rfMessage[i])
-				strs[i] = strconv.FormatInt(int64(ints[i]), 10)
+			// Esperar mensajes ...
+			_, err = nrf.WaitEvent(time.Second)
+			if err != nil && err != nrf24l01.ErrTimeout {
+				println("RX: error:", err.Error())
 			}
-			println("RX: ", strings.Join(strs, "\t"))
-
-			dev.ClearDisplay()
-			tinyfont.WriteLine(
-				&dev,
-				&proggy.TinySZ8pt7b,
-				0,
-				0x09,
-				strings.Join(strs, ", "),
-				color.RGBA{255, 255, 255, 255},
-			)
-			dev.Display()
-
-			time.Sleep(time.Millisecond * 200)
+			continue
 		}
-	}
-
-}
 
-// rfReceive receives data from the given nrf24l01 device.
-//
-// nrf - a pointer to nrf24l01.Device
-// []byte - returns a byte slice
-func rfReceive(nrf *nrf24l01.Device) []byte {
-	status, err := nrf.GetStatus()
-	fifoStatus, err := nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-	if err != nil {
-		println(err)
-	}
-	r := make([]byte, BUFF_LENGTH)
-	if fifoStatus&TX_CONTROLLER == 0 {
-		// RX
-		err = nrf.ReceiveData(r)
+		err = decoder.Decode(&packet, pipe, newMessage[:n])
 		if err != nil {
-			println(err)
+			println("RX: error:", err.Error())
+			continue
 		}
 
-		// STATUS.RX_DR
-		err = nrf.SetRegisterState(nrf24l01.STATUS, status&0b01000000)
-		if err != nil {
-			println(err)
+		if !packet.For(vehicle) {
+			continue
 		}
 
-		// FIFO_STATUS.RX_EMPTY
-		fifoStatus, err = nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-		if err != nil {
-			println(err)
+		strs := make([]string, protocol.NumAxes+1)
+		for i, v := range packet.Axes {
+			strs[i] = strconv.Itoa(int(v))
+		}
+		strs[protocol.NumAxes] = strconv.FormatUint(uint64(packet.Buttons), 2)
+		println("RX: pipe:", pipe, "seq:", packet.Seq, "\t", strings.Join(strs, "\t"))
+
+		dev.ClearDisplay()
+		tinyfont.WriteLine(
+			&dev,
+			&proggy.TinySZ8pt7b,
+			0,
+			0x09,
+			strings.Join(strs, ", "),
+			color.RGBA{255, 255, 255, 255},
+		)
+		tinyfont.WriteLine(
+			&dev,
+			&proggy.TinySZ8pt7b,
+			0,
+			0x13,
+			rf.Stats().Short(),
+			color.RGBA{255, 255, 255, 255},
+		)
+		dev.Display()
+
+		if time.Since(lastStats) > STATS_INTERVAL {
+			lastStats = time.Now()
+			println("RX: stats:", rf.Stats().String())
 		}
 	}
-	return r
+
 }
@@ -0,0 +1,79 @@
+package main
+
+/**
+ * Copyright (c) 2024 Andres Sabini
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * Scanner de canales, con display SSD1306
+ * Mide la ocupación de los canales RF24L01 (RPD), dibuja un gráfico de barras
+ * y envía CSV por el puerto serie: scan,channel,hits
+ */
+
+import (
+	"image/color"
+	"joystick/internal/hardware"
+	"joystick/pkg/nrf24l01"
+	"machine"
+	"strconv"
+	"time"
+
+	"tinygo.org/x/drivers/ssd1306"
+)
+
+const (
+	BUFF_LENGTH = 12
+	RF_ADDRESS  = "JSTK0" // not used by scanning, only to configure the radio
+
+	DWELL  = time.Millisecond // time on every channel
+	SWEEPS = 20               // passes over all channels per report
+
+	DISPLAY_HEIGHT = 32
+)
+
+func main() {
+	time.Sleep(time.Second)
+	println("init...")
+	dev := hardware.NewDisplay(hardware.NewIC2(machine.I2C1, machine.GPIO3, machine.GPIO2))
+
+	println("init RF24L01")
+	nrf, err := hardware.NewRX(BUFF_LENGTH, []byte(RF_ADDRESS))
+	if err != nil {
+		panic("init RF24L01: " + err.Error())
+	}
+
+	println("scan,channel,hits")
+	for scan := 0; ; scan++ {
+		report, err := nrf.Scan(nil, DWELL, SWEEPS)
+		if err != nil {
+			println("scan: error:", err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		printCSV(scan, report)
+		drawBars(&dev, report)
+	}
+}
+
+// printCSV prints one line per channel: scan,channel,hits
+func printCSV(scan int, report nrf24l01.ChannelReport) {
+	for i, ch := range report.Channels {
+		println(strconv.Itoa(scan) + "," + strconv.Itoa(int(ch)) + "," + strconv.Itoa(report.Hits[i]))
+	}
+}
+
+// drawBars draws one column per channel, full height is hit on every sweep.
+func drawBars(dev *ssd1306.Device, report nrf24l01.ChannelReport) {
+	white := color.RGBA{255, 255, 255, 255}
+	dev.ClearBuffer()
+	for i, ch := range report.Channels {
+		h := report.Hits[i] * DISPLAY_HEIGHT / report.Sweeps
+		if h == 0 && report.Hits[i] > 0 {
+			h = 1
+		}
+		for y := DISPLAY_HEIGHT - h; y < DISPLAY_HEIGHT; y++ {
+			dev.SetPixel(int16(ch), int16(y), white)
+		}
+	}
+	dev.Display()
+}
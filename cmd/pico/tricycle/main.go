@@ -10,24 +10,49 @@ package main
  */
 
 import (
-	"bytes"
 	"image/color"
 	"joystick/internal/hardware"
+	"joystick/internal/hardware/button"
+	"joystick/pkg/arbiter"
+	"joystick/pkg/bind"
+	"joystick/pkg/failsafe"
+	"joystick/pkg/link"
 	"joystick/pkg/nrf24l01"
+	"joystick/pkg/protocol"
 	"machine"
 	"strconv"
-	"strings"
 	"time"
 
-	"tinygo.org/x/drivers/l293x"
+	"tinygo.org/x/drivers/ssd1306"
 	"tinygo.org/x/tinyfont"
 	"tinygo.org/x/tinyfont/proggy"
 )
 
 const (
-	BUFF_LENGTH   = 12
-	RX_IDENTIFIER = 0b00000000
-	TX_CONTROLLER = 0b00000001
+	BUFF_LENGTH   = protocol.AuthSize
+	AUTHENTICATED = true    // new bindings authenticate packets with a pre-shared key
+	ENCRYPTED     = false   // new bindings encrypt packets, implies AUTHENTICATED
+	RF_ADDRESS    = "JSTK0" // TX_ADDR and RX_ADDR_P0 before bind, the binding has its own address
+
+	AXIS_THRESHOLD = 8192 // 1/4 of the stroke from center
+
+	RF_IRQ_PIN  = machine.GPIO13 // IRQ of RF24L01, active low
+	BIND_PIN    = machine.GPIO15 // button to GND, pressed at boot: bind one more controller, held 3s: unbind
+	BATTERY_ADC = machine.ADC3   // VSYS/3 on the Pico
+
+	BATTERY_LOW = 3300 // mV, reported as protocol.FaultBattery
+
+	STATS_INTERVAL = time.Second * 5 // print link statistics
+
+	FAILSAFE_TIMEOUT = time.Millisecond * 500 // without valid packets, the link is lost
+	FAILSAFE_ACTION  = failsafe.ActionStop    // ActionStop, ActionCoast or ActionHold
+	FAILSAFE_HOLD    = time.Millisecond * 300 // keep the last command with ActionHold
+	FAILSAFE_POLL    = time.Millisecond * 50  // wait for packets, failsafe is checked between
+
+	INSTRUCTOR_PIPE   = 1                      // its controller overrides the others, bound second
+	TAKEOVER          = time.Second * 2        // without commands of the instructor, control goes back
+	CONTROLLER_PERIOD = time.Millisecond * 250 // max time between packets of a joystick, SEND_PERIOD + SEND_TIMEOUT
+	CONTROL_TIMEOUT   = CONTROLLER_PERIOD * 3  // the owner keeps control losing 2 packets in a row
 )
 
 func main() {
@@ -37,112 +62,230 @@ func main() {
 	dev := hardware.NewDisplay(hardware.NewIC2(machine.I2C1, machine.GPIO3, machine.GPIO2))
 
 	println("init RF24L01")
-	nrf := hardware.NewRX(BUFF_LENGTH)
+	nrf, err := hardware.NewRX(BUFF_LENGTH, []byte(RF_ADDRESS))
+	if err != nil {
+		panic("init RF24L01: " + err.Error())
+	}
+	err = nrf.UseIRQ(hardware.NewIRQ(RF_IRQ_PIN))
+	if err != nil {
+		println("failed with nrf.UseIRQ():", err.Error())
+	}
+
+	machine.InitADC()
+	battery := machine.ADC{Pin: BATTERY_ADC}
+	battery.Configure(machine.ADCConfig{})
+
+	bindButton := button.NewButton(BIND_PIN, machine.PinInputPullup)
+	var flags byte
+	if AUTHENTICATED {
+		flags |= bind.FlagAuth
+	}
+	if ENCRYPTED {
+		flags |= bind.FlagSeal
+	}
+	// Un control por pipe, el segundo es de respaldo
+	mode := hardware.ButtonBindMode(func() bool { return !bindButton.Get() })
+	bindings, err := hardware.VehicleBindings(nrf, mode, flags)
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
+	// ID del vehiculo, elegido al vincular el primer control
+	vehicle := bindings.Bindings[0].Vehicle
+	println("RX: vehicle:", vehicle)
+	err = hardware.UseVehicleBindings(nrf, BUFF_LENGTH, &bindings)
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
+	err = nrf.SetRXMode()
+	if err != nil {
+		panic("bind: " + err.Error())
+	}
+
+	decoder, err := hardware.NewDecoder(&bindings)
+	if err != nil {
+		panic("decoder: " + err.Error())
+	}
+
+	rf := link.NewReceiver(nrf, hardware.VehicleLinkConfig(&bindings))
+	err = rf.Start()
+	if err != nil {
+		panic("start link: " + err.Error())
+	}
+	println("RX: channel:", rf.Channel())
+
+	var packet protocol.Packet
+	lastStats := time.Now()
+	newMessage := make([]byte, BUFF_LENGTH)
 
-	rfMessage := make([]byte, BUFF_LENGTH)
+	motorA := newMotor(machine.GPIO18, machine.GPIO19, machine.GPIO17)
+	motorB := newMotor(machine.GPIO20, machine.GPIO21, machine.GPIO22)
 
-	motorA := l293x.New(machine.GPIO18, machine.GPIO19, machine.GPIO17)
-	motorA.Stop()
+	fs := failsafe.New(failsafe.Config{
+		Timeout: FAILSAFE_TIMEOUT,
+		Action:  FAILSAFE_ACTION,
+		Hold:    FAILSAFE_HOLD,
+	}, nil)
+	action := failsafe.ActionNone
 
-	motorB := l293x.New(machine.GPIO20, machine.GPIO21, machine.GPIO22)
-	motorB.Stop()
+	// Con varios controles, solo se ejecuta el que tiene el control
+	var priority [arbiter.MaxPipes]byte
+	priority[INSTRUCTOR_PIPE] = 1
+	arb := arbiter.New(arbiter.Config{
+		Priority: priority,
+		Takeover: TAKEOVER,
+		Timeout:  CONTROL_TIMEOUT,
+	}, nil)
+	var owner byte = arbiter.None
+
+	// Telemetria, va al control en el ACK del siguiente paquete
+	telemetry := protocol.Telemetry{Sender: vehicle}
+	var reply [protocol.TelemetrySize]byte
+	var fault byte = protocol.FaultNone
+
+	showState(&dev, fs.State().String(), "center the sticks")
 
 	for {
-		// Esperar mensajes ...
-		newMessage := rfReceive(nrf)
+		// Sin paquetes validos por FAILSAFE_TIMEOUT, estado seguro
+		if a := fs.Check(); a != action {
+			action = a
+			println("RX: failsafe:", fs.State().String(), action.String())
+			switch action {
+			case failsafe.ActionStop:
+				motorA.Brake()
+				motorB.Brake()
+			case failsafe.ActionCoast:
+				motorA.Stop()
+				motorB.Stop()
+			}
+			if action != failsafe.ActionNone {
+				showState(&dev, fs.State().String(), rf.Stats().Short())
+			}
+		}
 
-		if newMessage == nil {
+		pipe, n, ok, err := rf.ReceiveFrom(newMessage)
+		if err != nil {
+			println("RX: error:", err.Error())
+			fault = protocol.FaultRadio
 			continue
 		}
 
-		if bytes.Equal(newMessage[:], make([]byte, BUFF_LENGTH)) {
+		if !ok {
+			// Sin paquetes pendientes: guardar la epoca nueva en flash
+			err = decoder.SaveEpochs()
+			if err != nil {
+				println("RX: epochs:", err.Error())
+			}
+
+			// Esperar mensajes ...
+			_, err = nrf.WaitEvent(FAILSAFE_POLL)
+			if err != nil && err != nrf24l01.ErrTimeout {
+				println("RX: error:", err.Error())
+			}
 			continue
 		}
 
-		if !bytes.Equal(newMessage[:], rfMessage[:]) {
-			rfMessage = newMessage
+		err = decoder.Decode(&packet, pipe, newMessage[:n])
+		if err != nil {
+			println("RX: error:", err.Error())
+			fault = protocol.FaultPacket
+			continue
+		}
 
-			ints := make([]int, BUFF_LENGTH)
-			strs := make([]string, BUFF_LENGTH)
-			for i := 0; i < BUFF_LENGTH; i++ {
-				ints[i] = int(rfMessage[i])
-				strs[i] = strconv.FormatInt(int64(ints[i]), 10)
-			}
-			println("RX: ", strings.Join(strs, "\t"))
-
-			dev.ClearDisplay()
-			tinyfont.WriteLine(
-				&dev,
-				&proggy.TinySZ8pt7b,
-				0,
-				0x09,
-				strings.Join(strs, ", "),
-				color.RGBA{255, 255, 255, 255},
-			)
-			dev.Display()
-
-			if ints[1] > 200 && 180 < ints[2] && ints[2] < 200 {
-				println("Forward")
-				motorA.Forward()
-				motorB.Forward()
-			} else if ints[1] < 190 && 180 < ints[2] && ints[2] < 200 {
-				println("Backward")
-				motorA.Backward()
-				motorB.Backward()
-			} else if 190 < ints[1] && ints[1] < 200 && ints[2] > 200 {
-				println("Left")
-				motorA.Forward()
-				motorB.Backward()
-			} else if 190 < ints[1] && ints[1] < 200 && ints[2] < 180 {
-				println("Right")
-				motorA.Backward()
-				motorB.Forward()
-			} else {
-				println("Stop")
-				motorA.Stop()
-				motorB.Stop()
-			}
+		if packet.Type != protocol.TypeControl || !packet.For(vehicle) {
+			continue
+		}
 
-			if ints[3] == 0 {
-				motorA.Stop()
-				motorB.Stop()
-			}
+		// Una respuesta por paquete valido, el salto de canal la descarta
+		stats := rf.Stats()
+		telemetry.Target = bindings.Bindings[pipe].Controller
+		telemetry.Seq++
+		telemetry.Battery = batteryVoltage(battery)
+		telemetry.Motors = [2]protocol.MotorState{motorA.state, motorB.state}
+		telemetry.Failsafe = byte(fs.State())
+		telemetry.Loss = byte(stats.Loss)
+		telemetry.Strong = byte(stats.Strong)
+		telemetry.Fault = fault
+		telemetry.Control = protocol.Broadcast
+		if o := arb.Owner(); o != arbiter.None {
+			telemetry.Control = bindings.Bindings[o].Controller
+		}
+		if telemetry.Battery < BATTERY_LOW {
+			telemetry.Fault = protocol.FaultBattery
+		}
+		telemetry.Marshal(reply[:])
+		err = rf.Reply(reply[:])
+		if err != nil && err != link.ErrNotLinked {
+			println("RX: reply:", err.Error())
+		}
+		fault = protocol.FaultNone
 
-			time.Sleep(time.Millisecond * 200)
+		if time.Since(lastStats) > STATS_INTERVAL {
+			lastStats = time.Now()
+			println("RX: stats:", rf.Stats().String())
 		}
-	}
 
-}
+		neutral := packet.Neutral(AXIS_THRESHOLD)
+		if !arb.Packet(pipe, !neutral) {
+			continue
+		}
+		if o := arb.Owner(); o != owner {
+			owner = o
+			println("RX: control: pipe", owner, "controller", packet.Sender)
+		}
 
-// rfReceive receives data from the given nrf24l01 device.
-//
-// nrf - a pointer to nrf24l01.Device
-// []byte - returns a byte slice
-func rfReceive(nrf *nrf24l01.Device) []byte {
-	status, err := nrf.GetStatus()
-	fifoStatus, err := nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-	if err != nil {
-		println(err)
-	}
-	r := make([]byte, BUFF_LENGTH)
-	if fifoStatus&TX_CONTROLLER == 0 {
-		// RX
-		err = nrf.ReceiveData(r)
-		if err != nil {
-			println(err)
+		// Desarmado, se rearma solo con los sticks al centro
+		if !fs.Packet(neutral) {
+			continue
 		}
+		action = failsafe.ActionNone
 
-		// STATUS.RX_DR
-		err = nrf.SetRegisterState(nrf24l01.STATUS, status&0b01000000)
-		if err != nil {
-			println(err)
+		x := packet.Axes[protocol.AxisLeftX]
+		y := packet.Axes[protocol.AxisLeftY]
+
+		text := "X: " + strconv.Itoa(int(x)) + " Y: " + strconv.Itoa(int(y))
+		println("RX: pipe:", pipe, "seq:", packet.Seq, text, "buttons:", packet.Buttons)
+		showState(&dev, text, rf.Stats().Short())
+
+		if x > AXIS_THRESHOLD && -AXIS_THRESHOLD < y && y < AXIS_THRESHOLD {
+			println("Forward")
+			motorA.Forward()
+			motorB.Forward()
+		} else if x < -AXIS_THRESHOLD && -AXIS_THRESHOLD < y && y < AXIS_THRESHOLD {
+			println("Backward")
+			motorA.Backward()
+			motorB.Backward()
+		} else if -AXIS_THRESHOLD < x && x < AXIS_THRESHOLD && y > AXIS_THRESHOLD {
+			println("Left")
+			motorA.Forward()
+			motorB.Backward()
+		} else if -AXIS_THRESHOLD < x && x < AXIS_THRESHOLD && y < -AXIS_THRESHOLD {
+			println("Right")
+			motorA.Backward()
+			motorB.Forward()
+		} else {
+			println("Stop")
+			motorA.Stop()
+			motorB.Stop()
 		}
 
-		// FIFO_STATUS.RX_EMPTY
-		fifoStatus, err = nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-		if err != nil {
-			println(err)
+		// Boton presionado, freno
+		if packet.Pressed(protocol.ButtonLeft) {
+			motorA.Brake()
+			motorB.Brake()
 		}
 	}
-	return r
+
+}
+
+// batteryVoltage lee VSYS en mV, el ADC ve VSYS/3 con referencia de 3.3V
+func batteryVoltage(adc machine.ADC) uint16 {
+	return uint16(uint32(adc.Get()) * 3 * 3300 / 0xFFFF)
+}
+
+// showState muestra dos lineas en el display
+func showState(dev *ssd1306.Device, line1, line2 string) {
+	dev.ClearDisplay()
+	tinyfont.WriteLine(dev, &proggy.TinySZ8pt7b, 0, 0x09, line1, color.RGBA{255, 255, 255, 255})
+	tinyfont.WriteLine(dev, &proggy.TinySZ8pt7b, 0, 0x13, line2, color.RGBA{255, 255, 255, 255})
+	dev.Display()
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"joystick/pkg/protocol"
+	"machine"
+
+	"tinygo.org/x/drivers/l293x"
+)
+
+// motor is l293x.Device with brake. Stop of l293x turns the bridge off,
+// the motor rolls out (coast). The state is sent in the telemetry.
+type motor struct {
+	l293x.Device
+	a1, a2, en machine.Pin
+	state      protocol.MotorState
+}
+
+func newMotor(a1, a2, en machine.Pin) *motor {
+	m := &motor{Device: l293x.New(a1, a2, en), a1: a1, a2: a2, en: en}
+	m.Configure()
+	return m
+}
+
+func (m *motor) Forward() {
+	m.Device.Forward()
+	m.state = protocol.MotorForward
+}
+
+func (m *motor) Backward() {
+	m.Device.Backward()
+	m.state = protocol.MotorBackward
+}
+
+func (m *motor) Stop() {
+	m.Device.Stop()
+	m.state = protocol.MotorStop
+}
+
+// Brake shorts the motor: both inputs low, bridge on.
+func (m *motor) Brake() {
+	m.a1.Low()
+	m.a2.Low()
+	m.en.High()
+	m.state = protocol.MotorBrake
+}
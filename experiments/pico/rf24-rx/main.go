@@ -32,6 +32,8 @@ func main() {
 
 	ce := machine.GPIO12 // Digital Input	Chip Enable Activates RX or TX mode
 	csn := machine.GPIO5 // Digital Input	SPI Chip Select
+	ce.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	csn.Configure(machine.PinConfig{Mode: machine.PinOutput})
 
 	nrf := nrf24l01.New(spi, &ce, &csn)
 	err = nrf.Configure()
@@ -120,17 +122,18 @@ func main() {
 
 	// Try read PAYLOAD
 	for {
-		status, err = nrf.GetStatus()
-		fifoStatus, err := nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
+		st, err := nrf.GetStatus()
+		fifoStatus, err := nrf.GetFIFOStatus()
 		if err != nil {
 			println(err)
 		}
 
-		if fifoStatus&0b00000001 == 0 {
-			println("STATUS.RX_DR:        ", status&0b01000000>>6)
-			println("STATUS.RX_P_NO:      ", status&0b00001110>>1)
-			println("FIFO_STATUS.RX_FULL: ", fifoStatus&0b00000010>>1)
-			println("FIFO_STATUS.RX_EMPTY:", fifoStatus&0b00000001)
+		if !fifoStatus.RXEmpty() {
+			pipe, _ := st.RXPipe()
+			println("STATUS.RX_DR:        ", st.RXDataReady())
+			println("STATUS.RX_P_NO:      ", pipe)
+			println("FIFO_STATUS.RX_FULL: ", fifoStatus.RXFull())
+			println("FIFO_STATUS.RX_EMPTY:", fifoStatus.RXEmpty())
 			// println("FIFO_STATUS:   ", fifoStatus)
 			err = nrf.ReceiveData(r)
 			if err != nil {
@@ -143,12 +146,12 @@ func main() {
 			println("")
 
 			// STATUS.RX_DR
-			err = nrf.SetRegisterState(nrf24l01.STATUS, status&0b01000000)
+			err = nrf.ClearInterrupts(nrf24l01.STATUS_RX_DR)
 			if err != nil {
 				println(err)
 			}
 
-			fifoStatus, err = nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
+			fifoStatus, err = nrf.GetFIFOStatus()
 			println("FIFO_STATUS:         ", fifoStatus)
 			if err != nil {
 				println(err)
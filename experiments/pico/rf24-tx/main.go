@@ -29,6 +29,8 @@ func main() {
 
 	ce := machine.GPIO12 // Digital Input	Chip Enable Activates RX or TX mode
 	csn := machine.GPIO5 // Digital Input	SPI Chip Select
+	ce.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	csn.Configure(machine.PinConfig{Mode: machine.PinOutput})
 
 	nrf := nrf24l01.New(spi, &ce, &csn)
 	err = nrf.Configure()
@@ -134,15 +136,15 @@ func main() {
 		println("TX: RF_CH:               ", res)
 		res, _ := nrf.GetRegisterState(nrf24l01.OBSERVE_TX)
 		println("TX: OBSERVE_TX:          ", res)
-		res, _ = nrf.GetRegisterState(nrf24l01.FIFO_STATUS)
-		println("TX: FIFO_STATUS:         ", res)
-		println("TX: FIFO_STATUS.TX_REUSE:", res&0b01000000 > 0)
-		println("TX: FIFO_STATUS.TX_FULL: ", res&0b00100000 > 0)
+		fifoStatus, _ := nrf.GetFIFOStatus()
+		println("TX: FIFO_STATUS:         ", fifoStatus)
+		println("TX: FIFO_STATUS.TX_REUSE:", fifoStatus.TXReuse())
+		println("TX: FIFO_STATUS.TX_FULL: ", fifoStatus.TXFull())
 		res, _ = nrf.GetRegisterState(nrf24l01.CONFIG)
 		println("TX: CONFIG:              ", res)
-		status, _ = nrf.GetRegisterState(nrf24l01.STATUS)
-		println("TX: STATUS:              ", status)
-		println("TX: STATUS.TX_DS:        ", status&0b00100000>>5)
+		st, _ := nrf.GetStatus()
+		println("TX: STATUS:              ", st)
+		println("TX: STATUS.TX_DS:        ", st.TXDataSent())
 		res, _ = nrf.GetRegisterState(nrf24l01.FEATURE)
 		println("TX: FEATURE:             ", res)
 
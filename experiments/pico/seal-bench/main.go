@@ -0,0 +1,69 @@
+package main
+
+/**
+ * Copyright (c) 2024 Andres Sabini
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ *
+ * Mide en la pico el tiempo de autenticar y cifrar un paquete,
+ * tiene que ser mucho menor que el periodo de envio del joystick.
+ */
+
+import (
+	"joystick/pkg/protocol"
+	"strconv"
+	"time"
+)
+
+const (
+	ROUNDS      = 1000
+	SEND_PERIOD = time.Millisecond * 150 // periodo de envio del joystick
+)
+
+var key = []byte("0123456789abcdef")
+
+func main() {
+	time.Sleep(time.Second * 2)
+	println("initializing...")
+
+	auth := protocol.NewAuth(key)
+	rxAuth := protocol.NewAuth(key)
+	cipher, err := protocol.NewCipher(key)
+	if err != nil {
+		panic(err.Error())
+	}
+	rxCipher, _ := protocol.NewCipher(key)
+
+	var packet, got protocol.Packet
+	var buf [protocol.AuthSize]byte
+
+	for {
+		measure("plain", func() {
+			packet.Seq++
+			packet.Marshal(buf[:])
+			got.Unmarshal(buf[:])
+		})
+		measure("auth", func() {
+			packet.Seq++
+			packet.MarshalAuth(buf[:], auth)
+			got.UnmarshalAuth(buf[:], rxAuth)
+		})
+		measure("sealed", func() {
+			packet.Seq++
+			packet.MarshalSealed(buf[:], cipher)
+			got.UnmarshalSealed(buf[:], rxCipher)
+		})
+		time.Sleep(time.Second * 5)
+	}
+}
+
+// measure prints time of one marshal and unmarshal.
+func measure(name string, f func()) {
+	start := time.Now()
+	for i := 0; i < ROUNDS; i++ {
+		f()
+	}
+	per := time.Since(start) / ROUNDS
+	println(name+":", strconv.FormatInt(per.Microseconds(), 10), "µs per packet,",
+		strconv.FormatInt(int64(per)*10000/int64(SEND_PERIOD), 10), "‱ of send period")
+}
@@ -0,0 +1,206 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"errors"
+	"joystick/pkg/bind"
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/storage"
+	"machine"
+	"time"
+)
+
+// Flash erase blocks of machine.Flash (the data area after the program).
+const (
+	BindBlock        = 0 // bindings of controller and vehicle, see bind.Table
+	EpochBlock       = 1 // epoch of authenticated packets, see NextEpoch
+	CalibrationBlock = 2 // calibration of the joysticks, see LoadCalibration
+	ReplayBlock      = 3 // last epoch accepted from every pipe, see Decoder
+)
+
+// magic of the epoch record.
+const epochMagic = 0xE90C
+
+var ErrEpochsUsed = errors.New("hardware: all epochs are used, unbind (BindReset) and bind again")
+
+// Time in bind mode before it's tried again.
+const bindTimeout = 10 * time.Second
+
+// Random returns a random number from the hardware RNG. Without it bind
+// fails, keys and addresses from a guessable source aren't used.
+func Random() (uint32, error) {
+	return machine.GetRNG()
+}
+
+// BindMode is what to do at start with the bindings in flash.
+type BindMode byte
+
+const (
+	BindKeep  BindMode = iota // use the bindings, bind mode only without them
+	BindAdd                   // bind mode for one more vehicle or controller
+	BindReset                 // erase the bindings and bind again
+)
+
+// bindResetHold is the time the bind button is held at boot to erase
+// the bindings.
+const bindResetHold = 3 * time.Second
+
+// ButtonBindMode returns BindMode from a button at boot: released -
+// BindKeep, pressed - BindAdd, held for 3s - BindReset.
+// pressed reports whether the button is pressed.
+func ButtonBindMode(pressed func() bool) BindMode {
+	if !pressed() {
+		return BindKeep
+	}
+	println("bind: release to add, hold to unbind")
+	deadline := time.Now().Add(bindResetHold)
+	for time.Now().Before(deadline) {
+		if !pressed() {
+			return BindAdd
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return BindReset
+}
+
+// ControllerBindings returns the vehicles bound to the controller from
+// flash. Without them, with BindAdd or with BindReset the controller
+// stays in bind mode until a vehicle is bound. The ID of the controller
+// is Controller of the bindings, random at the first bind.
+func ControllerBindings(nrf *nrf24l01.Device, mode BindMode, sendTimeout time.Duration) (bind.Table, error) {
+	t, err := loadBindings(mode, EpochBlock)
+	if err != nil || mode == BindKeep && t.Len > 0 {
+		return t, err
+	}
+	if t.Len == bind.MaxBindings {
+		return t, bind.ErrFull
+	}
+	var id byte
+	if t.Len > 0 {
+		id = t.Bindings[0].Controller
+	} else {
+		id, err = bind.NewID(Random)
+		if err != nil {
+			return t, err
+		}
+	}
+	var b bind.Binding
+	for {
+		println("bind: waiting for a vehicle in bind mode")
+		b, err = bind.Request(nrf, id, bindTimeout, sendTimeout)
+		if err == nil {
+			break
+		}
+		if err != bind.ErrTimeout {
+			return t, err
+		}
+	}
+	println("bind: controller", b.Controller, "bound to vehicle", b.Vehicle, "channel", b.Channel)
+	return t, saveBinding(&t, b)
+}
+
+// VehicleBindings returns the controllers bound to the vehicle from
+// flash, one per pipe. Without them, with BindAdd or with BindReset the
+// vehicle stays in bind mode until a controller is bound. The ID of the
+// vehicle is Vehicle of the bindings, random at the first bind.
+// flags - options of a new link, bind.FlagAuth.
+func VehicleBindings(nrf *nrf24l01.Device, mode BindMode, flags byte) (bind.Table, error) {
+	t, err := loadBindings(mode, ReplayBlock)
+	if err != nil || mode == BindKeep && t.Len > 0 {
+		return t, err
+	}
+	if t.Len == bind.MaxBindings {
+		return t, bind.ErrFull
+	}
+	var offer bind.Binding
+	if t.Len > 0 {
+		offer, err = t.Bindings[0].ForPipe(byte(t.Len), Random)
+	} else {
+		var id byte
+		id, err = bind.NewID(Random)
+		if err == nil {
+			offer, err = bind.Generate(Random, id, flags)
+		}
+	}
+	if err != nil {
+		return t, err
+	}
+	var b bind.Binding
+	for {
+		println("bind: waiting for a controller in bind mode, pipe", t.Len)
+		b, err = bind.Accept(nrf, offer, bindTimeout)
+		if err == nil {
+			break
+		}
+		if err != bind.ErrTimeout {
+			return t, err
+		}
+	}
+	println("bind: vehicle", b.Vehicle, "bound to controller", b.Controller, "channel", b.Channel)
+	return t, saveBinding(&t, b)
+}
+
+// UseBinding applies RadioConfig with the address of the binding,
+// the controller sends to the vehicle of b.
+// Set the mode after it, link.Config comes from LinkConfig.
+func UseBinding(nrf *nrf24l01.Device, bufferLength int, b bind.Binding) error {
+	return nrf.Apply(RadioConfig(bufferLength, b.Address[:]))
+}
+
+// UseVehicleBindings applies RadioConfig with a pipe for every controller
+// of the vehicle. Set the mode after it, link.Config comes from
+// VehicleLinkConfig.
+func UseVehicleBindings(nrf *nrf24l01.Device, bufferLength int, t *bind.Table) error {
+	config := RadioConfig(bufferLength, t.Bindings[0].Address[:])
+	t.SetPipes(&config)
+	return nrf.Apply(config)
+}
+
+// loadBindings reads the bindings, with BindReset erases them and
+// counters, the record of the counters of the old keys.
+func loadBindings(mode BindMode, counters int64) (bind.Table, error) {
+	if mode == BindReset {
+		println("bind: unbind")
+		err := bind.Unbind(machine.Flash, BindBlock)
+		if err == nil {
+			err = storage.Erase(machine.Flash, counters)
+		}
+		return bind.Table{}, err
+	}
+	t, err := bind.Load(machine.Flash, BindBlock)
+	if err == bind.ErrNotBound {
+		return t, nil
+	}
+	return t, err
+}
+
+func saveBinding(t *bind.Table, b bind.Binding) error {
+	_, err := t.Add(b)
+	if err != nil {
+		return err
+	}
+	return bind.Save(machine.Flash, BindBlock, t)
+}
+
+// NextEpoch increases the epoch of authenticated packets in flash and
+// returns it. The controller calls it at start and when Seq wraps around,
+// so the counter of protocol.Auth is never reused. After the last epoch
+// it returns ErrEpochsUsed: the keys must be replaced, BindReset erases
+// the epoch with the bindings.
+func NextEpoch() (uint16, error) {
+	var buf [2]byte
+	err := storage.Load(machine.Flash, EpochBlock, epochMagic, buf[:])
+	if err != nil && err != storage.ErrNoRecord {
+		return 0, err
+	}
+	epoch := binary.LittleEndian.Uint16(buf[:])
+	if err == storage.ErrNoRecord {
+		epoch = 0
+	}
+	if epoch == 0xFFFF {
+		return 0, ErrEpochsUsed
+	}
+	epoch++
+	binary.LittleEndian.PutUint16(buf[:], epoch)
+	return epoch, storage.Save(machine.Flash, EpochBlock, epochMagic, buf[:])
+}
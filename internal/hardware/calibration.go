@@ -0,0 +1,30 @@
+package hardware
+
+import (
+	"joystick/internal/hardware/joystick"
+	"joystick/internal/pkg/calibration"
+	"machine"
+)
+
+// LoadCalibration reads calibration of joysticks from flash. Without it
+// returns calibration.ErrNotCalibrated and the joysticks aren't changed.
+func LoadCalibration(joysticks ...*joystick.Joystick) error {
+	axes := make([]calibration.Axis, 2*len(joysticks))
+	err := calibration.Load(machine.Flash, CalibrationBlock, axes)
+	if err != nil {
+		return err
+	}
+	for i, j := range joysticks {
+		copy(j.Calibration[:], axes[2*i:])
+	}
+	return nil
+}
+
+// SaveCalibration writes calibration of joysticks into flash.
+func SaveCalibration(joysticks ...*joystick.Joystick) error {
+	axes := make([]calibration.Axis, 0, 2*len(joysticks))
+	for _, j := range joysticks {
+		axes = append(axes, j.Calibration[:]...)
+	}
+	return calibration.Save(machine.Flash, CalibrationBlock, axes)
+}
@@ -0,0 +1,115 @@
+package hardware
+
+import (
+	"encoding/binary"
+	"errors"
+	"joystick/pkg/bind"
+	"joystick/pkg/protocol"
+	"joystick/pkg/storage"
+	"machine"
+)
+
+var ErrSender = errors.New("decoder: sender isn't the controller of the pipe")
+
+// magic of the record of the last epochs accepted, see Decoder.
+const replayMagic = 0x4E9A
+
+// Decoder reads packets of the controllers of a vehicle, one per pipe,
+// plain, authenticated or sealed as their bindings say.
+//
+// The last epoch accepted from every pipe is kept in flash by
+// SaveEpochs: after a restart packets of it and older epochs are
+// rejected, recorded packets can't be sent again.
+type Decoder struct {
+	table  *bind.Table
+	auth   [bind.MaxBindings]*protocol.Auth
+	cipher [bind.MaxBindings]*protocol.Cipher
+	epochs [bind.MaxBindings]uint16 // last accepted
+	saved  [bind.MaxBindings]uint16 // in flash
+}
+
+// NewDecoder returns decoder of the controllers of t.
+func NewDecoder(t *bind.Table) (*Decoder, error) {
+	d := &Decoder{table: t}
+	var buf [2 * bind.MaxBindings]byte
+	err := storage.Load(machine.Flash, ReplayBlock, replayMagic, buf[:])
+	if err != nil && err != storage.ErrNoRecord {
+		return nil, err
+	}
+	resume := err == nil
+	if resume {
+		for i := range d.epochs {
+			d.epochs[i] = binary.LittleEndian.Uint16(buf[2*i:])
+		}
+		d.saved = d.epochs
+	}
+	for i, b := range t.List() {
+		if b.Auth() {
+			d.auth[i] = protocol.NewAuth(b.Key[:])
+			if resume {
+				d.auth[i].Resume(d.epochs[i])
+			}
+		}
+		if b.Sealed() {
+			d.cipher[i], err = protocol.NewCipher(b.Key[:])
+			if err != nil {
+				return nil, err
+			}
+			if resume {
+				d.cipher[i].Resume(d.epochs[i])
+			}
+		}
+	}
+	return d, nil
+}
+
+// Decode reads packet p from data received on pipe. Returns ErrSender if
+// the packet comes from another controller than the one of the pipe.
+// A new epoch is only kept in memory, see SaveEpochs.
+func (d *Decoder) Decode(p *protocol.Packet, pipe byte, data []byte) error {
+	if int(pipe) >= d.table.Len {
+		return ErrSender
+	}
+	var err error
+	var epoch uint16
+	switch {
+	case d.cipher[pipe] != nil:
+		err = p.UnmarshalSealed(data, d.cipher[pipe])
+		epoch = d.cipher[pipe].LastEpoch()
+	case d.auth[pipe] != nil:
+		err = p.UnmarshalAuth(data, d.auth[pipe])
+		epoch = d.auth[pipe].LastEpoch()
+	default:
+		err = p.Unmarshal(data)
+	}
+	if err != nil {
+		return err
+	}
+	if p.Sender != d.table.Bindings[pipe].Controller {
+		return ErrSender
+	}
+	if epoch > d.epochs[pipe] {
+		d.epochs[pipe] = epoch
+	}
+	return nil
+}
+
+// SaveEpochs writes to flash the epochs accepted since the last call, if
+// any advanced past the saved one. It erases a flash block, call it out of
+// the packet path, e.g. while waiting for packets. Until it's called, the
+// packets of a new epoch can be sent again after a restart.
+func (d *Decoder) SaveEpochs() error {
+	if d.epochs == d.saved {
+		return nil
+	}
+	var buf [2 * bind.MaxBindings]byte
+	for i, e := range d.epochs {
+		binary.LittleEndian.PutUint16(buf[2*i:], e)
+	}
+	err := storage.Save(machine.Flash, ReplayBlock, replayMagic, buf[:])
+	if err != nil {
+		return err
+	}
+	d.saved = d.epochs
+	return nil
+}
@@ -0,0 +1,25 @@
+package hardware
+
+import (
+	"machine"
+)
+
+// IRQ is the interrupt output of nRF24L01 connected to a GPIO.
+// It satisfies nrf24l01.IRQPin.
+type IRQ struct {
+	machine.Pin
+}
+
+func NewIRQ(pin machine.Pin) IRQ {
+	pin.Configure(machine.PinConfig{Mode: machine.PinInputPullup})
+	return IRQ{pin}
+}
+
+func (p IRQ) SetInterrupt(callback func()) error {
+	if callback == nil {
+		return p.Pin.SetInterrupt(0, nil)
+	}
+	return p.Pin.SetInterrupt(machine.PinFalling, func(machine.Pin) {
+		callback()
+	})
+}
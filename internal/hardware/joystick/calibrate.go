@@ -0,0 +1,54 @@
+package joystick
+
+import (
+	"joystick/internal/pkg/calibration"
+	"time"
+)
+
+// Readings of the calibration routine
+const calibrationPoll = 10 * time.Millisecond
+
+// Calibrate runs the calibration routine of joysticks: hold the sticks
+// centered for center, then sweep them to all extremes for sweep.
+// show - prints the step, for the serial log or a display.
+// On error the calibration of the joysticks isn't changed.
+func Calibrate(joysticks []*Joystick, center, sweep time.Duration, show func(step string)) error {
+	recorders := make([][2]calibration.Recorder, len(joysticks))
+
+	show("calibration: hold the sticks centered")
+	for end := time.Now().Add(center); time.Now().Before(end); {
+		for i, j := range joysticks {
+			x, y, _ := j.Read()
+			recorders[i][0].Center(x)
+			recorders[i][1].Center(y)
+		}
+		time.Sleep(calibrationPoll)
+	}
+
+	show("calibration: sweep the sticks to all sides")
+	for end := time.Now().Add(sweep); time.Now().Before(end); {
+		for i, j := range joysticks {
+			x, y, _ := j.Read()
+			recorders[i][0].Sweep(x)
+			recorders[i][1].Sweep(y)
+		}
+		time.Sleep(calibrationPoll)
+	}
+
+	axes := make([][2]calibration.Axis, len(joysticks))
+	for i := range recorders {
+		for k := range recorders[i] {
+			a, err := recorders[i][k].Axis()
+			if err != nil {
+				show("calibration: " + joysticks[i].ID + ": " + err.Error())
+				return err
+			}
+			axes[i][k] = a
+		}
+	}
+	for i, j := range joysticks {
+		j.Calibration = axes[i]
+	}
+	show("calibration: done")
+	return nil
+}
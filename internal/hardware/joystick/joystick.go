@@ -1,7 +1,9 @@
 package joystick
 
 import (
+	"joystick/internal/pkg/axis"
 	"joystick/internal/pkg/boolean"
+	"joystick/internal/pkg/calibration"
 	"machine"
 	"strconv"
 )
@@ -9,12 +11,17 @@ import (
 type Joystick struct {
 	ID string
 	HW *Hardware
+	// X and Y, see Calibrate
+	Calibration [2]calibration.Axis
+	// Deadzones, curves, inversion and scaling after calibration
+	Response axis.Stick
 }
 
 func NewJoystick(id string, hw *Hardware) *Joystick {
 	return &Joystick{
-		ID: id,
-		HW: hw,
+		ID:          id,
+		HW:          hw,
+		Calibration: [2]calibration.Axis{calibration.Default, calibration.Default},
 	}
 }
 
@@ -51,6 +58,14 @@ func (j *Joystick) Read() (uint16, uint16, bool) {
 	return j.HW.Read()
 }
 
+// ReadAxes returns X and Y normalized with Calibration and processed by
+// Response, -calibration.Max to calibration.Max
+func (j *Joystick) ReadAxes() (int16, int16, bool) {
+	x, y, s := j.Read()
+	x2, y2 := j.Response.Apply(j.Calibration[0].Normalize(x), j.Calibration[1].Normalize(y))
+	return x2, y2, s
+}
+
 func (j *Joystick) ReadUnit8() (uint8, uint8, uint8, uint8, uint8) {
 	x, y, s := j.Read()
 	return uint8(x / 255), uint8(x % 255), uint8(y / 255), uint8(y % 255), boolean.ToByte(s)
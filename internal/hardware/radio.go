@@ -0,0 +1,121 @@
+package hardware
+
+import (
+	"joystick/pkg/bind"
+	"joystick/pkg/link"
+	"joystick/pkg/nrf24l01"
+	"machine"
+	"time"
+)
+
+// Channel the radio is configured to at start, before the binding is used.
+const RendezvousChannel = 100
+
+// RadioConfig returns setup of RF24L01 shared by transmitter and receiver.
+// Payloads have dynamic length, with auto-ack and ACK payloads for the link
+// handshake (see LinkConfig).
+// bufferLength - RX_PW_P0, not used with dynamic payload length.
+// address - 5 bytes, LSByte first. Used as TX_ADDR and RX_ADDR_P0, kits
+// with different addresses don't hear each other on the same channel.
+func RadioConfig(bufferLength int, address []byte) nrf24l01.Config {
+	return nrf24l01.Config{
+		Channel:      RendezvousChannel,
+		DataRate:     nrf24l01.DataRate250Kbps,
+		PALevel:      nrf24l01.PALevelMax,
+		CRC:          nrf24l01.CRC8,
+		AddressWidth: 5,
+		TXAddress:    address,
+		Pipes: [6]nrf24l01.Pipe{
+			{Enabled: true, AutoAck: true, DynamicPayload: true, PayloadWidth: byte(bufferLength), Address: address},
+		},
+		// 4000µs, 15 retransmits. Minimum for 32B payload in ESB@250KBPS is 1500µs.
+		RetryDelay: 15,
+		RetryCount: 15,
+
+		DynamicPayload: true,
+		AckPayload:     true,
+		DynamicAck:     true, // W_TX_PAYLOAD_NOACK
+	}
+}
+
+// LinkConfig returns setup of the link shared by transmitter and receiver.
+// sendTimeout - timeout of one packet.
+// b - binding, its channel is the rendezvous channel and its seed is
+// the hop seed.
+func LinkConfig(sendTimeout time.Duration, b bind.Binding) link.Config {
+	return link.Config{
+		Rendezvous:  b.Channel,
+		Dwell:       time.Millisecond,
+		Sweeps:      10,
+		Timeout:     time.Second,
+		SendTimeout: sendTimeout,
+		Seed:        b.Seed,
+	}
+}
+
+// VehicleLinkConfig returns LinkConfig of the vehicle with a pipe for
+// every controller of t.
+func VehicleLinkConfig(t *bind.Table) link.Config {
+	config := LinkConfig(0, t.Bindings[0])
+	config.Pipes = t.Pipes()
+	return config
+}
+
+// newRadio sets up SPI and pins, checks the chip and applies RadioConfig.
+// The radio is left in power down mode.
+func newRadio(bufferLength int, address []byte) (*nrf24l01.Device, error) {
+	spi := machine.SPI0
+	err := spi.Configure(machine.SPIConfig{
+		SCK: machine.GPIO6,
+		SDO: machine.GPIO7,
+		SDI: machine.GPIO4,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ce := machine.GPIO12 // Digital Input	Chip Enable Activates RX or TX mode
+	csn := machine.GPIO5 // Digital Input	SPI Chip Select
+	ce.Configure(machine.PinConfig{Mode: machine.PinOutput})
+	csn.Configure(machine.PinConfig{Mode: machine.PinOutput})
+
+	nrf := nrf24l01.New(spi, &ce, &csn)
+	err = nrf.Configure()
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err := nrf.Probe()
+	if err != nil {
+		return nil, err
+	}
+	println("radio:", variant.String())
+
+	err = nrf.SelfTest()
+	if err != nil {
+		return nil, err
+	}
+
+	err = nrf.Apply(RadioConfig(bufferLength, address))
+	if err != nil {
+		return nil, err
+	}
+	return nrf, nil
+}
+
+// printRegisters prints main registers of the radio for debugging.
+func printRegisters(mode string, nrf *nrf24l01.Device) {
+	for _, r := range [...]byte{
+		nrf24l01.CONFIG, nrf24l01.EN_AA, nrf24l01.EN_RXADDR, nrf24l01.SETUP_AW,
+		nrf24l01.RF_CH, nrf24l01.RF_SETUP, nrf24l01.STATUS, nrf24l01.RX_ADDR_P0,
+		nrf24l01.RX_PW_P0, nrf24l01.RX_PW_P1, nrf24l01.FIFO_STATUS, nrf24l01.FEATURE,
+	} {
+		res, err := nrf.GetRegisterState(r)
+		if err != nil {
+			println(mode+":", nrf24l01.RegisterName(r), err.Error())
+			continue
+		}
+		println(mode+":", nrf24l01.RegisterName(r), res)
+	}
+	println("--------------------------------------------------")
+}
@@ -0,0 +1,165 @@
+// Package axis shapes the response of joystick axes after calibration.
+//
+// Values are -Max to Max, see calibration.Max. A Pipeline applies stages
+// (deadzone, curves, inversion, scaling, clamping) to one axis in order.
+// Stick adds the radial deadzone, that works on X and Y together.
+//
+// The math is integer only, the RP2040 has no FPU.
+package axis
+
+// Max is the limit of values, -Max to Max.
+const Max = 32767
+
+// Stage processes one value of an axis. Stages may return values out of
+// -Max to Max, Pipeline clamps the result.
+type Stage func(v int32) int32
+
+// Pipeline is the stages of one axis, applied in order.
+// nil keeps the value.
+type Pipeline []Stage
+
+// Apply returns v processed by the stages, clamped to -Max to Max.
+func (p Pipeline) Apply(v int16) int16 {
+	r := int32(v)
+	for _, stage := range p {
+		r = stage(r)
+	}
+	return int16(clamp(r, -Max, Max))
+}
+
+// Deadzone returns the axial deadzone: values up to width from the center
+// are 0, the rest is rescaled to start from 0 and still reach Max.
+func Deadzone(width int32) Stage {
+	return func(v int32) int32 {
+		m := abs(v)
+		if m <= width || width >= Max {
+			return 0
+		}
+		return sign(v) * int32(int64(m-width)*Max/int64(Max-width))
+	}
+}
+
+// Expo returns the exponential curve: percent 0 is linear, 100 is cubic.
+// It's softer around the center and keeps the extremes.
+func Expo(percent int32) Stage {
+	percent = clamp(percent, 0, 100)
+	return func(v int32) int32 {
+		cube := int64(v) * int64(v) * int64(v) / (Max * Max)
+		return int32(((100-int64(percent))*int64(v) + int64(percent)*cube) / 100)
+	}
+}
+
+// Curve returns a custom response: points at equal steps from 0 to Max,
+// linear between them, mirrored for negative values. points[0] is
+// the output at the center. With less than 2 points the value is kept.
+func Curve(points ...int32) Stage {
+	if len(points) < 2 {
+		return func(v int32) int32 {
+			return v
+		}
+	}
+	segments := int64(len(points) - 1)
+	return func(v int32) int32 {
+		m := int64(abs(v))
+		pos := m * segments // Max per segment
+		i := pos / Max
+		if i >= segments {
+			return sign(v) * points[segments]
+		}
+		a, b := int64(points[i]), int64(points[i+1])
+		return sign(v) * int32(a+(b-a)*(pos-i*Max)/Max)
+	}
+}
+
+// Invert returns the stage that inverts the axis.
+func Invert() Stage {
+	return func(v int32) int32 {
+		return -v
+	}
+}
+
+// Scale returns the stage that multiplies the axis by percent, rates for
+// beginners are lower than 100.
+func Scale(percent int32) Stage {
+	return func(v int32) int32 {
+		return int32(int64(v) * int64(percent) / 100)
+	}
+}
+
+// Clamp returns the stage that limits the axis to min to max.
+func Clamp(min, max int32) Stage {
+	return func(v int32) int32 {
+		return clamp(v, min, max)
+	}
+}
+
+// Stick processes X and Y of a stick. The zero value keeps the values.
+type Stick struct {
+	// Radial is the radius of the radial deadzone, 0 - none. Values in
+	// the circle are 0, the rest is rescaled along the direction.
+	Radial int32
+
+	X, Y Pipeline
+}
+
+// Apply returns x and y after the radial deadzone and the pipelines.
+func (s *Stick) Apply(x, y int16) (int16, int16) {
+	if s.Radial > 0 {
+		x, y = radial(x, y, s.Radial)
+	}
+	return s.X.Apply(x), s.Y.Apply(y)
+}
+
+// radial applies the radial deadzone of radius r.
+func radial(x, y int16, r int32) (int16, int16) {
+	m := int64(sqrt(uint32(int32(x)*int32(x)) + uint32(int32(y)*int32(y))))
+	if m <= int64(r) || r >= Max {
+		return 0, 0
+	}
+	// New magnitude, the corners can exceed Max and are clamped later.
+	n := (m - int64(r)) * Max / (Max - int64(r))
+	return int16(clamp(int32(int64(x)*n/m), -Max, Max)), int16(clamp(int32(int64(y)*n/m), -Max, Max))
+}
+
+// sqrt returns the integer square root of v.
+func sqrt(v uint32) uint32 {
+	var r uint32
+	bit := uint32(1) << 30
+	for bit > v {
+		bit >>= 2
+	}
+	for bit != 0 {
+		if v >= r+bit {
+			v -= r + bit
+			r = r>>1 + bit
+		} else {
+			r >>= 1
+		}
+		bit >>= 2
+	}
+	return r
+}
+
+func clamp(v, min, max int32) int32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int32) int32 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
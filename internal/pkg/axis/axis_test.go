@@ -0,0 +1,152 @@
+package axis
+
+import "testing"
+
+const M = Max
+
+func TestPipeline(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		in       int16
+		want     int16
+	}{
+		{"none", nil, 1234, 1234},
+		{"none max", nil, M, M},
+		{"none min", nil, -M, -M},
+		{"none -32768 clamped", nil, -32768, -M},
+
+		{"deadzone inside", Pipeline{Deadzone(2000)}, 2000, 0},
+		{"deadzone inside negative", Pipeline{Deadzone(2000)}, -1999, 0},
+		{"deadzone center", Pipeline{Deadzone(2000)}, 0, 0},
+		{"deadzone edge", Pipeline{Deadzone(2000)}, 2001, 1},
+		{"deadzone edge negative", Pipeline{Deadzone(2000)}, -2001, -1},
+		{"deadzone max", Pipeline{Deadzone(2000)}, M, M},
+		{"deadzone min", Pipeline{Deadzone(2000)}, -M, -M},
+		{"deadzone -32768", Pipeline{Deadzone(2000)}, -32768, -M},
+		{"deadzone half", Pipeline{Deadzone(2000)}, 2000 + (M-2000)/2, M/2 - 1},
+		{"deadzone all", Pipeline{Deadzone(M)}, M, 0},
+		{"deadzone all -32768", Pipeline{Deadzone(M)}, -32768, 0},
+		{"deadzone 0", Pipeline{Deadzone(0)}, 1, 1},
+
+		{"expo 0 linear", Pipeline{Expo(0)}, 10000, 10000},
+		{"expo center", Pipeline{Expo(50)}, 0, 0},
+		{"expo max", Pipeline{Expo(50)}, M, M},
+		{"expo min", Pipeline{Expo(50)}, -M, -M},
+		{"expo -32768", Pipeline{Expo(100)}, -32768, -M},
+		{"expo 100 max", Pipeline{Expo(100)}, M, M},
+		{"expo 100 half", Pipeline{Expo(100)}, M / 2, 4095},
+		{"expo 50 half", Pipeline{Expo(50)}, M / 2, 10239},
+		{"expo 50 negative", Pipeline{Expo(50)}, -M / 2, -10239},
+		{"expo over 100 is cubic", Pipeline{Expo(150)}, M / 2, 4095},
+		{"expo under 0 is linear", Pipeline{Expo(-10)}, 10000, 10000},
+
+		{"curve linear", Pipeline{Curve(0, M)}, 12345, 12345},
+		{"curve point", Pipeline{Curve(0, 4000, 16000, M)}, M / 3, 3999},
+		{"curve between", Pipeline{Curve(0, 4000, 16000, M)}, M / 2, 9999},
+		{"curve negative", Pipeline{Curve(0, 4000, 16000, M)}, -M / 2, -9999},
+		{"curve max", Pipeline{Curve(0, 4000, 16000, M)}, M, M},
+		{"curve min", Pipeline{Curve(0, 4000, 16000, M)}, -M, -M},
+		{"curve -32768", Pipeline{Curve(0, 4000, 16000, M)}, -32768, -M},
+		{"curve offset center", Pipeline{Curve(1000, M)}, 0, 1000},
+		{"curve one point", Pipeline{Curve(5)}, 777, 777},
+		{"curve no points", Pipeline{Curve()}, -777, -777},
+
+		{"invert", Pipeline{Invert()}, 1000, -1000},
+		{"invert max", Pipeline{Invert()}, M, -M},
+		{"invert min", Pipeline{Invert()}, -M, M},
+		{"invert -32768 clamped", Pipeline{Invert()}, -32768, M},
+
+		{"scale half", Pipeline{Scale(50)}, 10000, 5000},
+		{"scale half min", Pipeline{Scale(50)}, -M, -M / 2},
+		{"scale 0", Pipeline{Scale(0)}, M, 0},
+		{"scale over clamped", Pipeline{Scale(200)}, 20000, M},
+		{"scale over negative", Pipeline{Scale(200)}, -20000, -M},
+		{"scale -32768", Pipeline{Scale(100)}, -32768, -M},
+		{"scale negative inverts", Pipeline{Scale(-100)}, M, -M},
+
+		{"clamp", Pipeline{Clamp(-1000, 2000)}, 3000, 2000},
+		{"clamp low", Pipeline{Clamp(-1000, 2000)}, -3000, -1000},
+		{"clamp inside", Pipeline{Clamp(-1000, 2000)}, 500, 500},
+		{"clamp max", Pipeline{Clamp(-1000, 2000)}, M, 2000},
+		{"clamp -32768", Pipeline{Clamp(-1000, 2000)}, -32768, -1000},
+		{"clamp wider than Max", Pipeline{Clamp(-40000, 40000)}, -32768, -M},
+
+		// Order matters: deadzone before scale keeps the full stroke.
+		{"deadzone scale", Pipeline{Deadzone(2000), Scale(50)}, M, M / 2},
+		{"scale deadzone", Pipeline{Scale(50), Deadzone(2000)}, 3000, 0},
+		{"expo invert", Pipeline{Expo(100), Invert()}, M / 2, -4095},
+		{"scale clamp", Pipeline{Scale(200), Clamp(-10000, 10000)}, 4000, 8000},
+	}
+	for _, tt := range tests {
+		if got := tt.pipeline.Apply(tt.in); got != tt.want {
+			t.Errorf("%s: Apply(%d) = %d, want %d", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStick(t *testing.T) {
+	tests := []struct {
+		name         string
+		stick        Stick
+		x, y         int16
+		wantX, wantY int16
+	}{
+		{"zero value", Stick{}, 100, -100, 100, -100},
+		{"zero value -32768", Stick{}, -32768, -32768, -M, -M},
+		{"radial center", Stick{Radial: 2000}, 0, 0, 0, 0},
+		{"radial inside", Stick{Radial: 2000}, 1200, 1500, 0, 0},
+		{"radial outside of axial", Stick{Radial: 2000}, 1500, 1500, 90, 90},
+		{"radial max x", Stick{Radial: 2000}, M, 0, M, 0},
+		{"radial min x", Stick{Radial: 2000}, -M, 0, -M, 0},
+		{"radial max y", Stick{Radial: 2000}, 0, M, 0, M},
+		{"radial min y", Stick{Radial: 2000}, 0, -M, 0, -M},
+		{"radial -32768 x", Stick{Radial: 2000}, -32768, 0, -M, 0},
+		{"radial corner", Stick{Radial: 2000}, M, M, M, M},
+		{"radial corner x negative", Stick{Radial: 2000}, -M, M, -M, M},
+		{"radial corner y negative", Stick{Radial: 2000}, M, -M, M, -M},
+		{"radial corner negative", Stick{Radial: 2000}, -M, -M, -M, -M},
+		{"radial corner -32768", Stick{Radial: 2000}, -32768, -32768, -M, -M},
+		{"radial keeps direction", Stick{Radial: 2000}, 12000, -16000, 11502, -15336},
+		{"radial all", Stick{Radial: M}, M, M, 0, 0},
+		{"radial then pipeline", Stick{Radial: 2000, X: Pipeline{Invert()}}, M, 100, -M, 100},
+		{"pipelines per axis", Stick{X: Pipeline{Scale(50)}, Y: Pipeline{Deadzone(2000)}}, M, 1000, M / 2, 0},
+	}
+	for _, tt := range tests {
+		x, y := tt.stick.Apply(tt.x, tt.y)
+		if x != tt.wantX || y != tt.wantY {
+			t.Errorf("%s: Apply(%d, %d) = (%d, %d), want (%d, %d)",
+				tt.name, tt.x, tt.y, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+// TestMonotonic checks that the response never goes back.
+func TestMonotonic(t *testing.T) {
+	for i, p := range []Pipeline{
+		{Deadzone(2000)},
+		{Expo(30)},
+		{Expo(100)},
+		{Deadzone(1500), Expo(70)},
+		{Curve(0, 2000, 9000, 20000, M)},
+	} {
+		last := p.Apply(-32768)
+		for v := -32768; v <= M; v++ {
+			got := p.Apply(int16(v))
+			if got < last {
+				t.Errorf("pipeline %d: Apply(%d) = %d, after %d", i, v, got, last)
+				break
+			}
+			last = got
+		}
+	}
+}
+
+func TestSqrt(t *testing.T) {
+	for _, v := range []uint32{0, 1, 2, 3, 4, 15, 16, 17, M * M, 2 * M * M, 2 * 32768 * 32768} {
+		r := sqrt(v)
+		if uint64(r)*uint64(r) > uint64(v) || uint64(r+1)*uint64(r+1) <= uint64(v) {
+			t.Errorf("sqrt(%d) = %d", v, r)
+		}
+	}
+}
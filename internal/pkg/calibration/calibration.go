@@ -0,0 +1,159 @@
+// Package calibration maps raw ADC readings of joystick axes to a signed
+// range, from the center, minimum and maximum recorded for every axis.
+//
+// The routine records the center while the stick is held centered (see
+// Recorder.Center), then the extremes while it's swept (Recorder.Sweep).
+// Calibrations are kept in flash, see Load and Save.
+package calibration
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"joystick/pkg/storage"
+)
+
+// Max is the limit of normalized values, -Max to Max. It's the range of
+// protocol axes.
+const Max = 32767
+
+// minSpan is the minimum distance from center to an extreme, 1/16 of
+// the ADC range. A shorter one means the stick wasn't swept.
+const minSpan = 0x1000
+
+var (
+	ErrNotCalibrated = errors.New("calibration: not calibrated")
+	ErrSweep         = errors.New("calibration: extremes too close to center, sweep the stick")
+	ErrCenter        = errors.New("calibration: no center samples")
+)
+
+// Axis is the calibration of one axis, in raw ADC values.
+type Axis struct {
+	Min    uint16
+	Center uint16
+	Max    uint16
+}
+
+// Default is the calibration of an ideal stick over the whole ADC range.
+var Default = Axis{Min: 0, Center: 0x8000, Max: 0xFFFF}
+
+// Valid reports whether both extremes are far enough from the center.
+func (a Axis) Valid() bool {
+	return a.Min < a.Center && a.Center < a.Max &&
+		a.Center-a.Min >= minSpan && a.Max-a.Center >= minSpan
+}
+
+// Normalize returns raw reading as -Max to Max: Min is -Max, Center is 0
+// and Max is Max. Readings out of the extremes are clamped.
+func (a Axis) Normalize(raw uint16) int16 {
+	var v int32
+	switch {
+	case raw < a.Center:
+		v = -scale(a.Center-raw, a.Center-a.Min)
+	case raw > a.Center:
+		v = scale(raw-a.Center, a.Max-a.Center)
+	}
+	return int16(v)
+}
+
+// scale returns d of span as 0 to Max.
+func scale(d, span uint16) int32 {
+	if d >= span {
+		return Max
+	}
+	return int32(uint32(d) * Max / uint32(span))
+}
+
+// Recorder records one axis during the calibration routine.
+type Recorder struct {
+	sum      uint32
+	samples  uint32
+	min, max uint16
+	swept    bool
+}
+
+// Center adds a reading of the stick held centered.
+func (r *Recorder) Center(raw uint16) {
+	r.sum += uint32(raw)
+	r.samples++
+}
+
+// Sweep adds a reading of the stick moved to the extremes.
+func (r *Recorder) Sweep(raw uint16) {
+	if !r.swept {
+		r.min, r.max, r.swept = raw, raw, true
+	}
+	if raw < r.min {
+		r.min = raw
+	}
+	if raw > r.max {
+		r.max = raw
+	}
+}
+
+// Axis returns the calibration: the average of the center readings and
+// the extremes of the sweep.
+func (r *Recorder) Axis() (Axis, error) {
+	if r.samples == 0 {
+		return Axis{}, ErrCenter
+	}
+	a := Axis{
+		Min:    r.min,
+		Center: uint16(r.sum / r.samples),
+		Max:    r.max,
+	}
+	if !a.Valid() {
+		return a, ErrSweep
+	}
+	return a, nil
+}
+
+// axisSize is the size of Axis in flash: min, center, max.
+const axisSize = 6
+
+// magic of the calibration record in flash.
+const magic = 0xCA1B
+
+// Load reads calibrations of axes from erase block number block of dev.
+// Returns ErrNotCalibrated if there are none for len(axes) axes,
+// axes aren't changed then.
+func Load(dev storage.BlockDevice, block int64, axes []Axis) error {
+	if len(axes)*axisSize > storage.MaxData {
+		return storage.ErrTooLarge
+	}
+	var buf [storage.MaxData]byte
+	data := buf[:len(axes)*axisSize]
+	err := storage.Load(dev, block, magic, data)
+	if err == storage.ErrNoRecord {
+		return ErrNotCalibrated
+	}
+	if err != nil {
+		return err
+	}
+	var loaded [storage.MaxData / axisSize]Axis
+	for i := range axes {
+		a := &loaded[i]
+		a.Min = binary.LittleEndian.Uint16(data[i*axisSize:])
+		a.Center = binary.LittleEndian.Uint16(data[i*axisSize+2:])
+		a.Max = binary.LittleEndian.Uint16(data[i*axisSize+4:])
+		if !a.Valid() {
+			return ErrNotCalibrated
+		}
+	}
+	copy(axes, loaded[:len(axes)])
+	return nil
+}
+
+// Save writes calibrations of axes into erase block number block of dev.
+func Save(dev storage.BlockDevice, block int64, axes []Axis) error {
+	if len(axes)*axisSize > storage.MaxData {
+		return storage.ErrTooLarge
+	}
+	var buf [storage.MaxData]byte
+	for i, a := range axes {
+		binary.LittleEndian.PutUint16(buf[i*axisSize:], a.Min)
+		binary.LittleEndian.PutUint16(buf[i*axisSize+2:], a.Center)
+		binary.LittleEndian.PutUint16(buf[i*axisSize+4:], a.Max)
+	}
+	return storage.Save(dev, block, magic, buf[:len(axes)*axisSize])
+}
@@ -0,0 +1,184 @@
+package calibration
+
+import (
+	"math/rand"
+	"testing"
+
+	"joystick/pkg/storage"
+)
+
+const block = 2
+
+// stick is a real stick: off center and not reaching the ADC limits.
+var stick = Axis{Min: 6000, Center: 30000, Max: 61000}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		axis Axis
+		raw  uint16
+		want int16
+	}{
+		{"center", stick, 30000, 0},
+		{"min", stick, 6000, -Max},
+		{"max", stick, 61000, Max},
+		{"below min", stick, 0, -Max},
+		{"just below min", stick, 5999, -Max},
+		{"above max", stick, 0xFFFF, Max},
+		{"just above max", stick, 61001, Max},
+		{"half down", stick, 18000, -Max / 2},
+		{"half up", stick, 45500, Max / 2},
+		{"just above center", stick, 30001, 1},
+		{"just below center", stick, 29999, -1},
+		{"default center", Default, 0x8000, 0},
+		{"default min", Default, 0, -Max},
+		{"default max", Default, 0xFFFF, Max},
+	}
+	for _, tt := range tests {
+		if got := tt.axis.Normalize(tt.raw); got != tt.want {
+			t.Errorf("%s: %+v.Normalize(%d) = %d, want %d", tt.name, tt.axis, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		axis Axis
+		want bool
+	}{
+		{stick, true},
+		{Default, true},
+		{Axis{Min: 0x8000 - minSpan, Center: 0x8000, Max: 0x8000 + minSpan}, true},
+		{Axis{Min: 0x8000 - minSpan + 1, Center: 0x8000, Max: 0xFFFF}, false},
+		{Axis{Min: 0, Center: 0x8000, Max: 0x8000 + minSpan - 1}, false},
+		{Axis{Min: 0xFFFF, Center: 0x8000, Max: 0}, false},
+		{Axis{}, false},
+		{Axis{Min: 0xFFFF, Center: 0xFFFF, Max: 0xFFFF}, false}, // erased flash
+	}
+	for _, tt := range tests {
+		if got := tt.axis.Valid(); got != tt.want {
+			t.Errorf("%+v.Valid() = %v, want %v", tt.axis, got, tt.want)
+		}
+	}
+}
+
+// noisy returns v with ADC noise.
+func noisy(random *rand.Rand, v uint16) uint16 {
+	return v + uint16(random.Intn(64)) - 32
+}
+
+func TestRecorder(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	var r Recorder
+	if _, err := r.Axis(); err != ErrCenter {
+		t.Fatalf("no center: %v, want ErrCenter", err)
+	}
+	// Swept before centered, the center is still missing.
+	r.Sweep(stick.Min)
+	if _, err := r.Axis(); err != ErrCenter {
+		t.Fatalf("sweep without center: %v, want ErrCenter", err)
+	}
+
+	r = Recorder{}
+	for i := 0; i < 200; i++ {
+		r.Center(noisy(random, stick.Center))
+	}
+	if _, err := r.Axis(); err != ErrSweep {
+		t.Fatalf("no sweep: %v, want ErrSweep", err)
+	}
+	for i := 0; i < 50; i++ {
+		r.Sweep(noisy(random, stick.Center+uint16(i*100)))
+	}
+	if _, err := r.Axis(); err != ErrSweep {
+		t.Fatalf("short sweep: %v, want ErrSweep", err)
+	}
+
+	for i := 0; i <= 100; i++ {
+		r.Sweep(noisy(random, stick.Min+uint16(i*int(stick.Max-stick.Min)/100)))
+	}
+	a, err := r.Axis()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff(a.Center, stick.Center) > 16 || diff(a.Min, stick.Min) > 32 || diff(a.Max, stick.Max) > 32 {
+		t.Errorf("recorded %+v, want about %+v", a, stick)
+	}
+	if v := a.Normalize(stick.Center); v < -100 || v > 100 {
+		t.Errorf("center of the stick normalized to %d", v)
+	}
+}
+
+func diff(a, b uint16) uint16 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func TestLoadSave(t *testing.T) {
+	dev := storage.NewMemory(4, 4096)
+	axes := make([]Axis, 4)
+	if err := Load(dev, block, axes); err != ErrNotCalibrated {
+		t.Fatalf("load from empty flash: %v, want ErrNotCalibrated", err)
+	}
+
+	saved := []Axis{stick, Default, stick, Default}
+	err := Save(dev, block, saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Load(dev, block, axes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range axes {
+		if axes[i] != saved[i] {
+			t.Errorf("axis %d: loaded %+v, want %+v", i, axes[i], saved[i])
+		}
+	}
+
+	// Other number of axes, other joystick.
+	two := []Axis{Default, Default}
+	if err := Load(dev, block, two); err != ErrNotCalibrated || two[0] != Default {
+		t.Errorf("load of 2 axes: %v, %+v", err, two)
+	}
+
+	tooMany := make([]Axis, storage.MaxData/axisSize+1)
+	if err := Save(dev, block, tooMany); err != storage.ErrTooLarge {
+		t.Errorf("save of %d axes: %v, want ErrTooLarge", len(tooMany), err)
+	}
+	if err := Load(dev, block, tooMany); err != storage.ErrTooLarge {
+		t.Errorf("load of %d axes: %v, want ErrTooLarge", len(tooMany), err)
+	}
+}
+
+func TestLoadCorrupt(t *testing.T) {
+	dev := storage.NewMemory(4, 4096)
+	err := Save(dev, block, []Axis{stick, stick})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A bit of the center of the second axis is cleared, like a write
+	// cut by a reset. The CRC doesn't match.
+	off := block*dev.EraseBlockSize() + 3 + axisSize + 2
+	var b [1]byte
+	dev.ReadAt(b[:], off)
+	dev.WriteAt([]byte{b[0] &^ 0x10}, off)
+
+	axes := []Axis{Default, Default}
+	if err := Load(dev, block, axes); err != ErrNotCalibrated {
+		t.Errorf("corrupt record: %v, want ErrNotCalibrated", err)
+	}
+	if axes[0] != Default || axes[1] != Default {
+		t.Errorf("axes changed on error: %+v", axes)
+	}
+
+	// A record with a good CRC, but not a calibration.
+	err = Save(dev, block, []Axis{stick, {Min: 100, Center: 200, Max: 300}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(dev, block, axes); err != ErrNotCalibrated || axes[0] != Default {
+		t.Errorf("invalid axis: %v, %+v", err, axes)
+	}
+}
@@ -0,0 +1,124 @@
+// Package arbiter chooses the controller in control of a vehicle that
+// listens to several controllers, one per pipe (see bind.Table).
+//
+// Controllers are told apart by the pipe of their packets, STATUS.RX_P_NO.
+// Every pipe has a priority. A controller with higher priority takes
+// control with the first active command (sticks out of neutral), even if
+// another one is driving: the instructor overrides the student. Control is
+// handed back when the controller in control sends no active command for
+// Config.Takeover: the next active command of another controller takes it.
+// Control is free when the controller in control sends nothing for
+// Config.Timeout. Commands of the controllers not in control are ignored.
+//
+// Time is read from failsafe.Clock, tests can use a fake one.
+package arbiter
+
+import (
+	"time"
+
+	"joystick/pkg/failsafe"
+)
+
+// MaxPipes is the number of pipes of the radio.
+const MaxPipes = 6
+
+// None is Owner without controller in control.
+const None = 0xFF
+
+// Config of the arbiter. Zero fields take defaults.
+type Config struct {
+	// Priority of the controller of every pipe, higher wins.
+	Priority [MaxPipes]byte
+
+	// Takeover is the time without active commands after which the
+	// controller in control hands it back. Default 2s.
+	Takeover time.Duration
+
+	// Timeout without packets after which the controller in control
+	// loses it. Default 500ms.
+	Timeout time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Takeover == 0 {
+		c.Takeover = 2 * time.Second
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 500 * time.Millisecond
+	}
+	return c
+}
+
+// Arbiter tracks the controller in control.
+type Arbiter struct {
+	config Config
+	clock  failsafe.Clock
+
+	owner  byte
+	since  time.Time // owner got control
+	last   [MaxPipes]time.Time
+	active [MaxPipes]time.Time // last active command
+}
+
+// New returns arbiter without controller in control.
+// clock - nil for failsafe.SystemClock.
+func New(config Config, clock failsafe.Clock) *Arbiter {
+	if clock == nil {
+		clock = failsafe.SystemClock
+	}
+	return &Arbiter{
+		config: config.withDefaults(),
+		clock:  clock,
+		owner:  None,
+	}
+}
+
+// Owner returns the pipe in control, None if there is none.
+func (a *Arbiter) Owner() byte {
+	if a.owner != None && a.clock.Now().Sub(a.last[a.owner]) > a.config.Timeout {
+		a.owner = None
+	}
+	return a.owner
+}
+
+// Packet registers a valid packet from pipe, active - its sticks are out
+// of neutral. Returns true if the command of the packet must be executed,
+// its controller has control.
+func (a *Arbiter) Packet(pipe byte, active bool) bool {
+	if pipe >= MaxPipes {
+		return false
+	}
+	now := a.clock.Now()
+	a.last[pipe] = now
+	if active {
+		a.active[pipe] = now
+	}
+
+	owner := a.Owner()
+	switch {
+	case owner == pipe:
+	case owner == None:
+		a.take(pipe, now)
+	case active && a.config.Priority[pipe] > a.config.Priority[owner]:
+		// Override.
+		a.take(pipe, now)
+	case active && a.idle(owner, now):
+		// Hand back.
+		a.take(pipe, now)
+	}
+	return a.owner == pipe
+}
+
+// idle reports whether the owner sent no active command for Takeover.
+func (a *Arbiter) idle(owner byte, now time.Time) bool {
+	last := a.active[owner]
+	if a.since.After(last) {
+		last = a.since
+	}
+	return now.Sub(last) > a.config.Takeover
+}
+
+func (a *Arbiter) take(pipe byte, now time.Time) {
+	a.owner = pipe
+	a.since = now
+}
@@ -0,0 +1,316 @@
+package arbiter
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"joystick/pkg/bind"
+	"joystick/pkg/failsafe/failsafetest"
+	"joystick/pkg/link"
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/protocol"
+)
+
+const (
+	student    = 0 // pipes
+	instructor = 1
+
+	takeover = 100 * time.Millisecond
+	timeout  = 50 * time.Millisecond
+)
+
+var testConfig = Config{
+	Priority: [MaxPipes]byte{instructor: 1},
+	Takeover: takeover,
+	Timeout:  timeout,
+}
+
+// step is one packet: after the time passes, it comes from pipe.
+type step struct {
+	name   string
+	after  time.Duration
+	pipe   byte
+	active bool
+	owner  byte // want: owner after the packet
+}
+
+func run(t *testing.T, config Config, steps []step) (*Arbiter, *failsafetest.Clock) {
+	t.Helper()
+	clock := failsafetest.NewClock()
+	a := New(config, clock)
+	if a.Owner() != None {
+		t.Fatalf("owner %d at start", a.Owner())
+	}
+	for _, s := range steps {
+		clock.Advance(s.after)
+		execute := a.Packet(s.pipe, s.active)
+		if got := a.Owner(); got != s.owner || execute != (s.owner == s.pipe) {
+			t.Errorf("%s: owner %d, executed %v, want owner %d", s.name, got, execute, s.owner)
+		}
+	}
+	return a, clock
+}
+
+func TestRules(t *testing.T) {
+	a, clock := run(t, testConfig, []step{
+		{"student takes free control", 0, student, false, student},
+		{"student drives", 10 * time.Millisecond, student, true, student},
+		{"instructor in neutral", 10 * time.Millisecond, instructor, false, student},
+		{"instructor overrides", 10 * time.Millisecond, instructor, true, instructor},
+		{"student is ignored", 10 * time.Millisecond, student, true, instructor},
+		{"instructor stops", 10 * time.Millisecond, instructor, false, instructor},
+		{"before takeover", 40 * time.Millisecond, student, true, instructor},
+		{"instructor keeps the link", 40 * time.Millisecond, instructor, false, instructor},
+		{"hand back", 30 * time.Millisecond, student, true, student},
+		{"idle student keeps control", 40 * time.Millisecond, student, false, student},
+		{"student lost, control is free", 120 * time.Millisecond, instructor, false, instructor},
+		{"student back before takeover", 10 * time.Millisecond, student, true, instructor},
+	})
+	clock.Advance(timeout + time.Millisecond)
+	if a.Owner() != None {
+		t.Errorf("owner %d after timeout, want none", a.Owner())
+	}
+}
+
+func TestPriority(t *testing.T) {
+	config := testConfig
+	config.Priority = [MaxPipes]byte{0: 1, 1: 2, 2: 2, 3: 0, 4: 1}
+	run(t, config, []step{
+		{"low priority takes free control", 0, 0, true, 0},
+		{"equal priority doesn't override", time.Millisecond, 4, true, 0},
+		{"lower priority doesn't override", time.Millisecond, 3, true, 0},
+		{"higher priority in neutral waits", time.Millisecond, 1, false, 0},
+		{"higher priority overrides", time.Millisecond, 1, true, 1},
+		{"the same priority doesn't override", time.Millisecond, 2, true, 1},
+		{"the first one is ignored", time.Millisecond, 0, true, 1},
+	})
+}
+
+func TestTakeover(t *testing.T) {
+	ms := time.Millisecond
+	run(t, testConfig, []step{
+		{"instructor takes control in neutral", 0, instructor, false, instructor},
+		// Takeover counts from the time the instructor got control.
+		{"student right after", 40 * ms, student, true, instructor},
+		{"instructor keeps the link", 40 * ms, instructor, false, instructor},
+		{"student after takeover", 30 * ms, student, true, student},
+		{"instructor overrides again", ms, instructor, true, instructor},
+		// Active commands of the owner keep control.
+		{"instructor drives", 40 * ms, instructor, true, instructor},
+		{"instructor stops", 40 * ms, instructor, false, instructor},
+		{"instructor keeps the link", 40 * ms, instructor, false, instructor},
+		{"student at the takeover", 20 * ms, student, true, instructor},
+		{"student in neutral after takeover", ms, student, false, instructor},
+		{"student after takeover", ms, student, true, student},
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	a, clock := run(t, testConfig, []step{
+		{"student takes control", 0, student, true, student},
+		// Packets in neutral keep the link.
+		{"student in neutral", timeout, student, false, student},
+		{"student at the timeout", timeout, student, false, student},
+	})
+	clock.Advance(timeout)
+	if a.Owner() != student {
+		t.Errorf("owner %d at the timeout, want student", a.Owner())
+	}
+	clock.Advance(time.Millisecond)
+	if a.Owner() != None {
+		t.Errorf("owner %d after the timeout, want none", a.Owner())
+	}
+	// Free control goes to anybody, with the lowest priority and in neutral.
+	if !a.Packet(student, false) || a.Owner() != student {
+		t.Errorf("student didn't get free control, owner %d", a.Owner())
+	}
+}
+
+// TestPacketPeriod runs the timing of the joystick: a packet every 150ms,
+// plus up to 100ms waiting for the ACK.
+func TestPacketPeriod(t *testing.T) {
+	const period = 250 * time.Millisecond
+	config := Config{
+		Priority: [MaxPipes]byte{instructor: 1},
+		Takeover: 2 * time.Second,
+		Timeout:  3 * period,
+	}
+	tests := []struct {
+		name       string
+		instructor func(i int) bool // the packet i of the instructor arrives
+		lost       time.Duration    // want: the student gets control after it
+	}{
+		{"every packet", func(i int) bool { return true }, 0},
+		{"every other packet lost", func(i int) bool { return i%2 == 0 }, 0},
+		{"2 packets in a row lost", func(i int) bool { return i%3 == 0 }, 0},
+		{"instructor lost", func(i int) bool { return i <= 2 }, 2*period + config.Timeout},
+	}
+	for _, tt := range tests {
+		clock := failsafetest.NewClock()
+		a := New(config, clock)
+		a.Packet(instructor, true)
+		// The instructor holds neutral, the student drives, until the takeover.
+		for now := 10 * time.Millisecond; now < config.Takeover; now += 10 * time.Millisecond {
+			clock.Advance(10 * time.Millisecond)
+			if now%period == 0 && tt.instructor(int(now/period)) {
+				a.Packet(instructor, false)
+			}
+			if now%(150*time.Millisecond) == 0 {
+				a.Packet(student, true)
+			}
+			want := byte(instructor)
+			switch {
+			case tt.lost == 0 || now <= tt.lost:
+			case now > tt.lost+150*time.Millisecond:
+				// At the next packet of the student.
+				want = student
+			default:
+				continue
+			}
+			if a.Owner() != want {
+				t.Errorf("%s: at %v owner %d, want %d", tt.name, now, a.Owner(), want)
+				break
+			}
+		}
+	}
+}
+
+func TestInvalidPipe(t *testing.T) {
+	a := New(testConfig, failsafetest.NewClock())
+	if a.Packet(MaxPipes, true) || a.Owner() != None {
+		t.Errorf("pipe %d got control", MaxPipes)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	a := New(Config{}, nil)
+	if a.config.Takeover != 2*time.Second || a.config.Timeout != 500*time.Millisecond {
+		t.Errorf("defaults %+v", a.config)
+	}
+}
+
+// TestRadios runs a student and an instructor on emulated radios. The
+// vehicle tells them apart by the pipe and reports the ID of the owner
+// in telemetry.
+func TestRadios(t *testing.T) {
+	air := emulator.NewAir()
+	source := rand.New(rand.NewSource(1))
+	random := func() (uint32, error) { return source.Uint32(), nil }
+	var bindings bind.Table
+	b, err := bind.Generate(random, 0x33, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pipe := byte(0); pipe < 2; pipe++ {
+		cb, err := b.ForPipe(pipe, random)
+		if err == nil {
+			// Every controller has its own ID, taken at its first bind.
+			cb.Controller, err = bind.NewID(random)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bindings.Add(cb)
+	}
+	if bindings.Bindings[0].Controller == bindings.Bindings[1].Controller {
+		t.Fatalf("both controllers have ID %d", bindings.Bindings[0].Controller)
+	}
+
+	vehicleConfig := emutest.Config(b.Address[:])
+	bindings.SetPipes(&vehicleConfig)
+	vehicle := link.NewReceiver(emutest.Radio(t, air, "vehicle", vehicleConfig), link.Config{
+		Rendezvous: b.Channel,
+		Pipes:      bindings.Pipes(),
+	})
+	err = vehicle.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var controllers [2]*link.Controller
+	for i, cb := range bindings.List() {
+		nrf := emutest.Radio(t, air, [2]string{"student", "instructor"}[i], emutest.Config(cb.Address[:]))
+		controllers[i] = link.NewController(nrf, link.Config{Rendezvous: cb.Channel, SendTimeout: 5 * time.Millisecond})
+		err = controllers[i].Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock := failsafetest.NewClock()
+	a := New(testConfig, clock)
+	tests := []struct {
+		name   string
+		steps  int // of 1ms, every controller that sends sends a packet
+		send   [2]bool
+		active [2]bool
+		owner  byte
+	}{
+		{"student drives", 60, [2]bool{true, false}, [2]bool{true, false}, student},
+		{"instructor joins", 60, [2]bool{true, true}, [2]bool{true, false}, student},
+		{"instructor overrides", 60, [2]bool{true, true}, [2]bool{true, true}, instructor},
+		{"hand back", 300, [2]bool{true, true}, [2]bool{true, false}, student},
+		{"student lost", 150, [2]bool{false, true}, [2]bool{false, false}, instructor},
+	}
+	var msg [protocol.Size]byte
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	for _, tt := range tests {
+		reported := byte(0)
+		for step := 0; step < tt.steps; step++ {
+			clock.Advance(time.Millisecond)
+			for i, c := range controllers {
+				if !tt.send[i] {
+					continue
+				}
+				packet := protocol.Packet{Type: protocol.TypeControl, Sender: bindings.Bindings[i].Controller}
+				if tt.active[i] {
+					packet.Axes[protocol.AxisLeftX] = 10000
+				}
+				n, _ := packet.Marshal(msg[:])
+				_, err = c.Send(msg[:n])
+				if err != nil && err != link.ErrNotLinked && err != nrf24l01.ErrMaxRetries {
+					t.Fatal(err)
+				}
+				var telemetry protocol.Telemetry
+				if n, ok := c.ReadReply(buf[:]); ok && telemetry.Unmarshal(buf[:n]) == nil {
+					reported = telemetry.Control
+				}
+				receive(t, vehicle, a, &bindings)
+			}
+		}
+		owner := a.Owner()
+		if owner != tt.owner || reported != bindings.Bindings[tt.owner].Controller {
+			t.Errorf("%s: owner pipe %d, reported controller %d, want pipe %d, controller %d",
+				tt.name, owner, reported, tt.owner, bindings.Bindings[tt.owner].Controller)
+		}
+	}
+}
+
+// receive is the vehicle: it reads all packets and replies with the ID of
+// the controller in control.
+func receive(t *testing.T, vehicle *link.Receiver, a *Arbiter, bindings *bind.Table) {
+	t.Helper()
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	var packet protocol.Packet
+	for {
+		pipe, n, ok, err := vehicle.ReceiveFrom(buf[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return
+		}
+		if packet.Unmarshal(buf[:n]) != nil || packet.Sender != bindings.Bindings[pipe].Controller {
+			t.Fatalf("packet %x from pipe %d", buf[:n], pipe)
+		}
+		a.Packet(pipe, !packet.Neutral(1000))
+		telemetry := protocol.Telemetry{Sender: bindings.Bindings[pipe].Vehicle, Target: packet.Sender, Control: protocol.Broadcast}
+		if owner := a.Owner(); owner != None {
+			telemetry.Control = bindings.Bindings[owner].Controller
+		}
+		n, _ = telemetry.Marshal(buf[:])
+		vehicle.Reply(buf[:n])
+	}
+}
@@ -0,0 +1,302 @@
+// Package bind pairs a controller with a vehicle.
+//
+// In bind mode both sides meet on the well-known bind channel and address.
+// The vehicle generates a random binding (pipe address, rendezvous channel
+// and hop seed) and offers it with its ID in the ACK payload of the
+// controller's request, the request has the ID of the controller. The
+// controller confirms it and both save it in flash. From then on they use
+// the address of the binding, other controllers aren't heard, and the
+// vehicle accepts only packets from the bound controller ID. Every unit
+// takes a random ID at its first bind, see NewID.
+//
+// A controller keeps bindings of up to six vehicles and sends to one of
+// them at a time. A vehicle keeps up to six controllers, one per pipe:
+// the binding of pipe n is the first one with the address of the pipe
+// (see ForPipe) and its own key, on the same channel.
+//
+// Radio setup is the same as for the link package: auto-ack, dynamic
+// payload length and ACK payloads on pipe 0, address width 5. After bind
+// apply the radio config again with Binding.Address.
+package bind
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/storage"
+)
+
+const (
+	// Channel is the bind channel.
+	Channel = 2
+
+	// AddressWidth of bound addresses.
+	AddressWidth = 5
+)
+
+// Address is the well-known bind address, LSByte first.
+var Address = [AddressWidth]byte{'B', 'I', 'N', 'D', '0'}
+
+var (
+	ErrTimeout  = errors.New("bind: no peer in bind mode")
+	ErrNotBound = errors.New("bind: not bound")
+	ErrFull     = errors.New("bind: no room for another binding")
+)
+
+// KeySize is the size of the pre-shared key.
+const KeySize = 16
+
+// Binding flags.
+const (
+	FlagAuth = 1 << 0 // packets are authenticated with Key, see protocol.Auth
+	FlagSeal = 1 << 1 // packets are encrypted and authenticated, see protocol.Cipher
+)
+
+// Binding is the result of bind, the same on both sides.
+type Binding struct {
+	Address    [AddressWidth]byte // pipe address, LSByte first
+	Channel    byte               // rendezvous channel of the link
+	Seed       uint32             // seed of the hop table
+	Controller byte               // ID of the controller
+	Vehicle    byte               // ID of the vehicle, target of the packets
+	Flags      byte               // options of the link chosen by the vehicle
+	Key        [KeySize]byte      // pre-shared key
+}
+
+// Auth reports whether packets of the link are authenticated only.
+func (b *Binding) Auth() bool {
+	return b.Flags&(FlagAuth|FlagSeal) == FlagAuth
+}
+
+// Sealed reports whether packets of the link are encrypted.
+func (b *Binding) Sealed() bool {
+	return b.Flags&FlagSeal != 0
+}
+
+// Generate returns a new binding of pipe 0 from random, without Controller.
+// random - source of random numbers, machine.GetRNG on the device. Its
+// error is returned, there is no fallback to a guessable source.
+// vehicle - ID of the vehicle.
+// flags - FlagAuth or FlagSeal.
+//
+// The key is sent in the clear during bind, bind where nobody listens.
+func Generate(random func() (uint32, error), vehicle, flags byte) (Binding, error) {
+	s := source{random: random}
+	b := Binding{Vehicle: vehicle, Flags: flags}
+	// LSByte differs between pipes, it must be good for all of them.
+	b.Address[0] = s.addressByte(nrf24l01.MaxPipe)
+	for i := 1; i < AddressWidth; i++ {
+		b.Address[i] = s.addressByte(0)
+	}
+	b.Channel = Channel
+	for b.Channel == Channel && s.err == nil {
+		b.Channel = byte(s.next() % (nrf24l01.MaxChannel + 1))
+	}
+	b.Seed = s.next()
+	s.key(&b.Key)
+	if s.err != nil {
+		return Binding{}, s.err
+	}
+	return b, nil
+}
+
+// NewID returns a random ID of a controller or a vehicle, from 1 to
+// 0xFE: 0 is the ID of units before bind and 0xFF is protocol.Broadcast.
+// A unit takes it at the first bind and keeps it in its bindings, the
+// peer learns it in bind.
+func NewID(random func() (uint32, error)) (byte, error) {
+	s := source{random: random}
+	for s.err == nil {
+		id := byte(s.next())
+		if id != 0 && id != 0xFF {
+			return id, nil
+		}
+	}
+	return 0, s.err
+}
+
+// ForPipe returns the binding of pipe of the vehicle, b is the binding of
+// pipe 0. It has the address of the pipe and a new key from random, the
+// link is the same. Controllers of different pipes have different keys, so
+// they never share a counter of protocol.Auth or protocol.Cipher.
+func (b *Binding) ForPipe(pipe byte, random func() (uint32, error)) (Binding, error) {
+	s := source{random: random}
+	p := *b
+	p.Address[0] += pipe
+	p.Controller = 0
+	s.key(&p.Key)
+	if s.err != nil {
+		return Binding{}, s.err
+	}
+	return p, nil
+}
+
+// source reads random numbers and keeps the first error, after it
+// every number is 0.
+type source struct {
+	random func() (uint32, error)
+	err    error
+}
+
+func (s *source) next() uint32 {
+	if s.err != nil {
+		return 0
+	}
+	n, err := s.random()
+	if err != nil {
+		s.err = err
+		return 0
+	}
+	return n
+}
+
+func (s *source) key(key *[KeySize]byte) {
+	for i := 0; i < KeySize; i += 4 {
+		binary.LittleEndian.PutUint32(key[i:], s.next())
+	}
+}
+
+// addressByte returns a random address byte b such that b to b+next are
+// good. Bytes like 0x00, 0xFF, 0x55 and 0xAA look like noise or
+// the preamble and are skipped. Specs p.25.
+func (s *source) addressByte(next int) byte {
+	for s.err == nil {
+		b := byte(s.next())
+		if int(b)+next <= 0xFF && goodAddressBytes(b, next) {
+			return b
+		}
+	}
+	return 0
+}
+
+func goodAddressBytes(b byte, next int) bool {
+	for i := 0; i <= next; i++ {
+		switch b + byte(i) {
+		case 0x00, 0xFF, 0x55, 0xAA:
+			return false
+		}
+	}
+	return true
+}
+
+// Binding record: address, channel, seed, controller, vehicle, flags, key.
+// It's sent in bind frames too, with 2 bytes of header it fits in a payload.
+const bindingSize = AddressWidth + 1 + 4 + 1 + 1 + 1 + KeySize
+
+func (b *Binding) marshal(buf []byte) []byte {
+	n := copy(buf, b.Address[:])
+	buf[n] = b.Channel
+	binary.LittleEndian.PutUint32(buf[n+1:], b.Seed)
+	buf[n+5] = b.Controller
+	buf[n+6] = b.Vehicle
+	buf[n+7] = b.Flags
+	copy(buf[n+8:], b.Key[:])
+	return buf[:bindingSize]
+}
+
+func (b *Binding) unmarshal(data []byte) {
+	n := copy(b.Address[:], data)
+	b.Channel = data[n]
+	b.Seed = binary.LittleEndian.Uint32(data[n+1:])
+	b.Controller = data[n+5]
+	b.Vehicle = data[n+6]
+	b.Flags = data[n+7]
+	copy(b.Key[:], data[n+8:])
+}
+
+// MaxBindings is the size of Table: vehicles of a controller, or
+// controllers of a vehicle, one per pipe.
+const MaxBindings = nrf24l01.MaxPipe + 1
+
+// Table is the set of bindings kept in flash.
+// On the vehicle the index of a binding is its pipe.
+type Table struct {
+	Bindings [MaxBindings]Binding
+	Len      int
+}
+
+// List returns the bindings of the table.
+func (t *Table) List() []Binding {
+	return t.Bindings[:t.Len]
+}
+
+// Add adds b or replaces the binding with the same address.
+// Returns the index of b, ErrFull if there is no room.
+func (t *Table) Add(b Binding) (int, error) {
+	for i := range t.List() {
+		if t.Bindings[i].Address == b.Address {
+			t.Bindings[i] = b
+			return i, nil
+		}
+	}
+	if t.Len == MaxBindings {
+		return 0, ErrFull
+	}
+	t.Bindings[t.Len] = b
+	t.Len++
+	return t.Len - 1, nil
+}
+
+// SetPipes enables a pipe of config for every binding of the vehicle,
+// with the setup of pipe 0. Pipes 2 to 5 get only the LSByte.
+func (t *Table) SetPipes(config *nrf24l01.Config) {
+	for i := range t.List() {
+		pipe := config.Pipes[0]
+		pipe.Enabled = true
+		pipe.Address = t.Bindings[i].Address[:]
+		if i >= 2 {
+			pipe.Address = pipe.Address[:1]
+		}
+		config.Pipes[i] = pipe
+	}
+}
+
+// Pipes returns the pipes of the vehicle, see link.Config.Pipes.
+func (t *Table) Pipes() []byte {
+	pipes := make([]byte, t.Len)
+	for i := range pipes {
+		pipes[i] = byte(i)
+	}
+	return pipes
+}
+
+// magic of the table record in flash.
+const magic = 0xB17E
+
+// Load reads the table from erase block number block of dev.
+// Returns ErrNotBound if there is none.
+func Load(dev storage.BlockDevice, block int64) (Table, error) {
+	var t Table
+	var buf [1 + MaxBindings*bindingSize]byte
+	err := storage.Load(dev, block, magic, buf[:])
+	if err == storage.ErrNoRecord {
+		return t, ErrNotBound
+	}
+	if err != nil {
+		return t, err
+	}
+	if buf[0] == 0 || buf[0] > MaxBindings {
+		return t, ErrNotBound
+	}
+	t.Len = int(buf[0])
+	for i := range t.List() {
+		t.Bindings[i].unmarshal(buf[1+i*bindingSize:])
+	}
+	return t, nil
+}
+
+// Save writes the table into erase block number block of dev.
+func Save(dev storage.BlockDevice, block int64, t *Table) error {
+	var buf [1 + MaxBindings*bindingSize]byte
+	buf[0] = byte(t.Len)
+	for i := range t.List() {
+		t.Bindings[i].marshal(buf[1+i*bindingSize:])
+	}
+	return storage.Save(dev, block, magic, buf[:])
+}
+
+// Unbind erases the table from block of dev.
+func Unbind(dev storage.BlockDevice, block int64) error {
+	return storage.Erase(dev, block)
+}
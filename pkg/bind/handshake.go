@@ -0,0 +1,213 @@
+package bind
+
+import (
+	"errors"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// Bind frames: magic, kind, data.
+//
+//	request - controller ID
+//	offer   - binding, in ACK payload
+//	confirm - binding with controller ID
+const (
+	frameMagic = 0xB1
+
+	frameRequest = 1
+	frameOffer   = 2
+	frameConfirm = 3
+)
+
+const (
+	// Receiving of the vehicle is polled.
+	poll = time.Millisecond
+
+	// linger is the time the vehicle stays in bind mode after the confirm.
+	// The ACK of the confirm may be lost, the controller sends it again.
+	linger = 200 * time.Millisecond
+)
+
+func request(controller byte) []byte {
+	return []byte{frameMagic, frameRequest, controller}
+}
+
+func frame(kind byte, b *Binding) []byte {
+	buf := make([]byte, 2+bindingSize)
+	buf[0], buf[1] = frameMagic, kind
+	b.marshal(buf[2:])
+	return buf
+}
+
+// parseFrame returns kind of the frame and the binding in it.
+// ok is false for other payloads.
+func parseFrame(data []byte) (kind byte, b Binding, ok bool) {
+	if len(data) < 2 || data[0] != frameMagic {
+		return 0, b, false
+	}
+	kind = data[1]
+	switch {
+	case kind == frameRequest && len(data) == 3:
+		b.Controller = data[2]
+	case (kind == frameOffer || kind == frameConfirm) && len(data) == 2+bindingSize:
+		b.unmarshal(data[2:])
+	default:
+		return 0, b, false
+	}
+	return kind, b, true
+}
+
+// Accept is bind mode of the vehicle. It offers binding b (see Generate)
+// on the bind channel and waits up to timeout for a controller to confirm
+// it. Returns b with the controller ID.
+//
+// The radio is left in RX mode on the bind channel.
+func Accept(nrf *nrf24l01.Device, b Binding, timeout time.Duration) (Binding, error) {
+	err := tune(nrf)
+	if err != nil {
+		return b, err
+	}
+	err = nrf.SetRXMode()
+	if err != nil {
+		return b, err
+	}
+	err = nrf.WriteAckPayload(0, frame(frameOffer, &b))
+	if err != nil {
+		return b, err
+	}
+
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	var confirmed time.Time
+	deadline := time.Now().Add(timeout)
+	for {
+		now := time.Now()
+		if !confirmed.IsZero() && now.Sub(confirmed) > linger {
+			return b, nil
+		}
+		if confirmed.IsZero() && now.After(deadline) {
+			return b, ErrTimeout
+		}
+
+		_, n, ok, err := nrf.Receive(buf[:])
+		if err != nil {
+			return b, err
+		}
+		if !ok {
+			time.Sleep(poll)
+			continue
+		}
+
+		kind, got, ok := parseFrame(buf[:n])
+		if !ok {
+			continue
+		}
+		switch kind {
+		case frameRequest:
+			// The offer was sent with ACK, load it for the next request.
+			fifo, err := nrf.GetFIFOStatus()
+			if err != nil {
+				return b, err
+			}
+			if fifo.TXEmpty() {
+				err = nrf.WriteAckPayload(0, frame(frameOffer, &b))
+				if err != nil {
+					return b, err
+				}
+			}
+		case frameConfirm:
+			controller := got.Controller
+			got.Controller = b.Controller
+			if got != b || !confirmed.IsZero() {
+				continue
+			}
+			b.Controller = controller
+			confirmed = time.Now()
+		}
+	}
+}
+
+// Request is bind mode of the controller with ID controller. It asks
+// a vehicle in bind mode for a binding and confirms it, trying up to
+// timeout. sendTimeout - timeout of one packet.
+//
+// The radio is left in TX mode on the bind channel.
+func Request(nrf *nrf24l01.Device, controller byte, timeout, sendTimeout time.Duration) (Binding, error) {
+	var b Binding
+	err := tune(nrf)
+	if err != nil {
+		return b, err
+	}
+	err = nrf.SetTXMode()
+	if err != nil {
+		return b, err
+	}
+
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	offered := false
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if !offered {
+			res, err := nrf.Send(sendTimeout, request(controller))
+			if err = lost(err); err != nil {
+				return b, err
+			}
+			if !res.AckPayload {
+				continue
+			}
+			_, n, ok, err := nrf.Receive(buf[:])
+			if err != nil {
+				return b, err
+			}
+			if !ok {
+				continue
+			}
+			kind, got, ok := parseFrame(buf[:n])
+			if !ok || kind != frameOffer || got.Channel > nrf24l01.MaxChannel {
+				continue
+			}
+			b = got
+			b.Controller = controller
+			offered = true
+		}
+
+		res, err := nrf.Send(sendTimeout, frame(frameConfirm, &b))
+		if err = lost(err); err != nil {
+			return b, err
+		}
+		if res.Delivered {
+			return b, nil
+		}
+	}
+	return Binding{}, ErrTimeout
+}
+
+// lost drops errors of a packet not getting through, it's sent again.
+func lost(err error) error {
+	if errors.Is(err, nrf24l01.ErrMaxRetries) || errors.Is(err, nrf24l01.ErrTimeout) {
+		return nil
+	}
+	return err
+}
+
+// tune switches the radio to the bind channel and address.
+func tune(nrf *nrf24l01.Device) error {
+	nrf.Disable()
+	err := nrf.FlushTX()
+	if err != nil {
+		return err
+	}
+	err = nrf.FlushRX()
+	if err != nil {
+		return err
+	}
+	err = nrf.SetRFChannel(Channel)
+	if err != nil {
+		return err
+	}
+	err = nrf.SetFullPipeRXAddress(0, Address[:])
+	if err != nil {
+		return err
+	}
+	return nrf.SetTXAddress(Address[:])
+}
@@ -0,0 +1,340 @@
+package bind
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/storage"
+)
+
+const (
+	testController = 7
+	testVehicle    = 3
+	block          = 0
+	timeout        = time.Second
+	sendTimeout    = 10 * time.Millisecond
+)
+
+var defaultAddress = []byte("JSTK0")
+
+func random() (uint32, error) {
+	return rand.Uint32(), nil
+}
+
+func generate(t *testing.T, vehicle, flags byte) Binding {
+	t.Helper()
+	b, err := Generate(random, vehicle, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func forPipe(t *testing.T, b Binding, pipe byte) Binding {
+	t.Helper()
+	p, err := b.ForPipe(pipe, random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// pair runs bind mode of the vehicle with offer and of the controller id.
+func pair(t *testing.T, vehicle, controller *nrf24l01.Device, id byte, offer Binding) (vb, cb Binding) {
+	t.Helper()
+	accepted := make(chan error, 1)
+	go func() {
+		var err error
+		vb, err = Accept(vehicle, offer, timeout)
+		accepted <- err
+	}()
+
+	cb, err := Request(controller, id, timeout, sendTimeout)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	err = <-accepted
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	return vb, cb
+}
+
+// use applies the address and the channel of b, in mode tx or rx.
+func use(t *testing.T, nrf *nrf24l01.Device, b Binding, config nrf24l01.Config, tx bool) {
+	t.Helper()
+	err := nrf.Apply(config)
+	if err == nil {
+		err = nrf.SetRFChannel(b.Channel)
+	}
+	if err == nil && tx {
+		err = nrf.SetTXMode()
+	}
+	if err == nil && !tx {
+		err = nrf.SetRXMode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	air := emulator.NewAir()
+	// Some packets and ACKs are lost, bind sends them again.
+	drops := rand.New(rand.NewSource(1))
+	air.Drop = func(from, to *emulator.Chip) bool {
+		return drops.Intn(4) == 0
+	}
+	vehicle := emutest.Radio(t, air, "vehicle", emutest.Config(defaultAddress))
+	controller := emutest.Radio(t, air, "controller", emutest.Config(defaultAddress))
+	vehicleFlash := storage.NewMemory(4, 4096)
+	controllerFlash := storage.NewMemory(4, 4096)
+
+	_, err := Load(vehicleFlash, block)
+	if err != ErrNotBound {
+		t.Fatalf("load from empty flash: %v", err)
+	}
+
+	vb, cb := pair(t, vehicle, controller, testController, generate(t, testVehicle, FlagAuth))
+	if vb != cb || vb.Controller != testController || vb.Vehicle != testVehicle || !vb.Auth() {
+		t.Fatalf("vehicle %+v, controller %+v", vb, cb)
+	}
+	var vt, ct Table
+	vt.Add(vb)
+	ct.Add(cb)
+	err = Save(vehicleFlash, block, &vt)
+	if err == nil {
+		err = Save(controllerFlash, block, &ct)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart the binding is read from flash.
+	vt, err = Load(vehicleFlash, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err = Load(controllerFlash, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vt.Len != 1 || ct.Len != 1 || vt.Bindings[0] != ct.Bindings[0] {
+		t.Fatalf("loaded vehicle %+v, controller %+v", vt, ct)
+	}
+
+	// The second controller gets pipe 1: the same link, another key.
+	backup := emutest.Radio(t, air, "backup", emutest.Config(defaultAddress))
+	bb, _ := pair(t, vehicle, backup, testController+1, forPipe(t, vb, 1))
+	pipe, err := vt.Add(bb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipe != 1 || bb.Vehicle != testVehicle || bb.Controller != testController+1 ||
+		bb.Channel != vb.Channel || bb.Seed != vb.Seed || bb.Key == vb.Key ||
+		bb.Address[0] != vb.Address[0]+1 || string(bb.Address[1:]) != string(vb.Address[1:]) {
+		t.Errorf("binding of pipe %d %+v isn't derived from pipe 0 %+v", pipe, bb, vb)
+	}
+
+	// Only bound controllers reach the vehicle.
+	air.Drop = nil
+	vehicleConfig := emutest.Config(vb.Address[:])
+	vt.SetPipes(&vehicleConfig)
+	use(t, vehicle, vb, vehicleConfig, false)
+	use(t, controller, cb, emutest.Config(cb.Address[:]), true)
+	use(t, backup, bb, emutest.Config(bb.Address[:]), true)
+	intruder := emutest.Radio(t, air, "intruder", emutest.Config(defaultAddress))
+	use(t, intruder, vb, emutest.Config(defaultAddress), true)
+
+	for _, nrf := range []*nrf24l01.Device{controller, backup} {
+		res, err := nrf.Send(sendTimeout, []byte("bound"))
+		if !res.Delivered {
+			t.Fatalf("bound controller: %v", err)
+		}
+	}
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	for _, want := range []int{0, 1} {
+		got, _, ok, _ := vehicle.Receive(buf[:])
+		if !ok || got != want {
+			t.Errorf("payload on pipe %d, want %d", got, want)
+		}
+	}
+	res, _ := intruder.Send(sendTimeout, []byte("intruder"))
+	if res.Delivered {
+		t.Errorf("intruder reached the vehicle")
+	}
+
+	err = Unbind(vehicleFlash, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Load(vehicleFlash, block)
+	if err != ErrNotBound {
+		t.Errorf("load after unbind: %v", err)
+	}
+}
+
+func TestRejectConfirm(t *testing.T) {
+	air := emulator.NewAir()
+	vehicle := emutest.Radio(t, air, "vehicle", emutest.Config(defaultAddress))
+	forger := emutest.Radio(t, air, "forger", emutest.Config(defaultAddress))
+
+	offer := generate(t, testVehicle, FlagAuth)
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := Accept(vehicle, offer, 100*time.Millisecond)
+		accepted <- err
+	}()
+
+	// A confirm of another binding, e.g. with a key of the forger.
+	err := tune(forger)
+	if err == nil {
+		err = forger.SetTXMode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := offer
+	forged.Key[0] ^= 1
+	forged.Controller = testController
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		forger.Send(sendTimeout, frame(frameConfirm, &forged))
+		forger.FlushRX()
+		time.Sleep(time.Millisecond)
+	}
+	if err = <-accepted; err != ErrTimeout {
+		t.Errorf("forged confirm: %v, want ErrTimeout", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	air := emulator.NewAir()
+	nrf := emutest.Radio(t, air, "alone", emutest.Config(defaultAddress))
+
+	start := time.Now()
+	_, err := Request(nrf, testController, 30*time.Millisecond, sendTimeout)
+	if err != ErrTimeout {
+		t.Errorf("request without vehicle: %v, want ErrTimeout", err)
+	}
+	_, err = Accept(nrf, generate(t, testVehicle, 0), 30*time.Millisecond)
+	if err != ErrTimeout {
+		t.Errorf("accept without controller: %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeouts took %v", elapsed)
+	}
+}
+
+func TestTableFull(t *testing.T) {
+	flash := storage.NewMemory(4, 4096)
+	var table Table
+	first := generate(t, testVehicle, FlagSeal)
+	for pipe := byte(0); pipe < MaxBindings; pipe++ {
+		b := forPipe(t, first, pipe)
+		b.Controller = 10 + pipe
+		i, err := table.Add(b)
+		if err != nil || i != int(pipe) {
+			t.Fatalf("add pipe %d: %d, %v", pipe, i, err)
+		}
+	}
+	if _, err := table.Add(generate(t, testVehicle, 0)); err != ErrFull {
+		t.Errorf("7th binding: %v, want ErrFull", err)
+	}
+
+	// A binding with the same address replaces the old one.
+	again := table.Bindings[2]
+	again.Controller = 99
+	if i, err := table.Add(again); err != nil || i != 2 || table.Len != MaxBindings {
+		t.Errorf("replace pipe 2: %d, %v, len %d", i, err, table.Len)
+	}
+
+	err := Save(flash, block, &table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(flash, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != table {
+		t.Errorf("loaded table differs:\n%+v\n%+v", loaded, table)
+	}
+	if pipes := loaded.Pipes(); string(pipes) != "\x00\x01\x02\x03\x04\x05" {
+		t.Errorf("pipes %v", pipes)
+	}
+
+	var config nrf24l01.Config
+	loaded.SetPipes(&config)
+	if len(config.Pipes[1].Address) != AddressWidth || len(config.Pipes[5].Address) != 1 ||
+		config.Pipes[5].Address[0] != first.Address[0]+5 {
+		t.Errorf("pipe addresses %x, %x", config.Pipes[1].Address, config.Pipes[5].Address)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		b := generate(t, testVehicle, 0)
+		if b.Channel == Channel || b.Channel > nrf24l01.MaxChannel {
+			t.Fatalf("channel %d", b.Channel)
+		}
+		for pipe := 0; pipe <= nrf24l01.MaxPipe; pipe++ {
+			if !goodAddressBytes(b.Address[0]+byte(pipe), 0) || int(b.Address[0])+pipe > 0xFF {
+				t.Fatalf("address %x isn't good for pipe %d", b.Address, pipe)
+			}
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	// 0 and 0xFF are skipped.
+	numbers := []uint32{0x100, 0x2FF, 0x1234}
+	id, err := NewID(func() (uint32, error) {
+		n := numbers[0]
+		numbers = numbers[1:]
+		return n, nil
+	})
+	if id != 0x34 || err != nil {
+		t.Errorf("NewID = %#x, %v, want 0x34", id, err)
+	}
+	for i := 0; i < 1000; i++ {
+		id, _ := NewID(random)
+		if id == 0 || id == 0xFF {
+			t.Fatalf("NewID = %#x", id)
+		}
+	}
+	errRNG := errors.New("rng failed")
+	id, err = NewID(func() (uint32, error) { return 0, errRNG })
+	if id != 0 || err != errRNG {
+		t.Errorf("NewID with failed RNG: %#x, %v", id, err)
+	}
+}
+
+func TestRandomError(t *testing.T) {
+	errRNG := errors.New("rng failed")
+	for _, good := range []int{0, 1, 5, 10} {
+		n := 0
+		failing := func() (uint32, error) {
+			if n == good {
+				return 0, errRNG
+			}
+			n++
+			return 0x12345678, nil
+		}
+		b, err := Generate(failing, testVehicle, FlagAuth)
+		if err != errRNG || b != (Binding{}) {
+			t.Errorf("RNG fails after %d numbers: %+v, %v", good, b, err)
+		}
+	}
+
+	first := generate(t, testVehicle, FlagAuth)
+	b, err := first.ForPipe(1, func() (uint32, error) { return 0, errRNG })
+	if err != errRNG || b != (Binding{}) {
+		t.Errorf("ForPipe with failed RNG: %+v, %v", b, err)
+	}
+}
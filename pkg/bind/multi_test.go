@@ -0,0 +1,185 @@
+package bind
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"joystick/pkg/link"
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+const (
+	multiPackets = 50
+	linkTimeout  = 100 * time.Millisecond
+
+	primary = 1 // controllers
+	backup  = 2
+)
+
+// linkConfig is the link of b, scanned quickly.
+func linkConfig(b Binding) link.Config {
+	return link.Config{
+		Rendezvous:  b.Channel,
+		Channels:    []byte{10, 20, 30},
+		Dwell:       time.Millisecond,
+		Sweeps:      1,
+		Timeout:     linkTimeout,
+		SendTimeout: 5 * time.Millisecond,
+	}
+}
+
+func TestSelectVehicle(t *testing.T) {
+	// A controller switches between two vehicles, every vehicle gets
+	// only the packets sent while it's selected.
+	air := emulator.NewAir()
+	var bindings Table
+	var vehicles [2]*link.Receiver
+	for i := range vehicles {
+		b := generate(t, byte(10+i), 0)
+		b.Controller = primary
+		bindings.Add(b)
+
+		nrf := emutest.Radio(t, air, "vehicle "+strconv.Itoa(i), emutest.Config(b.Address[:]))
+		vehicles[i] = link.NewReceiver(nrf, linkConfig(b))
+		err := vehicles[i].Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nrf := emutest.Radio(t, air, "controller", emutest.Config(bindings.Bindings[0].Address[:]))
+	buf := make([]byte, nrf24l01.MaxPayloadWidth)
+	for round := 0; round < 4; round++ {
+		selected := round % 2
+		b := bindings.Bindings[selected]
+		err := nrf.Apply(emutest.Config(b.Address[:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		controller := link.NewController(nrf, linkConfig(b))
+		err = controller.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The vehicle selected before is on its working channel until
+		// the link times out, then they meet on its rendezvous channel.
+		var got [2]int
+		receive := func() {
+			for i, v := range vehicles {
+				for {
+					n, ok, err := v.Receive(buf)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !ok {
+						break
+					}
+					if n != 1 || buf[0] != bindings.Bindings[i].Vehicle {
+						t.Fatalf("round %d: vehicle %d got a packet for %d", round, i, buf[0])
+					}
+					got[i]++
+				}
+			}
+		}
+		deadline := time.Now().Add(5 * linkTimeout)
+		for got[selected] < multiPackets && time.Now().Before(deadline) {
+			receive()
+			_, err = controller.Send([]byte{b.Vehicle})
+			if err != nil && err != link.ErrNotLinked && err != nrf24l01.ErrMaxRetries {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		receive()
+		if got[1-selected] != 0 || got[selected] < multiPackets {
+			t.Errorf("round %d, vehicle %d selected: vehicles got %v", round, selected, got)
+		}
+	}
+}
+
+func TestControllerPipes(t *testing.T) {
+	// A vehicle with two controllers, the backup one starts after the
+	// primary is linked. Both are heard, on their own pipe, and get replies.
+	air := emulator.NewAir()
+	var bindings Table
+	b := generate(t, 10, 0)
+	b.Controller = primary
+	bindings.Add(b)
+	second := forPipe(t, b, 1)
+	second.Controller = backup
+	bindings.Add(second)
+
+	vehicleConfig := emutest.Config(b.Address[:])
+	bindings.SetPipes(&vehicleConfig)
+	receiverConfig := linkConfig(b)
+	receiverConfig.Pipes = bindings.Pipes()
+	vehicle := link.NewReceiver(emutest.Radio(t, air, "vehicle", vehicleConfig), receiverConfig)
+	err := vehicle.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var controllers [2]*link.Controller
+	for i, cb := range bindings.List() {
+		nrf := emutest.Radio(t, air, "controller "+strconv.Itoa(i), emutest.Config(cb.Address[:]))
+		controllers[i] = link.NewController(nrf, linkConfig(cb))
+	}
+
+	var got, replies [2]int
+	buf := make([]byte, nrf24l01.MaxPayloadWidth)
+	for sent := 0; sent < 2*multiPackets; sent++ {
+		for i, c := range controllers {
+			if i == 1 && sent < multiPackets/2 {
+				continue
+			}
+			if sent == 0 || i == 1 && sent == multiPackets/2 {
+				err = c.Start()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, err = c.Send([]byte{bindings.Bindings[i].Controller})
+			if err != nil && err != link.ErrNotLinked && err != nrf24l01.ErrMaxRetries {
+				t.Fatal(err)
+			}
+			n, ok := c.ReadReply(buf)
+			if ok {
+				if n != 1 || buf[0] != bindings.Bindings[i].Controller {
+					t.Fatalf("controller %d got reply for %d", i, buf[0])
+				}
+				replies[i]++
+			}
+
+			for {
+				pipe, n, ok, err := vehicle.ReceiveFrom(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					break
+				}
+				if int(pipe) >= bindings.Len || n != 1 || buf[0] != bindings.Bindings[pipe].Controller {
+					t.Fatalf("payload of %d on pipe %d", buf[0], pipe)
+				}
+				got[pipe]++
+				err = vehicle.Reply([]byte{buf[0]})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+	if vehicle.Channel() != b.Channel {
+		t.Errorf("vehicle on channel %d, want rendezvous %d", vehicle.Channel(), b.Channel)
+	}
+	if got[0] < multiPackets || got[1] < multiPackets/2 || replies[0] == 0 || replies[1] == 0 {
+		t.Errorf("pipes got %v, replies %v", got, replies)
+	}
+	if s := vehicle.PipeStats(1); s.Duplicates != 0 {
+		t.Errorf("pipe 1 %s", s)
+	}
+}
@@ -0,0 +1,169 @@
+// Package failsafe puts the vehicle in a safe state when the link is lost.
+//
+// The failsafe is a watchdog on the time of the last valid packet. When
+// no packet comes for Config.Timeout, Check returns the safe action. After
+// it, and after start, commands are ignored until a packet with the sticks
+// in neutral arrives, so the vehicle doesn't jump to the last command when
+// the link comes back.
+//
+// Time is read from Clock, tests can use a fake one.
+package failsafe
+
+import (
+	"time"
+)
+
+// Clock gives the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the clock of the time package.
+var SystemClock Clock = systemClock{}
+
+// Action to apply to the motors.
+type Action byte
+
+const (
+	ActionNone  Action = iota // execute commands from packets
+	ActionStop                // stop with brake
+	ActionCoast               // release motors, the vehicle rolls out
+	ActionHold                // keep the last command for Config.Hold, then stop
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionStop:
+		return "stop"
+	case ActionCoast:
+		return "coast"
+	case ActionHold:
+		return "hold"
+	}
+	return "none"
+}
+
+// State of the failsafe.
+type State byte
+
+const (
+	StateDisarmed State = iota // waits for neutral sticks, after start
+	StateArmed                 // commands are executed
+	StateLost                  // no packets for Timeout, safe action is applied
+)
+
+func (s State) String() string {
+	switch s {
+	case StateArmed:
+		return "armed"
+	case StateLost:
+		return "LINK LOST"
+	}
+	return "disarmed"
+}
+
+// Config of the failsafe. Zero fields take defaults.
+type Config struct {
+	// Timeout without valid packets after which the link is lost.
+	// Default 500ms.
+	Timeout time.Duration
+
+	// Action when the link is lost: ActionStop (default), ActionCoast
+	// or ActionHold.
+	Action Action
+
+	// Hold is the time the last command is kept with ActionHold.
+	// Default 300ms.
+	Hold time.Duration
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout == 0 {
+		c.Timeout = 500 * time.Millisecond
+	}
+	if c.Action == ActionNone {
+		c.Action = ActionStop
+	}
+	if c.Hold == 0 {
+		c.Hold = 300 * time.Millisecond
+	}
+	return c
+}
+
+// Failsafe watches valid packets.
+type Failsafe struct {
+	config Config
+	clock  Clock
+
+	state State
+	last  time.Time // last valid packet
+	lost  time.Time // the link was lost
+}
+
+// New returns failsafe in StateDisarmed. clock - nil for SystemClock.
+func New(config Config, clock Clock) *Failsafe {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Failsafe{
+		config: config.withDefaults(),
+		clock:  clock,
+	}
+}
+
+// State returns current state of the failsafe.
+func (f *Failsafe) State() State {
+	return f.state
+}
+
+// Packet registers a valid packet, neutral - its sticks are in neutral.
+// Returns true if the command of the packet must be executed.
+//
+// Out of StateArmed only a neutral packet arms the failsafe again.
+func (f *Failsafe) Packet(neutral bool) bool {
+	f.last = f.clock.Now()
+	if f.state != StateArmed {
+		if !neutral {
+			return false
+		}
+		f.state = StateArmed
+	}
+	return true
+}
+
+// Check returns the action to apply now. It must be called periodically,
+// more often than Timeout, also when there are no packets.
+//
+// ActionNone - commands are executed. In StateDisarmed it's ActionStop,
+// or ActionCoast when it's the configured action.
+func (f *Failsafe) Check() Action {
+	now := f.clock.Now()
+	switch f.state {
+	case StateDisarmed:
+		if f.config.Action == ActionCoast {
+			return ActionCoast
+		}
+		return ActionStop
+	case StateArmed:
+		if now.Sub(f.last) <= f.config.Timeout {
+			return ActionNone
+		}
+		f.state = StateLost
+		f.lost = f.last.Add(f.config.Timeout)
+	}
+
+	if f.config.Action != ActionHold {
+		return f.config.Action
+	}
+	// Packets without neutral sticks don't extend the hold.
+	if now.Sub(f.lost) <= f.config.Hold {
+		return ActionHold
+	}
+	return ActionStop
+}
@@ -0,0 +1,91 @@
+package failsafe
+
+import (
+	"testing"
+	"time"
+
+	"joystick/pkg/failsafe/failsafetest"
+)
+
+// step is one moment of a test: after the time passes, a packet (if any)
+// arrives and Check is called.
+type step struct {
+	after   time.Duration
+	packet  bool // a valid packet arrives
+	neutral bool // its sticks are in neutral
+	execute bool // want: Packet returns true
+	action  Action
+	state   State
+}
+
+func run(t *testing.T, config Config, steps []step) {
+	t.Helper()
+	clock := failsafetest.NewClock()
+	f := New(config, clock)
+	for i, s := range steps {
+		clock.Advance(s.after)
+		if s.packet {
+			if got := f.Packet(s.neutral); got != s.execute {
+				t.Errorf("step %d: Packet(%v) = %v, want %v", i, s.neutral, got, s.execute)
+			}
+		}
+		if got := f.Check(); got != s.action {
+			t.Errorf("step %d: Check() = %s, want %s", i, got, s.action)
+		}
+		if got := f.State(); got != s.state {
+			t.Errorf("step %d: state %s, want %s", i, got, s.state)
+		}
+	}
+}
+
+func TestStop(t *testing.T) {
+	run(t, Config{Timeout: 100 * time.Millisecond}, []step{
+		{action: ActionStop, state: StateDisarmed},
+		// Commands are ignored until the sticks are in neutral.
+		{after: 10 * time.Millisecond, packet: true, action: ActionStop, state: StateDisarmed},
+		{after: 10 * time.Millisecond, packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+		{after: 50 * time.Millisecond, packet: true, execute: true, action: ActionNone, state: StateArmed},
+		{after: 100 * time.Millisecond, action: ActionNone, state: StateArmed},
+		{after: time.Millisecond, action: ActionStop, state: StateLost},
+		{after: time.Second, action: ActionStop, state: StateLost},
+		// The link is back, but the sticks aren't in neutral.
+		{after: 10 * time.Millisecond, packet: true, action: ActionStop, state: StateLost},
+		{after: 10 * time.Millisecond, packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+		{after: 10 * time.Millisecond, packet: true, execute: true, action: ActionNone, state: StateArmed},
+	})
+}
+
+func TestCoast(t *testing.T) {
+	run(t, Config{Timeout: 100 * time.Millisecond, Action: ActionCoast}, []step{
+		{action: ActionCoast, state: StateDisarmed},
+		{packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+		{after: 101 * time.Millisecond, action: ActionCoast, state: StateLost},
+		{packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+	})
+}
+
+func TestHold(t *testing.T) {
+	run(t, Config{Timeout: 100 * time.Millisecond, Action: ActionHold, Hold: 200 * time.Millisecond}, []step{
+		{action: ActionStop, state: StateDisarmed},
+		{packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+		{after: 50 * time.Millisecond, packet: true, execute: true, action: ActionNone, state: StateArmed},
+		// Lost 100ms after the last packet, Check is late: the hold
+		// counts from the loss, not from Check.
+		{after: 150 * time.Millisecond, action: ActionHold, state: StateLost},
+		{after: 140 * time.Millisecond, action: ActionHold, state: StateLost},
+		// Packets without neutral sticks don't extend the hold.
+		{after: 5 * time.Millisecond, packet: true, action: ActionHold, state: StateLost},
+		{after: 10 * time.Millisecond, action: ActionStop, state: StateLost},
+		{after: 10 * time.Millisecond, packet: true, neutral: true, execute: true, action: ActionNone, state: StateArmed},
+	})
+}
+
+func TestDefaults(t *testing.T) {
+	f := New(Config{}, failsafetest.NewClock())
+	if f.config.Timeout != 500*time.Millisecond || f.config.Action != ActionStop || f.config.Hold != 300*time.Millisecond {
+		t.Errorf("defaults %+v", f.config)
+	}
+	if New(Config{}, nil).clock != SystemClock {
+		t.Errorf("nil clock isn't SystemClock")
+	}
+}
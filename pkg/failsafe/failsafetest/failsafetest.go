@@ -0,0 +1,25 @@
+// Package failsafetest has a Clock moved by the test, for the packages
+// that take a failsafe.Clock.
+package failsafetest
+
+import "time"
+
+// Clock is a fake failsafe.Clock, time passes only with Advance.
+type Clock struct {
+	now time.Time
+}
+
+// NewClock returns a clock at a fixed time, far from the zero time.
+func NewClock() *Clock {
+	return &Clock{now: time.Unix(1000, 0)}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// Advance moves the clock by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
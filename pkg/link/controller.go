@@ -0,0 +1,209 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// Controller is the side of the link that follows the channel selected
+// by the receiver (the joystick). The radio works in TX mode.
+type Controller struct {
+	nrf    *nrf24l01.Device
+	config Config
+
+	state   State
+	channel byte      // working channel
+	last    time.Time // last delivered packet on the working channel
+	hop     hopper
+	seq     uint16 // sequence number of the next payload
+	stats   counters
+
+	buf   [nrf24l01.MaxPayloadWidth]byte
+	reply [nrf24l01.MaxPayloadWidth]byte // last reply of the receiver
+	n     int                            // length of reply, 0 - read or none
+}
+
+// NewController returns controller side of the link. Call Start before Send.
+func NewController(nrf *nrf24l01.Device, config Config) *Controller {
+	return &Controller{
+		nrf:    nrf,
+		config: config.withDefaults(),
+	}
+}
+
+// Start tunes to the rendezvous channel, or to the first hop with Config.Hop.
+func (c *Controller) Start() error {
+	if c.config.Hop != HopOff {
+		return c.startHopping()
+	}
+	return c.rendezvous()
+}
+
+// State returns current state of the link.
+func (c *Controller) State() State {
+	return c.state
+}
+
+// Channel returns the working channel, valid in StateLinked, or the current hop.
+func (c *Controller) Channel() byte {
+	return c.channel
+}
+
+// Send payload on the working channel, up to 30 bytes.
+//
+// Without link one handshake attempt is made first. If it fails,
+// payload isn't sent and ErrNotLinked is returned.
+// When nothing is delivered for Config.Timeout the controller goes
+// back to rendezvous.
+//
+// With Config.Hop payload is sent on the current hop, up to 27 bytes.
+func (c *Controller) Send(payload []byte) (nrf24l01.SendResult, error) {
+	if c.config.Hop != HopOff {
+		return c.sendHopping(payload)
+	}
+	if len(payload)+seqHeader > nrf24l01.MaxPayloadWidth {
+		return nrf24l01.SendResult{}, nrf24l01.ErrPayloadTooLarge
+	}
+	if c.state != StateLinked {
+		err := c.handshake()
+		if err != nil {
+			return nrf24l01.SendResult{}, err
+		}
+	}
+
+	res, err := c.send(c.buf[:0], payload)
+	if res.Delivered {
+		c.last = time.Now()
+		return res, err
+	}
+	if time.Since(c.last) > c.config.Timeout {
+		fallback := c.rendezvous()
+		if fallback != nil {
+			return res, fallback
+		}
+	}
+	return res, err
+}
+
+// send stamps payload with the next sequence number after header
+// and sends it. header must be a prefix of buf.
+func (c *Controller) send(header, payload []byte) (nrf24l01.SendResult, error) {
+	n := len(header)
+	binary.LittleEndian.PutUint16(c.buf[n:], c.seq)
+	c.seq++
+	n += seqHeader
+	n += copy(c.buf[n:], payload)
+
+	start := time.Now()
+	res, err := c.nrf.Send(c.config.SendTimeout, c.buf[:n])
+	c.stats.sent(res.Delivered, time.Since(start))
+	if res.AckPayload {
+		read := c.readReply()
+		if read != nil {
+			return res, read
+		}
+	}
+	return res, err
+}
+
+// readReply keeps the last ACK payload from RX FIFO as the reply.
+// Announces left by the receiver for the handshake are dropped.
+func (c *Controller) readReply() error {
+	for {
+		_, n, ok, err := c.nrf.Receive(c.buf[:])
+		if err != nil || !ok {
+			return err
+		}
+		if _, isAnnounce := parseAnnounce(c.buf[:n]); isAnnounce {
+			continue
+		}
+		c.n = copy(c.reply[:], c.buf[:n])
+	}
+}
+
+// ReadReply copies into buf the last reply of the receiver, see
+// Receiver.Reply. ok is false when no reply came since the last call.
+func (c *Controller) ReadReply(buf []byte) (n int, ok bool) {
+	if c.n == 0 {
+		return 0, false
+	}
+	n = copy(buf, c.reply[:c.n])
+	c.n = 0
+	return n, true
+}
+
+// Stats returns statistics of sent payloads.
+func (c *Controller) Stats() Stats {
+	return c.stats.stats
+}
+
+// ResetStats clears statistics of sent payloads.
+func (c *Controller) ResetStats() {
+	c.stats.reset()
+}
+
+// handshake sends hello, reads the announced channel from ACK payload,
+// confirms it and switches to it.
+func (c *Controller) handshake() error {
+	res, err := c.nrf.Send(c.config.SendTimeout, frame(frameHello, 0))
+	if err != nil {
+		return notLinked(err)
+	}
+	if !res.AckPayload {
+		// The receiver is there, but the announce isn't loaded yet.
+		return ErrNotLinked
+	}
+
+	_, n, ok, err := c.nrf.Receive(c.buf[:])
+	if err != nil {
+		return err
+	}
+	channel, isAnnounce := parseAnnounce(c.buf[:n])
+	if !ok || !isAnnounce || channel > nrf24l01.MaxChannel {
+		return ErrNotLinked
+	}
+
+	// Switch even if the confirm isn't acknowledged: the receiver may have
+	// switched already. Otherwise the link timeout brings both back.
+	_, err = c.nrf.Send(c.config.SendTimeout, frame(frameConfirm, channel))
+	err = notLinked(err)
+	if err != nil && err != ErrNotLinked {
+		return err
+	}
+
+	c.channel = channel
+	c.state = StateLinked
+	c.last = time.Now()
+	return c.tune(channel)
+}
+
+// rendezvous tunes to the rendezvous channel.
+func (c *Controller) rendezvous() error {
+	c.state = StateRendezvous
+	return c.tune(c.config.Rendezvous)
+}
+
+// tune switches TX mode to channel, received ACK payloads are dropped.
+func (c *Controller) tune(channel byte) error {
+	c.nrf.Disable()
+	err := c.nrf.FlushRX()
+	if err != nil {
+		return err
+	}
+	err = c.nrf.SetRFChannel(channel)
+	if err != nil {
+		return err
+	}
+	return c.nrf.SetTXMode()
+}
+
+// notLinked turns errors of a packet not getting through into ErrNotLinked.
+func notLinked(err error) error {
+	if errors.Is(err, nrf24l01.ErrMaxRetries) || errors.Is(err, nrf24l01.ErrTimeout) {
+		return ErrNotLinked
+	}
+	return err
+}
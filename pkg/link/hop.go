@@ -0,0 +1,289 @@
+package link
+
+import (
+	"time"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// HopMode selects frequency hopping (FHSS).
+type HopMode byte
+
+const (
+	HopOff       HopMode = iota // fixed channel selected by the receiver
+	HopPerPacket                // next channel after every delivered packet, needs auto-ack
+	HopPerSlot                  // next channel every Config.Slot
+)
+
+// Hopping payloads start with a header: index in hop table, cycle of the
+// table (number of passes, mod 256) and phase of the slot in 1/256 of Slot.
+// The sequence number follows it.
+const hopHeader = 3
+
+// HopStats are statistics of frequency hopping.
+//
+// The receiver counts missed hops from the hop header of the next packet,
+// also when it was out of sync: the hops of an outage are missed too.
+// Hops before the first packet aren't counted, the controller may have
+// started any time before.
+type HopStats struct {
+	Hops    int // channel switches
+	Packets int // packets sent (controller) or received (receiver)
+	Missed  int // not delivered packets (controller) or hops without packet (receiver)
+	Resyncs int // sync gained at start or after it was lost (receiver)
+}
+
+// HopTable returns n channels from candidates in pseudo-random order
+// derived from seed. Both sides of the link get the same table from the
+// same seed. If n is bigger than the number of candidates, all are used.
+func HopTable(seed uint32, candidates []byte, n int) []byte {
+	table := append([]byte(nil), candidates...)
+	state := seed | 1 // xorshift doesn't leave 0
+	for i := len(table) - 1; i > 0; i-- {
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		j := int(state % uint32(i+1))
+		table[i], table[j] = table[j], table[i]
+	}
+	if n < len(table) {
+		table = table[:n]
+	}
+	return table
+}
+
+// hopper is the position in the hop table.
+type hopper struct {
+	table []byte
+	index int       // current index in table
+	cycle byte      // passes over table
+	epoch time.Time // HopPerSlot: start of slot 0
+	last  int       // position of the last received packet
+	ahead bool      // HopPerPacket controller: on the next hop after a miss
+	stats HopStats
+}
+
+func newHopper(c *Config) hopper {
+	return hopper{table: HopTable(c.Seed, c.candidates(), c.HopCount)}
+}
+
+// advance moves to the next hop.
+func (h *hopper) advance() {
+	h.index++
+	if h.index == len(h.table) {
+		h.index = 0
+		h.cycle++
+	}
+}
+
+// back moves to the previous hop.
+func (h *hopper) back() {
+	if h.index == 0 {
+		h.index = len(h.table)
+		h.cycle--
+	}
+	h.index--
+}
+
+// slot returns index, cycle and phase of the slot at time now.
+func (h *hopper) slot(now time.Time, slot time.Duration) (index int, cycle, phase byte) {
+	elapsed := now.Sub(h.epoch)
+	n := int64(elapsed / slot)
+	index = int(n % int64(len(h.table)))
+	cycle = byte(n / int64(len(h.table)))
+	phase = byte((elapsed % slot) * 256 / slot)
+	return index, cycle, phase
+}
+
+// sync sets the start of slot 0 from a packet sent at now in slot index
+// of cycle, phase in 1/256 of slot. slot at now returns them back.
+func (h *hopper) sync(now time.Time, index int, cycle, phase byte, slot time.Duration) {
+	n := time.Duration(h.position(index, cycle))
+	h.epoch = now.Add(-n*slot - time.Duration(phase)*slot/256)
+}
+
+// position returns absolute hop number, modulo 256 cycles.
+func (h *hopper) position(index int, cycle byte) int {
+	return int(cycle)*len(h.table) + index
+}
+
+// gap returns number of hops between the last received packet and pos.
+func (h *hopper) gap(pos int) int {
+	size := 256 * len(h.table)
+	return (pos-h.last+size)%size - 1
+}
+
+// startHopping tunes the controller to the first hop.
+func (c *Controller) startHopping() error {
+	c.hop = newHopper(&c.config)
+	if len(c.hop.table) == 0 {
+		return ErrInvalidChannel
+	}
+	c.hop.epoch = time.Now()
+	c.last = c.hop.epoch
+	c.state = StateLinked
+	c.channel = c.hop.table[0]
+	return c.tune(c.channel)
+}
+
+// sendHopping sends payload with hop header on the current hop.
+func (c *Controller) sendHopping(payload []byte) (nrf24l01.SendResult, error) {
+	if len(payload)+hopHeader+seqHeader > nrf24l01.MaxPayloadWidth {
+		return nrf24l01.SendResult{}, nrf24l01.ErrPayloadTooLarge
+	}
+
+	var phase byte
+	if c.config.Hop == HopPerSlot {
+		c.hop.index, c.hop.cycle, phase = c.hop.slot(time.Now(), c.config.Slot)
+	}
+	if ch := c.hop.table[c.hop.index]; ch != c.channel {
+		err := c.tune(ch)
+		if err != nil {
+			return nrf24l01.SendResult{}, err
+		}
+		c.channel = ch
+		c.hop.stats.Hops++
+	}
+
+	c.buf[0] = byte(c.hop.index)
+	c.buf[1] = c.hop.cycle
+	c.buf[2] = phase
+	res, err := c.send(c.buf[:hopHeader], payload)
+
+	c.hop.stats.Packets++
+	if res.Delivered {
+		c.last = time.Now()
+	} else {
+		c.hop.stats.Missed++
+	}
+	if c.config.Hop == HopPerPacket {
+		c.nextHop(res.Delivered)
+	}
+	return res, err
+}
+
+// nextHop selects the hop of the next packet in HopPerPacket.
+//
+// The receiver hops only when it gets the packet. A miss is either the
+// packet or its ACK lost, in the second case the receiver is already on
+// the next hop: after a miss the next hop is tried, then the same one
+// again, until a packet gets through. Without ACK for Timeout the
+// receiver can be on any hop, sweep the table to meet it.
+func (c *Controller) nextHop(delivered bool) {
+	switch {
+	case delivered || time.Since(c.last) > c.config.Timeout:
+		c.hop.ahead = false
+		c.hop.advance()
+	case c.hop.ahead:
+		c.hop.ahead = false
+		c.hop.back()
+	default:
+		c.hop.ahead = true
+		c.hop.advance()
+	}
+}
+
+// HopStats returns statistics of frequency hopping.
+func (c *Controller) HopStats() HopStats {
+	return c.hop.stats
+}
+
+// startHopping tunes the receiver to the first hop and waits for sync.
+func (r *Receiver) startHopping() error {
+	r.hop = newHopper(&r.config)
+	if len(r.hop.table) == 0 {
+		return ErrInvalidChannel
+	}
+	r.state = StateSearching
+	r.channel = r.hop.table[0]
+	return r.tune(r.channel)
+}
+
+// receiveHopping follows the hop table and returns payload without header.
+//
+// Without sync the receiver waits on one channel, the controller comes
+// to it once per pass over the table. Any packet gives the position
+// of the controller and the receiver follows it again.
+func (r *Receiver) receiveHopping(buf []byte) (pipe byte, n int, ok bool, err error) {
+	now := time.Now()
+	if r.state == StateLinked && now.Sub(r.last) > r.config.Timeout {
+		r.state = StateSearching
+		r.restart()
+	}
+	if r.state == StateLinked && r.config.Hop == HopPerSlot {
+		index, cycle, _ := r.hop.slot(now, r.config.Slot)
+		r.hop.cycle = cycle
+		err = r.hopTo(index)
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	for {
+		p, size, ok, err := r.nrf.Receive(r.buf[:])
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if !ok {
+			return 0, 0, false, nil
+		}
+		pipe = byte(p)
+		if size < hopHeader+seqHeader || int(r.buf[0]) >= len(r.hop.table) {
+			continue
+		}
+
+		// Before hopping, RPD is reset by the channel change.
+		fresh, err := r.accept(pipe, r.buf[hopHeader:size])
+		if err != nil {
+			return 0, 0, false, err
+		}
+
+		index, cycle, phase := int(r.buf[0]), r.buf[1], r.buf[2]
+		now = time.Now()
+		pos := r.hop.position(index, cycle)
+		// Hops without packets since the last one.
+		if gap := r.hop.gap(pos); gap > 0 && r.hop.stats.Packets > 0 {
+			r.hop.stats.Missed += gap
+		}
+		if r.state != StateLinked {
+			r.hop.stats.Resyncs++
+		}
+		r.hop.last = pos
+		r.hop.stats.Packets++
+		r.state = StateLinked
+		r.last = now
+		r.hop.index, r.hop.cycle = index, cycle
+
+		switch r.config.Hop {
+		case HopPerPacket:
+			r.hop.advance()
+			err = r.hopTo(r.hop.index)
+		case HopPerSlot:
+			r.hop.sync(now, index, cycle, phase, r.config.Slot)
+		}
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if !fresh {
+			continue
+		}
+		return pipe, copy(buf, r.buf[hopHeader+seqHeader:size]), true, nil
+	}
+}
+
+// hopTo tunes the receiver to index of the hop table.
+func (r *Receiver) hopTo(index int) error {
+	r.hop.index = index
+	ch := r.hop.table[index]
+	if ch == r.channel {
+		return nil
+	}
+	r.channel = ch
+	r.hop.stats.Hops++
+	return r.tune(ch)
+}
+
+// HopStats returns statistics of frequency hopping.
+func (r *Receiver) HopStats() HopStats {
+	return r.hop.stats
+}
@@ -0,0 +1,107 @@
+package link
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHopTable(t *testing.T) {
+	candidates := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	a := HopTable(0x5EED, candidates, 10)
+	b := HopTable(0x5EED, candidates, 10)
+	if string(a) != string(b) {
+		t.Fatalf("same seed: %v and %v", a, b)
+	}
+	if c := HopTable(0x5EEE, candidates, 10); string(c) == string(a) {
+		t.Errorf("other seed, same table %v", c)
+	}
+
+	sorted := append([]byte(nil), a...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if string(sorted) != string(candidates) {
+		t.Errorf("table %v isn't a permutation of the candidates", a)
+	}
+	if string(candidates) != "\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a" {
+		t.Errorf("candidates changed: %v", candidates)
+	}
+
+	if short := HopTable(0x5EED, candidates, 4); string(short) != string(a[:4]) {
+		t.Errorf("4 hops %v, want prefix of %v", short, a)
+	}
+	if long := HopTable(0x5EED, candidates, 20); len(long) != len(candidates) {
+		t.Errorf("20 hops of 10 candidates: %v", long)
+	}
+}
+
+func TestSlotSync(t *testing.T) {
+	const slot = 20 * time.Millisecond
+	tests := []struct {
+		index        int
+		cycle, phase byte
+	}{
+		{0, 0, 0},
+		{3, 0, 128},
+		{7, 1, 10},
+		{2, 5, 255},
+		{7, 255, 200},
+	}
+	for _, tt := range tests {
+		h := hopper{table: make([]byte, 8)}
+		now := time.Now()
+		h.sync(now, tt.index, tt.cycle, tt.phase, slot)
+
+		index, cycle, phase := h.slot(now, slot)
+		if index != tt.index || cycle != tt.cycle || phase != tt.phase {
+			t.Errorf("sync(%d, %d, %d): slot = %d, %d, %d", tt.index, tt.cycle, tt.phase, index, cycle, phase)
+		}
+		// The next slot follows.
+		index, cycle, _ = h.slot(now.Add(slot), slot)
+		next := hopper{table: h.table, index: tt.index, cycle: tt.cycle}
+		next.advance()
+		if index != next.index || cycle != next.cycle {
+			t.Errorf("after sync(%d, %d): next slot %d, %d, want %d, %d",
+				tt.index, tt.cycle, index, cycle, next.index, next.cycle)
+		}
+	}
+}
+
+func TestBack(t *testing.T) {
+	h := hopper{table: make([]byte, 3)}
+	for i := 0; i < 3*256+2; i++ {
+		h.advance()
+	}
+	for i := 0; i < 3*256+2; i++ {
+		index, cycle := h.index, h.cycle
+		h.back()
+		h.advance()
+		if h.index != index || h.cycle != cycle {
+			t.Fatalf("back and advance from %d, %d: %d, %d", index, cycle, h.index, h.cycle)
+		}
+		h.back()
+	}
+	if h.index != 0 || h.cycle != 0 {
+		t.Errorf("back to the start: %d, %d", h.index, h.cycle)
+	}
+}
+
+func TestGap(t *testing.T) {
+	h := hopper{table: make([]byte, 8)}
+	tests := []struct {
+		last, pos int
+		want      int
+	}{
+		{0, 1, 0},
+		{0, 5, 4},
+		{6, 10, 3},
+		{7, 7, -1},        // the same hop again
+		{256*8 - 1, 0, 0}, // cycle wraps around
+		{256*8 - 2, 3, 4},
+	}
+	for _, tt := range tests {
+		h.last = tt.last
+		if got := h.gap(tt.pos); got != tt.want {
+			t.Errorf("gap from %d to %d = %d, want %d", tt.last, tt.pos, got, tt.want)
+		}
+	}
+}
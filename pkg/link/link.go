@@ -0,0 +1,198 @@
+// Package link keeps the radio link between a controller and a receiver
+// on a clean channel.
+//
+// Both sides meet on a fixed rendezvous channel. The receiver scans the
+// candidate channels at start, picks the quietest one and announces it in
+// the ACK payload of the controller's hello. The controller confirms the
+// channel and both switch to it. If no packet gets through for
+// Config.Timeout, each side falls back to the rendezvous channel on its own
+// and the handshake starts again.
+//
+// With Config.Hop the link uses frequency hopping (FHSS) instead: both
+// sides derive the same hop table from Config.Seed and change the channel
+// per packet or per time slot, without the handshake.
+//
+// The controller stamps every application payload with a sequence number.
+// The receiver drops duplicate and late payloads and counts the lost ones,
+// see Stats.
+//
+// The receiver can send data back, like telemetry, in the ACK payloads of
+// the link: see Receiver.Reply and Controller.ReadReply.
+//
+// The radio must be configured with auto-ack, dynamic payload length and
+// ACK payloads on pipe 0, with the same address on both sides.
+package link
+
+import (
+	"errors"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+)
+
+var (
+	ErrNotLinked      = errors.New("link: not linked, handshake on rendezvous channel")
+	ErrInvalidChannel = errors.New("link: no candidate channels")
+)
+
+// State of the link.
+type State byte
+
+const (
+	StateRendezvous State = iota // handshake on the rendezvous channel
+	StateLinked                  // working on the selected channel, or hopping in sync
+	StateSearching               // hopping receiver lost sync, waits on one channel
+	StateScanning                // receiver lost the link, scans the channels again
+)
+
+func (s State) String() string {
+	switch s {
+	case StateLinked:
+		return "linked"
+	case StateSearching:
+		return "searching"
+	case StateScanning:
+		return "scanning"
+	}
+	return "rendezvous"
+}
+
+// Config of the link, the same on both sides. Zero fields take defaults.
+type Config struct {
+	// Rendezvous is the fixed channel for the handshake.
+	Rendezvous byte
+
+	// Channels are candidates for the working channel.
+	// nil - all channels except Rendezvous.
+	Channels []byte
+
+	// Scan parameters of the receiver, see nrf24l01.Device.Scan.
+	// Default 1ms and 10 sweeps.
+	Dwell  time.Duration
+	Sweeps int
+
+	// Timeout without any packet after which the link is lost. Default 1s.
+	// Must be longer than the interval between packets of the controller.
+	Timeout time.Duration
+
+	// SendTimeout is the timeout of one nrf24l01.Device.Send. Default 100ms.
+	SendTimeout time.Duration
+
+	// Hop enables frequency hopping over Channels. Payloads are up to
+	// 27 bytes, 3 bytes are used by the hop header.
+	Hop HopMode
+
+	// Seed of the hop table, the same on both sides.
+	Seed uint32
+
+	// HopCount is the length of the hop table. Default 16.
+	HopCount int
+
+	// Slot is the time on one channel for HopPerSlot. Default 20ms.
+	Slot time.Duration
+
+	// Pipes of the receiver, one per controller, with ACK payloads
+	// enabled. nil - pipe 0. With several pipes the working channel is
+	// the rendezvous channel, without scan, so a controller that starts
+	// later still finds the receiver. Not used by the controller.
+	Pipes []byte
+}
+
+func (c Config) withDefaults() Config {
+	if c.Dwell == 0 {
+		c.Dwell = time.Millisecond
+	}
+	if c.Sweeps == 0 {
+		c.Sweeps = 10
+	}
+	if c.Timeout == 0 {
+		c.Timeout = time.Second
+	}
+	if c.SendTimeout == 0 {
+		c.SendTimeout = 100 * time.Millisecond
+	}
+	if c.HopCount == 0 {
+		c.HopCount = 16
+	}
+	if c.Slot == 0 {
+		c.Slot = 20 * time.Millisecond
+	}
+	if len(c.Pipes) == 0 {
+		c.Pipes = []byte{0}
+	}
+	return c
+}
+
+// candidates returns channels to choose the working channel from.
+func (c *Config) candidates() []byte {
+	var res []byte
+	if c.Channels != nil {
+		for _, ch := range c.Channels {
+			if ch != c.Rendezvous && ch <= nrf24l01.MaxChannel {
+				res = append(res, ch)
+			}
+		}
+		return res
+	}
+	for ch := byte(0); ch <= nrf24l01.MaxChannel; ch++ {
+		if ch != c.Rendezvous {
+			res = append(res, ch)
+		}
+	}
+	return res
+}
+
+// Handshake frames, only on the rendezvous channel. On the working channel
+// all payloads are application payloads, unless it's the rendezvous one.
+//
+// Hello and confirm of the controller are one byte, shorter than the
+// sequence number of any application payload, so the receiver tells them
+// apart from data also on the rendezvous channel. The announce of the
+// receiver is an ACK payload: frameMagic, frameAnnounce and the channel.
+const (
+	frameMagic = 0xA7
+
+	frameHello    = 1 // controller looks for the receiver
+	frameAnnounce = 2 // receiver tells the working channel, in ACK payload
+	frameConfirm  = 3 // controller switches to the channel
+)
+
+// helloByte is the hello frame, confirm is the channel alone.
+const helloByte = 0xFF
+
+// txFIFO is the number of ACK payloads the receiver can keep loaded.
+const txFIFO = 3
+
+func frame(kind, channel byte) []byte {
+	switch kind {
+	case frameHello:
+		return []byte{helloByte}
+	case frameConfirm:
+		return []byte{channel}
+	}
+	return []byte{frameMagic, kind, channel}
+}
+
+// parseFrame returns kind and channel of a hello or confirm frame.
+// ok is false for application payloads.
+func parseFrame(data []byte) (kind, channel byte, ok bool) {
+	if len(data) != 1 {
+		return 0, 0, false
+	}
+	if data[0] == helloByte {
+		return frameHello, 0, true
+	}
+	if data[0] > nrf24l01.MaxChannel {
+		return 0, 0, false
+	}
+	return frameConfirm, data[0], true
+}
+
+// parseAnnounce returns the channel of an announce frame.
+// ok is false for replies of the receiver.
+func parseAnnounce(data []byte) (channel byte, ok bool) {
+	if len(data) != 3 || data[0] != frameMagic || data[1] != frameAnnounce {
+		return 0, false
+	}
+	return data[2], true
+}
@@ -0,0 +1,384 @@
+package link_test
+
+import (
+	"testing"
+	"time"
+
+	"joystick/pkg/link"
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+const rendezvous = 5
+
+// radioConfig is the radio setup of the link: all pipes enabled, pipe 0
+// and the controller on LINK0, pipe 1 on LINK1.
+func radioConfig() nrf24l01.Config {
+	config := emutest.Config([]byte("LINK0"))
+	config.Channel = rendezvous
+	for i := 1; i < len(config.Pipes); i++ {
+		config.Pipes[i] = nrf24l01.Pipe{Enabled: true, AutoAck: true, DynamicPayload: true}
+	}
+	config.Pipes[1].Address = []byte("LINK1")
+	return config
+}
+
+// sim is a controller and a receiver on the same air.
+type sim struct {
+	air        *emulator.Air
+	controller *link.Controller
+	receiver   *link.Receiver
+	received   [][]byte
+}
+
+func newSim(t *testing.T, config link.Config) *sim {
+	t.Helper()
+	s := &sim{air: emulator.NewAir()}
+	tx := emutest.Radio(t, s.air, "controller", radioConfig())
+	rx := emutest.Radio(t, s.air, "receiver", radioConfig())
+	s.controller = link.NewController(tx, config)
+	s.receiver = link.NewReceiver(rx, config)
+	return s
+}
+
+func (s *sim) start(t *testing.T) {
+	t.Helper()
+	err := s.receiver.Start()
+	if err == nil {
+		err = s.controller.Start()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads all payloads of the receiver.
+func (s *sim) receive(t *testing.T) {
+	t.Helper()
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	for {
+		n, ok, err := s.receiver.Receive(buf[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return
+		}
+		s.received = append(s.received, append([]byte(nil), buf[:n]...))
+	}
+}
+
+// send sends payload and lets the receiver read it. Returns true if it
+// was delivered.
+func (s *sim) send(t *testing.T, payload []byte) bool {
+	t.Helper()
+	res, err := s.controller.Send(payload)
+	if err != nil && err != link.ErrNotLinked && err != nrf24l01.ErrMaxRetries {
+		t.Fatal(err)
+	}
+	s.receive(t)
+	return res.Delivered
+}
+
+// link sends until a payload is delivered, up to tries packets.
+func (s *sim) link(t *testing.T, tries int) {
+	t.Helper()
+	for i := 0; i < tries; i++ {
+		if s.send(t, []byte{byte(i)}) {
+			return
+		}
+	}
+	t.Fatalf("not linked after %d packets: controller %s, receiver %s",
+		tries, s.controller.State(), s.receiver.State())
+}
+
+func TestRendezvous(t *testing.T) {
+	s := newSim(t, link.Config{
+		Rendezvous: rendezvous,
+		Channels:   []byte{10, 20, 30, rendezvous},
+		Timeout:    100 * time.Millisecond,
+	})
+	noise := emulator.NewInterference(1)
+	noise.Set(10, 10, 0.9)
+	noise.Set(30, 30, 0.5)
+	s.air.Noise = noise.Carrier
+	s.start(t)
+
+	if s.receiver.Channel() != 20 || s.receiver.State() != link.StateRendezvous {
+		t.Fatalf("receiver selected channel %d (%s), want quietest 20", s.receiver.Channel(), s.receiver.State())
+	}
+
+	s.link(t, 10)
+	if s.controller.State() != link.StateLinked || s.controller.Channel() != 20 {
+		t.Errorf("controller %s on %d, want linked on 20", s.controller.State(), s.controller.Channel())
+	}
+	if s.receiver.State() != link.StateLinked {
+		t.Errorf("receiver %s, want linked", s.receiver.State())
+	}
+
+	s.received = nil
+	for i := 0; i < 5; i++ {
+		if !s.send(t, []byte("data")) {
+			t.Fatalf("packet %d not delivered on the working channel", i)
+		}
+	}
+	if len(s.received) != 5 || string(s.received[0]) != "data" {
+		t.Errorf("received %q, want 5 payloads", s.received)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	timeout := 30 * time.Millisecond
+	s := newSim(t, link.Config{
+		Rendezvous: rendezvous,
+		Channels:   []byte{40, 50},
+		Timeout:    timeout,
+	})
+	s.start(t)
+	s.link(t, 10)
+	working := s.controller.Channel()
+
+	// Out of range: nothing gets through for longer than Timeout.
+	s.air.Drop = func(from, to *emulator.Chip) bool { return true }
+	deadline := time.Now().Add(3 * timeout)
+	for time.Now().Before(deadline) {
+		s.send(t, []byte("lost"))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s.controller.State() != link.StateRendezvous {
+		t.Errorf("controller %s, want rendezvous", s.controller.State())
+	}
+
+	// The receiver scans again, one channel per Receive, some of them
+	// were sampled already during the outage.
+	if s.receiver.State() != link.StateScanning {
+		t.Fatalf("receiver %s, want scanning", s.receiver.State())
+	}
+	calls := 0
+	for s.receiver.State() == link.StateScanning {
+		start := time.Now()
+		s.receive(t)
+		if d := time.Since(start); d > 20*time.Millisecond {
+			t.Fatalf("Receive took %s while scanning", d)
+		}
+		calls++
+	}
+	if s.receiver.State() != link.StateRendezvous || calls > 2*10 {
+		t.Errorf("receiver %s after %d calls, want rendezvous after 2 channels * 10 sweeps",
+			s.receiver.State(), calls)
+	}
+
+	// Back in range, the handshake starts again.
+	s.air.Drop = nil
+	s.link(t, 10)
+	if s.controller.State() != link.StateLinked || s.controller.Channel() == rendezvous {
+		t.Errorf("controller %s on %d after fallback, was on %d",
+			s.controller.State(), s.controller.Channel(), working)
+	}
+}
+
+func TestNotLinked(t *testing.T) {
+	s := newSim(t, link.Config{Rendezvous: rendezvous, Channels: []byte{60}})
+	// Only the controller, nobody answers on the rendezvous channel.
+	err := s.controller.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.controller.Send([]byte("hello?"))
+	if err != link.ErrNotLinked {
+		t.Errorf("err %v, want ErrNotLinked", err)
+	}
+}
+
+func TestMultiplePipes(t *testing.T) {
+	config := link.Config{Rendezvous: rendezvous, Pipes: []byte{0, 1}}
+	s := newSim(t, config)
+	s.start(t)
+	if s.receiver.Channel() != rendezvous {
+		t.Fatalf("receiver with two pipes on %d, want rendezvous %d", s.receiver.Channel(), rendezvous)
+	}
+
+	// The second controller sends to pipe 1.
+	secondConfig := emutest.Config([]byte("LINK1"))
+	secondConfig.Channel = rendezvous
+	second := link.NewController(emutest.Radio(t, s.air, "second", secondConfig), config)
+	err := second.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.link(t, 10)
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	for i := 0; i < 10; i++ {
+		second.Send([]byte("second"))
+		s.send(t, []byte("first"))
+		for {
+			pipe, n, ok, err := s.receiver.ReceiveFrom(buf[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				break
+			}
+			if pipe == 1 && string(buf[:n]) != "second" {
+				t.Errorf("pipe 1: %q", buf[:n])
+			}
+		}
+	}
+	if s.receiver.PipeStats(1).Packets == 0 || s.receiver.PipeStats(0).Packets == 0 {
+		t.Errorf("pipe 0 %s, pipe 1 %s", s.receiver.PipeStats(0), s.receiver.PipeStats(1))
+	}
+}
+
+func TestPipesDataLikeFrames(t *testing.T) {
+	// With several pipes the working channel is the rendezvous channel:
+	// one byte payloads go out as [seq, seq>>8, data], every sequence
+	// number must get through, also 0x01A7 and 0x03A7.
+	config := link.Config{Rendezvous: rendezvous, Pipes: []byte{0, 1}}
+	s := newSim(t, config)
+	s.start(t)
+	s.link(t, 10)
+	s.received = nil
+	s.receiver.ResetStats()
+
+	const packets = 0x03A7 + 8
+	for i := 0; i < packets; i++ {
+		if !s.send(t, []byte{rendezvous}) {
+			t.Fatalf("packet %d not delivered", i)
+		}
+	}
+	stats := s.receiver.Stats()
+	if len(s.received) != packets || stats.Lost != 0 || stats.Restarts != 0 {
+		t.Errorf("received %d of %d, stats %s", len(s.received), packets, stats)
+	}
+	if s.receiver.State() != link.StateLinked {
+		t.Errorf("receiver %s, want linked", s.receiver.State())
+	}
+}
+
+func TestHopping(t *testing.T) {
+	const (
+		packets = 200
+		lostGap = 7  // every lostGap-th packet is lost
+		lostRun = 40 // packets from lostRun to 2*lostRun are lost, out of range
+	)
+	tests := []struct {
+		name     string
+		mode     link.HopMode
+		interval time.Duration
+		// The receiver misses hops: per packet the controller hops only
+		// after ACK, per slot the lost run is longer than Timeout.
+		missed bool
+	}{
+		{"per packet", link.HopPerPacket, 0, false},
+		{"per slot", link.HopPerSlot, 2 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSim(t, link.Config{
+				Hop:         tt.mode,
+				Seed:        0x5EED,
+				HopCount:    8,
+				Slot:        20 * time.Millisecond,
+				Timeout:     60 * time.Millisecond,
+				SendTimeout: 5 * time.Millisecond,
+			})
+			sent := 0
+			s.air.Drop = func(from, to *emulator.Chip) bool {
+				if from.Name != "controller" {
+					return false // ACK
+				}
+				return sent%lostGap == 0 || sent >= lostRun && sent < 2*lostRun
+			}
+			s.start(t)
+
+			for sent = 1; sent <= packets; sent++ {
+				// The receiver hops on its own clock in HopPerSlot.
+				s.receive(t)
+				s.send(t, []byte{byte(sent)})
+				time.Sleep(tt.interval)
+			}
+
+			controller, receiver := s.controller.HopStats(), s.receiver.HopStats()
+			stats := s.receiver.Stats()
+			t.Logf("controller %+v, receiver %+v", controller, receiver)
+			if s.receiver.State() != link.StateLinked || len(s.received) < packets/2 {
+				t.Errorf("receiver %s, received %d of %d", s.receiver.State(), len(s.received), packets)
+			}
+			// Every received payload is counted once.
+			if stats.Packets != len(s.received) || stats.Duplicates != 0 || receiver.Packets < len(s.received) {
+				t.Errorf("receiver stats %s, %d received", stats, len(s.received))
+			}
+			if controller.Missed == 0 || tt.missed && (receiver.Missed == 0 || receiver.Resyncs < 2) {
+				t.Errorf("losses not counted: controller %+v, receiver %+v", controller, receiver)
+			}
+		})
+	}
+}
+
+func TestHopLostAck(t *testing.T) {
+	// The receiver gets packet lost and hops, but all its ACKs are lost:
+	// the controller finds it on the next hop, long before Timeout.
+	const (
+		packets = 20
+		lost    = 5
+	)
+	s := newSim(t, link.Config{
+		Hop:         link.HopPerPacket,
+		Seed:        0x5EED,
+		HopCount:    8,
+		Timeout:     time.Second,
+		SendTimeout: 5 * time.Millisecond,
+	})
+	sent := 0
+	s.air.Drop = func(from, to *emulator.Chip) bool {
+		return from.Name == "receiver" && sent == lost
+	}
+	s.start(t)
+
+	delivered := 0
+	for sent = 1; sent <= packets; sent++ {
+		if s.send(t, []byte{byte(sent)}) {
+			delivered++
+		}
+	}
+	if delivered != packets-1 {
+		t.Errorf("%d of %d delivered, want all but the one without ACK", delivered, packets)
+	}
+	if len(s.received) != packets {
+		t.Fatalf("received %d of %d", len(s.received), packets)
+	}
+	for i, p := range s.received {
+		if p[0] != byte(i+1) {
+			t.Errorf("payload %d: %d, want %d", i, p[0], i+1)
+		}
+	}
+}
+
+func TestControllerRestart(t *testing.T) {
+	// With several pipes the receiver stays on the rendezvous channel,
+	// a restarted controller links again before Timeout.
+	config := link.Config{Rendezvous: rendezvous, Pipes: []byte{0, 1}}
+	s := newSim(t, config)
+	s.start(t)
+	s.link(t, 10)
+	for i := 0; i < 20; i++ {
+		s.send(t, []byte("before"))
+	}
+
+	s.controller = link.NewController(emutest.Radio(t, s.air, "restarted", radioConfig()), config)
+	err := s.controller.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.link(t, 10)
+	s.received = nil
+	for i := 0; i < 5; i++ {
+		s.send(t, []byte("after"))
+	}
+	stats := s.receiver.Stats()
+	if len(s.received) != 5 || stats.Reordered != 0 {
+		t.Errorf("after restart received %d of 5, stats %s", len(s.received), stats)
+	}
+}
@@ -0,0 +1,313 @@
+package link
+
+import (
+	"encoding/binary"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// Receiver is the side of the link that selects the channel (the vehicle).
+// The radio works in RX mode.
+type Receiver struct {
+	nrf    *nrf24l01.Device
+	config Config
+
+	state   State
+	channel byte      // working channel
+	last    time.Time // last packet on the working channel
+	hop     hopper
+	stats   [nrf24l01.MaxPipe + 1]counters // per pipe
+	pipe    byte                           // pipe of the last payload
+	scan    nrf24l01.ChannelReport         // StateScanning: hits so far
+	scanned int                            // StateScanning: channels sampled
+
+	buf [nrf24l01.MaxPayloadWidth]byte
+}
+
+// NewReceiver returns receiver side of the link. Call Start before Receive.
+func NewReceiver(nrf *nrf24l01.Device, config Config) *Receiver {
+	return &Receiver{
+		nrf:    nrf,
+		config: config.withDefaults(),
+	}
+}
+
+// Start scans candidate channels, selects the quietest one and waits
+// for the controller on the rendezvous channel.
+// Scanning takes len(Channels) * Dwell * Sweeps.
+//
+// With Config.Hop it tunes to the first hop and waits for the controller.
+// With several Config.Pipes it works on the rendezvous channel.
+func (r *Receiver) Start() error {
+	for _, pipe := range r.config.Pipes {
+		if pipe > nrf24l01.MaxPipe {
+			return nrf24l01.ErrInvalidPipe
+		}
+	}
+	if r.config.Hop != HopOff {
+		return r.startHopping()
+	}
+	err := r.startScan()
+	for err == nil && r.state == StateScanning {
+		err = r.scanNext()
+	}
+	return err
+}
+
+// startScan starts the scan of candidate channels, see scanNext.
+// With several pipes there is nothing to scan, it goes to rendezvous.
+func (r *Receiver) startScan() error {
+	if len(r.config.Pipes) > 1 {
+		r.channel = r.config.Rendezvous
+		return r.rendezvous()
+	}
+	candidates := r.config.candidates()
+	if len(candidates) == 0 {
+		return ErrInvalidChannel
+	}
+	r.state = StateScanning
+	r.scan = nrf24l01.ChannelReport{
+		Channels: candidates,
+		Hits:     make([]int, len(candidates)),
+		Sweeps:   r.config.Sweeps,
+	}
+	r.scanned = 0
+	return nil
+}
+
+// scanNext samples the next channel of the scan, it takes Config.Dwell.
+// After the last one it selects the quietest channel and goes to rendezvous.
+func (r *Receiver) scanNext() error {
+	i := r.scanned % len(r.scan.Channels)
+	report, err := r.nrf.Scan(r.scan.Channels[i:i+1], r.config.Dwell, 1)
+	if err != nil {
+		return err
+	}
+	r.scan.Hits[i] += report.Hits[0]
+	r.scanned++
+	if r.scanned < len(r.scan.Channels)*r.scan.Sweeps {
+		return nil
+	}
+	r.channel = r.scan.Quietest()
+	return r.rendezvous()
+}
+
+// State returns current state of the link.
+func (r *Receiver) State() State {
+	return r.state
+}
+
+// Channel returns the selected working channel, or the current hop.
+func (r *Receiver) Channel() byte {
+	return r.channel
+}
+
+// Receive returns the next application payload.
+//
+// Handshake frames are handled inside. Duplicate and late payloads are
+// dropped, see Stats. ok is false when there is nothing
+// to read. When the link is lost (no packets for Config.Timeout) the
+// receiver goes to StateScanning: every call samples one channel, in
+// Config.Dwell, and after the last one the receiver goes back to
+// rendezvous. So Receive must be called at least as often as Timeout.
+func (r *Receiver) Receive(buf []byte) (n int, ok bool, err error) {
+	_, n, ok, err = r.ReceiveFrom(buf)
+	return n, ok, err
+}
+
+// ReceiveFrom is Receive that returns also the pipe of the payload,
+// it tells the controller with several Config.Pipes.
+func (r *Receiver) ReceiveFrom(buf []byte) (pipe byte, n int, ok bool, err error) {
+	if r.config.Hop != HopOff {
+		return r.receiveHopping(buf)
+	}
+	if r.state == StateScanning {
+		return 0, 0, false, r.scanNext()
+	}
+	for {
+		p, size, ok, err := r.nrf.Receive(r.buf[:])
+		if err != nil {
+			return 0, 0, false, err
+		}
+		if !ok {
+			break
+		}
+		pipe = byte(p)
+
+		kind, channel, isFrame := parseFrame(r.buf[:size])
+		if r.state == StateLinked && !(isFrame && r.channel == r.config.Rendezvous) {
+			r.last = time.Now()
+			ok, err = r.accept(pipe, r.buf[:size])
+			if err != nil {
+				return 0, 0, false, err
+			}
+			if !ok {
+				continue
+			}
+			return pipe, copy(buf, r.buf[seqHeader:size]), true, nil
+		}
+
+		if !isFrame {
+			// Old payload from the working channel.
+			continue
+		}
+		err = r.handle(kind, channel, pipe)
+		if err != nil {
+			return 0, 0, false, err
+		}
+	}
+
+	if r.state == StateLinked && time.Since(r.last) > r.config.Timeout {
+		r.restart()
+		return 0, 0, false, r.startScan()
+	}
+	return 0, 0, false, nil
+}
+
+// accept checks sequence number of a payload from pipe and counts it
+// in Stats. Returns false if the payload must be dropped.
+func (r *Receiver) accept(pipe byte, data []byte) (bool, error) {
+	if len(data) < seqHeader {
+		return false, nil
+	}
+	// RPD is latched by the packet just received.
+	rpd, err := r.nrf.GetRPD()
+	if err != nil {
+		return false, err
+	}
+	seq := binary.LittleEndian.Uint16(data)
+	if !r.stats[pipe].received(seq, rpd, time.Now()) {
+		return false, nil
+	}
+	r.pipe = pipe
+	return true, nil
+}
+
+// restart counts a restart of the link in Stats of every pipe.
+func (r *Receiver) restart() {
+	for _, pipe := range r.config.Pipes {
+		r.stats[pipe].restart()
+	}
+}
+
+// Reply loads payload, up to 32 bytes, into the ACK of the next packet
+// of the controller of the last payload, see Controller.ReadReply.
+// Only in StateLinked, otherwise ErrNotLinked. Replies are sent in order,
+// when the TX FIFO is full the pending ones are dropped.
+//
+// A hop drops the reply, call Reply after every Receive to keep one loaded.
+func (r *Receiver) Reply(payload []byte) error {
+	if r.state != StateLinked {
+		return ErrNotLinked
+	}
+	fifo, err := r.nrf.GetFIFOStatus()
+	if err != nil {
+		return err
+	}
+	if fifo.TXFull() {
+		err = r.nrf.FlushTX()
+		if err != nil {
+			return err
+		}
+	}
+	return r.nrf.WriteAckPayload(r.pipe, payload)
+}
+
+// Stats returns statistics of received payloads of the first pipe
+// of Config.Pipes.
+func (r *Receiver) Stats() Stats {
+	return r.stats[r.config.Pipes[0]].stats
+}
+
+// PipeStats returns statistics of received payloads of pipe.
+func (r *Receiver) PipeStats(pipe byte) Stats {
+	if pipe > nrf24l01.MaxPipe {
+		return Stats{}
+	}
+	return r.stats[pipe].stats
+}
+
+// ResetStats clears statistics of received payloads.
+func (r *Receiver) ResetStats() {
+	for i := range r.stats {
+		r.stats[i].reset()
+	}
+}
+
+// handle processes a handshake frame from pipe.
+//
+// With several pipes the receiver works on the rendezvous channel,
+// controllers that start later send hello there after the link is up.
+func (r *Receiver) handle(kind, channel, pipe byte) error {
+	if kind == frameHello {
+		// The controller starts the link again, its sequence too.
+		r.stats[pipe].restart()
+
+		// The announce was sent with ACK, load it for the next hello.
+		fifo, err := r.nrf.GetFIFOStatus()
+		if err != nil {
+			return err
+		}
+		if !fifo.TXFull() {
+			return r.nrf.WriteAckPayload(pipe, frame(frameAnnounce, r.channel))
+		}
+		return nil
+	}
+	if r.state != StateRendezvous {
+		return nil
+	}
+	switch kind {
+	case frameConfirm:
+		if channel != r.channel {
+			return nil
+		}
+		r.state = StateLinked
+		r.last = time.Now()
+		if r.channel == r.config.Rendezvous {
+			// Several pipes, announces for the others stay loaded.
+			return nil
+		}
+		err := r.tune(r.channel)
+		if err != nil {
+			return err
+		}
+		// The rest are frames from the rendezvous channel.
+		return r.nrf.FlushRX()
+	}
+	return nil
+}
+
+// rendezvous tunes to the rendezvous channel and loads the announce
+// for the pipes, as many as fit into the TX FIFO.
+func (r *Receiver) rendezvous() error {
+	r.state = StateRendezvous
+	err := r.tune(r.config.Rendezvous)
+	if err != nil {
+		return err
+	}
+	for i, pipe := range r.config.Pipes {
+		if i == txFIFO {
+			break
+		}
+		err = r.nrf.WriteAckPayload(pipe, frame(frameAnnounce, r.channel))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tune switches RX mode to channel, pending ACK payloads are dropped.
+func (r *Receiver) tune(channel byte) error {
+	r.nrf.Disable()
+	err := r.nrf.FlushTX()
+	if err != nil {
+		return err
+	}
+	err = r.nrf.SetRFChannel(channel)
+	if err != nil {
+		return err
+	}
+	return r.nrf.SetRXMode()
+}
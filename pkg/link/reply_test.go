@@ -0,0 +1,125 @@
+package link_test
+
+import (
+	"testing"
+	"time"
+
+	"joystick/pkg/link"
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/protocol"
+)
+
+const (
+	controllerID = 0x01
+	vehicleID    = 0x02
+)
+
+// vehicle reads all payloads of the receiver and replies with telemetry
+// to every one, the first byte of the payload is in Battery.
+func (s *sim) vehicle(t *testing.T, telemetry *protocol.Telemetry) {
+	t.Helper()
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	var reply [protocol.TelemetrySize]byte
+	for {
+		_, ok, err := s.receiver.Receive(buf[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			return
+		}
+		stats := s.receiver.Stats()
+		telemetry.Seq++
+		telemetry.Battery = 7400 - uint16(buf[0])
+		telemetry.Motors[0] = protocol.MotorState(buf[0] % 4)
+		telemetry.Loss = byte(stats.Loss)
+		telemetry.Strong = byte(stats.Strong)
+		telemetry.Marshal(reply[:])
+		err = s.receiver.Reply(reply[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTelemetry(t *testing.T) {
+	const packets = 200
+	tests := []struct {
+		name   string
+		config link.Config
+	}{
+		{"fixed", link.Config{Rendezvous: rendezvous, Channels: []byte{10, 20, 30}}},
+		{"per packet", link.Config{Rendezvous: rendezvous, Hop: link.HopPerPacket, Seed: 0x5EED, HopCount: 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Timeout = 60 * time.Millisecond
+			tt.config.SendTimeout = 5 * time.Millisecond
+			tt.config.Dwell = time.Millisecond
+			tt.config.Sweeps = 1
+			s := newSim(t, tt.config)
+			// Every 5th packet or ACK is lost.
+			turn := 0
+			s.air.Drop = func(from, to *emulator.Chip) bool {
+				turn++
+				return turn%5 == 0
+			}
+			s.start(t)
+
+			telemetry := protocol.Telemetry{Sender: vehicleID, Target: controllerID, Control: controllerID}
+			var last protocol.Telemetry
+			var buf [nrf24l01.MaxPayloadWidth]byte
+			replies := 0
+			for sent := 1; sent <= packets; sent++ {
+				s.vehicle(t, &telemetry)
+				_, err := s.controller.Send([]byte{byte(sent)})
+				if err != nil && err != link.ErrNotLinked && err != nrf24l01.ErrMaxRetries {
+					t.Fatal(err)
+				}
+				s.vehicle(t, &telemetry)
+
+				// The reply is for a packet sent before.
+				n, ok := s.controller.ReadReply(buf[:])
+				if !ok {
+					continue
+				}
+				var got protocol.Telemetry
+				err = got.Unmarshal(buf[:n])
+				if err != nil {
+					t.Fatalf("reply %x: %v", buf[:n], err)
+				}
+				sentByte := byte(7400 - got.Battery)
+				if got.Sender != vehicleID || got.Target != controllerID || got.Control != controllerID ||
+					got.Battery > 7400 || int(sentByte) >= sent || got.Motors[0] != protocol.MotorState(sentByte%4) ||
+					last.Seq != 0 && got.Seq <= last.Seq {
+					t.Fatalf("packet %d: reply %+v after %+v", sent, got, last)
+				}
+				replies++
+				last = got
+			}
+			if replies < packets/2 {
+				t.Errorf("%d replies of %d packets", replies, packets)
+			}
+			if s.receiver.State() != link.StateLinked {
+				t.Errorf("receiver %s, want linked", s.receiver.State())
+			}
+			if _, ok := s.controller.ReadReply(buf[:]); ok {
+				t.Errorf("the reply was read twice")
+			}
+		})
+	}
+}
+
+func TestReplyNotLinked(t *testing.T) {
+	s := newSim(t, link.Config{Rendezvous: rendezvous, Channels: []byte{10}})
+	s.start(t)
+	var reply [protocol.TelemetrySize]byte
+	if err := s.receiver.Reply(reply[:]); err != link.ErrNotLinked {
+		t.Errorf("reply before the link: %v, want ErrNotLinked", err)
+	}
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	if _, ok := s.controller.ReadReply(buf[:]); ok {
+		t.Errorf("reply before the link")
+	}
+}
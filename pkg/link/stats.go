@@ -0,0 +1,189 @@
+package link
+
+import (
+	"math/bits"
+	"strconv"
+	"time"
+)
+
+// Every application payload starts with a sequence number, uint16 little
+// endian, after the hop header with Config.Hop. The controller stamps it,
+// the receiver uses it to find lost, duplicate and late packets.
+const seqHeader = 2
+
+// Rolling statistics cover the last window packets.
+const window = 64
+
+// reorderWindow is how far back a sequence number is taken as a late
+// packet. Older numbers mean the controller was restarted. A restarted
+// controller can also start just behind the last number: two late packets
+// in a row, one after the other, are a restart too. ESB doesn't reorder,
+// so only the first packet of the new sequence is dropped.
+const reorderWindow = window
+
+// resyncGap is the longest jump forward counted as lost packets. A longer
+// one means the controller was restarted or took a new epoch, the
+// sequence started again, like a restart far behind. 1024 packets are
+// over 10s at 100 packets per second, the link is lost long before.
+const resyncGap = 1024
+
+// Stats are statistics of application payloads.
+type Stats struct {
+	Packets    int // sent (controller) or received, without duplicates (receiver)
+	Lost       int // not delivered (controller) or missing sequence numbers (receiver)
+	Duplicates int // receiver: the same sequence number again, dropped
+	Reordered  int // receiver: older than the last packet, dropped
+	Restarts   int // receiver: sequence started again, the controller was restarted or jumped ahead
+
+	// Loss is the rolling loss over the last 64 packets, in %.
+	Loss int
+
+	// Strong is the rolling share of the last 64 packets received with RPD
+	// set (over -64dBm), in %. Receiver only, nRF24L01+ only.
+	Strong int
+
+	// Latency from Send to ACK (controller), or interval between
+	// packets (receiver). Average is a moving average over ~8 packets.
+	Latency    time.Duration
+	LatencyAvg time.Duration
+	LatencyMax time.Duration
+}
+
+// String returns all statistics in one line for the serial log.
+func (s Stats) String() string {
+	return "pkt:" + strconv.Itoa(s.Packets) +
+		" lost:" + strconv.Itoa(s.Lost) +
+		" dup:" + strconv.Itoa(s.Duplicates) +
+		" ooo:" + strconv.Itoa(s.Reordered) +
+		" loss:" + strconv.Itoa(s.Loss) + "%" +
+		" rpd:" + strconv.Itoa(s.Strong) + "%" +
+		" lat:" + strconv.FormatInt(s.LatencyAvg.Milliseconds(), 10) +
+		"/" + strconv.FormatInt(s.LatencyMax.Milliseconds(), 10) + "ms"
+}
+
+// Short returns rolling loss, RPD and average latency, it fits
+// a line of a small display.
+func (s Stats) Short() string {
+	return "loss " + strconv.Itoa(s.Loss) + "%" +
+		" rpd " + strconv.Itoa(s.Strong) + "%" +
+		" " + strconv.FormatInt(s.LatencyAvg.Milliseconds(), 10) + "ms"
+}
+
+// history is a bitmap of the last packets, bit 0 is the newest.
+type history struct {
+	bits uint64
+	n    int // valid bits, up to window
+}
+
+// shift moves history by n packets, the newest one is set to ok.
+// Skipped packets are zeros.
+func (h *history) shift(n int, ok bool) {
+	if n >= window {
+		h.bits = 0
+	} else {
+		h.bits <<= uint(n)
+	}
+	if ok {
+		h.bits |= 1
+	}
+	h.n += n
+	if h.n > window {
+		h.n = window
+	}
+}
+
+// percent returns the share of set bits, in %.
+func (h *history) percent() int {
+	if h.n == 0 {
+		return 0
+	}
+	return bits.OnesCount64(h.bits) * 100 / h.n
+}
+
+// counters keep Stats of one side of the link.
+type counters struct {
+	stats  Stats
+	loss   history // 1 - the packet got through
+	strong history // 1 - RPD set
+	seq    uint16  // last sequence number
+	valid  bool    // seq is valid
+	late   uint16  // sequence number of the last dropped late packet
+	isLate bool    // late is valid, no packet was accepted after it
+	last   time.Time
+}
+
+// latency adds a latency sample.
+func (c *counters) latency(d time.Duration) {
+	s := &c.stats
+	s.Latency = d
+	if s.LatencyAvg == 0 {
+		s.LatencyAvg = d
+	} else {
+		s.LatencyAvg += (d - s.LatencyAvg) / 8
+	}
+	if d > s.LatencyMax {
+		s.LatencyMax = d
+	}
+}
+
+// sent counts a payload sent by the controller.
+func (c *counters) sent(delivered bool, latency time.Duration) {
+	c.stats.Packets++
+	if !delivered {
+		c.stats.Lost++
+	} else {
+		c.latency(latency)
+	}
+	c.loss.shift(1, delivered)
+	c.stats.Loss = 100 - c.loss.percent()
+}
+
+// received checks sequence number of a payload received at now.
+// Returns false if the payload must be dropped.
+func (c *counters) received(seq uint16, rpd bool, now time.Time) bool {
+	diff := seq - c.seq
+	switch {
+	case !c.valid:
+		c.valid = true
+	case diff == 0:
+		c.stats.Duplicates++
+		return false
+	case diff <= resyncGap:
+		// Sequence numbers between are lost.
+		c.stats.Lost += int(diff) - 1
+		c.loss.shift(int(diff)-1, false)
+	case -diff <= reorderWindow && !(c.isLate && seq == c.late+1):
+		c.stats.Reordered++
+		c.late, c.isLate = seq, true
+		return false
+	default:
+		c.stats.Restarts++
+	}
+	c.seq = seq
+	c.isLate = false
+
+	if !c.last.IsZero() {
+		c.latency(now.Sub(c.last))
+	}
+	c.last = now
+
+	c.stats.Packets++
+	c.loss.shift(1, true)
+	c.strong.shift(1, rpd)
+	c.stats.Loss = 100 - c.loss.percent()
+	c.stats.Strong = c.strong.percent()
+	return true
+}
+
+// restart forgets the sequence number and the last packet time,
+// after the link was lost or the controller linked again. Counters are kept.
+func (c *counters) restart() {
+	c.valid = false
+	c.isLate = false
+	c.last = time.Time{}
+}
+
+// reset clears statistics.
+func (c *counters) reset() {
+	*c = counters{seq: c.seq, valid: c.valid}
+}
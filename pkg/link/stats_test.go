@@ -0,0 +1,165 @@
+package link
+
+import (
+	"testing"
+	"time"
+)
+
+// receive passes sequence numbers to c, 10ms apart. Returns the accepted ones.
+func receive(c *counters, seqs ...uint16) []uint16 {
+	var accepted []uint16
+	now := time.Unix(0, 0)
+	if !c.last.IsZero() {
+		now = c.last
+	}
+	for _, seq := range seqs {
+		now = now.Add(10 * time.Millisecond)
+		if c.received(seq, seq%2 == 0, now) {
+			accepted = append(accepted, seq)
+		}
+	}
+	return accepted
+}
+
+func TestReceived(t *testing.T) {
+	tests := []struct {
+		name     string
+		seqs     []uint16
+		accepted int
+		want     Stats
+	}{
+		{
+			name:     "in order",
+			seqs:     []uint16{0, 1, 2, 3},
+			accepted: 4,
+			want:     Stats{Packets: 4, Strong: 50},
+		},
+		{
+			name:     "wrap around",
+			seqs:     []uint16{65534, 65535, 0, 1},
+			accepted: 4,
+			want:     Stats{Packets: 4, Strong: 50},
+		},
+		{
+			name:     "gap",
+			seqs:     []uint16{10, 11, 15, 16},
+			accepted: 4,
+			want:     Stats{Packets: 4, Lost: 3, Loss: 43, Strong: 50},
+		},
+		{
+			name:     "gap over wrap around",
+			seqs:     []uint16{65535, 2},
+			accepted: 2,
+			want:     Stats{Packets: 2, Lost: 2, Loss: 50, Strong: 50},
+		},
+		{
+			name:     "duplicate",
+			seqs:     []uint16{4, 5, 5, 6},
+			accepted: 3,
+			want:     Stats{Packets: 3, Duplicates: 1, Strong: 66},
+		},
+		{
+			name:     "late",
+			seqs:     []uint16{20, 22, 21, 23},
+			accepted: 3,
+			want:     Stats{Packets: 3, Lost: 1, Reordered: 1, Loss: 25, Strong: 66},
+		},
+		{
+			name:     "restart far behind",
+			seqs:     []uint16{1000, 1001, 0, 1},
+			accepted: 4,
+			want:     Stats{Packets: 4, Restarts: 1, Strong: 50},
+		},
+		{
+			name:     "restart just behind",
+			seqs:     []uint16{30, 31, 0, 1, 2, 3},
+			accepted: 5,
+			want:     Stats{Packets: 5, Reordered: 1, Restarts: 1, Strong: 40},
+		},
+		{
+			name:     "longest gap",
+			seqs:     []uint16{0, resyncGap},
+			accepted: 2,
+			want:     Stats{Packets: 2, Lost: resyncGap - 1, Loss: 99, Strong: 100},
+		},
+		{
+			name:     "jump ahead",
+			seqs:     []uint16{100, 101, 101 + resyncGap + 1, 101 + resyncGap + 2},
+			accepted: 4,
+			want:     Stats{Packets: 4, Restarts: 1, Strong: 50},
+		},
+		{
+			name:     "jump ahead over wrap around",
+			seqs:     []uint16{65000, 65001, 2000, 2001},
+			accepted: 4,
+			want:     Stats{Packets: 4, Restarts: 1, Strong: 50},
+		},
+		{
+			name:     "two late packets apart",
+			seqs:     []uint16{40, 45, 42, 44, 46},
+			accepted: 3,
+			want:     Stats{Packets: 3, Lost: 4, Reordered: 2, Loss: 58, Strong: 66},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c counters
+			accepted := receive(&c, tt.seqs...)
+			if len(accepted) != tt.accepted {
+				t.Errorf("accepted %v of %v, want %d", accepted, tt.seqs, tt.accepted)
+			}
+			got := c.stats
+			got.Latency, got.LatencyAvg, got.LatencyMax = 0, 0, 0
+			if got != tt.want {
+				t.Errorf("stats %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestart(t *testing.T) {
+	var c counters
+	receive(&c, 50, 51, 52)
+
+	// The link was lost or the controller sent hello: any number is next.
+	c.restart()
+	accepted := receive(&c, 3, 4)
+	if len(accepted) != 2 || c.stats.Reordered != 0 || c.stats.Restarts != 0 {
+		t.Errorf("after restart accepted %v, stats %+v", accepted, c.stats)
+	}
+	if c.stats.Packets != 5 {
+		t.Errorf("counters not kept: %+v", c.stats)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	var c counters
+	for _, ms := range []time.Duration{10, 10, 30} {
+		c.sent(true, ms*time.Millisecond)
+	}
+	c.sent(false, time.Second)
+	s := c.stats
+	if s.Packets != 4 || s.Lost != 1 || s.Loss != 25 {
+		t.Errorf("sent stats %+v", s)
+	}
+	if s.Latency != 30*time.Millisecond || s.LatencyMax != 30*time.Millisecond || s.LatencyAvg != 12500*time.Microsecond {
+		t.Errorf("latency %v, avg %v, max %v", s.Latency, s.LatencyAvg, s.LatencyMax)
+	}
+}
+
+func TestRollingWindow(t *testing.T) {
+	var c counters
+	// 64 packets with every other one lost, then 64 in a row.
+	for seq := uint16(0); seq < 128; seq += 2 {
+		receive(&c, seq)
+	}
+	if c.stats.Loss != 50 {
+		t.Errorf("loss %d%%, want 50", c.stats.Loss)
+	}
+	for seq := uint16(128); seq < 192; seq++ {
+		receive(&c, seq)
+	}
+	if c.stats.Loss != 0 || c.stats.Lost != 64 {
+		t.Errorf("loss %d%%, lost %d after 64 good packets", c.stats.Loss, c.stats.Lost)
+	}
+}
@@ -0,0 +1,69 @@
+package nrf24l01
+
+// Set address width (SETUP_AW), common for all data pipes and TX_ADDR.
+//
+// width - 3, 4 or 5 bytes.
+func (d *Device) SetAddressWidth(width byte) error {
+	if width < 3 || width > 5 {
+		return ErrInvalidAddress
+	}
+	return d.SetRegisterState(SETUP_AW, width-2)
+}
+
+// Get address width in bytes (SETUP_AW).
+func (d *Device) GetAddressWidth() (byte, error) {
+	aw, err := d.GetRegisterState(SETUP_AW)
+	if err != nil {
+		return 0, err
+	}
+	aw &= 0b11
+	if aw == 0 {
+		// '00' - Illegal
+		return 0, ErrInvalidAddress
+	}
+	return aw + 2, nil
+}
+
+// Set transmit address (TX_ADDR).
+//
+// address - LSByte first. Length must be equal to address width (SETUP_AW).
+//
+// If ‘Auto Acknowledgment’ is enabled for pipe 0, the address is also
+// written to RX_ADDR_P0, PTX receives ACK on pipe 0.
+func (d *Device) SetTXAddress(address []byte) error {
+	width, err := d.GetAddressWidth()
+	if err != nil {
+		return err
+	}
+	if len(address) != int(width) {
+		return ErrInvalidAddress
+	}
+
+	err = d.setRegisterBytes(TX_ADDR, address)
+	if err != nil {
+		return err
+	}
+
+	enAA, err := d.GetRegisterState(EN_AA)
+	if err != nil {
+		return err
+	}
+	if enAA&ENAA_P0 == 0 {
+		return nil
+	}
+	return d.setRegisterBytes(RX_ADDR_P0, address)
+}
+
+// Get transmit address (TX_ADDR), LSByte first.
+func (d *Device) GetTXAddress() ([]byte, error) {
+	width, err := d.GetAddressWidth()
+	if err != nil {
+		return nil, err
+	}
+	address := make([]byte, width)
+	err = d.getRegisterBytes(TX_ADDR, address)
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
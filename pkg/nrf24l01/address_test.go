@@ -0,0 +1,96 @@
+package nrf24l01_test
+
+import (
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+var powerOnAddress = []byte{0xE7, 0xE7, 0xE7, 0xE7, 0xE7}
+
+func TestAddressWidth(t *testing.T) {
+	tests := []struct {
+		width byte
+		aw    byte // want: SETUP_AW
+		err   error
+	}{
+		{0, 0x03, nrf24l01.ErrInvalidAddress},
+		{2, 0x03, nrf24l01.ErrInvalidAddress},
+		{3, 0x01, nil},
+		{4, 0x02, nil},
+		{5, 0x03, nil},
+		{6, 0x03, nrf24l01.ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		nrf, chip := emutest.PowerOn("chip")
+		err := nrf.SetAddressWidth(tt.width)
+		if err != tt.err {
+			t.Errorf("SetAddressWidth(%d) = %v, want %v", tt.width, err, tt.err)
+		}
+		if got := chip.Register(nrf24l01.SETUP_AW); got != tt.aw {
+			t.Errorf("width %d: SETUP_AW = %#x, want %#x", tt.width, got, tt.aw)
+		}
+		width, err := nrf.GetAddressWidth()
+		if err != nil || width != tt.aw+2 {
+			t.Errorf("width %d: GetAddressWidth() = %d, %v", tt.width, width, err)
+		}
+	}
+
+	// '00' is illegal.
+	nrf, _ := emutest.PowerOn("chip")
+	err := nrf.SetRegisterState(nrf24l01.SETUP_AW, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nrf.GetAddressWidth(); err != nrf24l01.ErrInvalidAddress {
+		t.Errorf("SETUP_AW 0: %v, want ErrInvalidAddress", err)
+	}
+}
+
+func TestTXAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		width   byte
+		enAA    byte
+		address []byte
+		err     error
+		tx      []byte // want: TX_ADDR
+		p0      []byte // want: RX_ADDR_P0
+	}{
+		{"mirrored", 5, 0x3F, []byte("ADDR0"), nil, []byte("ADDR0"), []byte("ADDR0")},
+		{"3 bytes mirrored", 3, 0x01, []byte{1, 2, 3}, nil, []byte{1, 2, 3}, []byte{1, 2, 3}},
+		{"no auto-ack on pipe 0", 5, 0x3E, []byte("ADDR0"), nil, []byte("ADDR0"), powerOnAddress},
+		{"no auto-ack", 4, 0x00, []byte{1, 2, 3, 4}, nil, []byte{1, 2, 3, 4}, powerOnAddress[:4]},
+		{"short", 5, 0x3F, []byte("ADDR"), nrf24l01.ErrInvalidAddress, powerOnAddress, powerOnAddress},
+		{"long", 3, 0x3F, []byte("ADDR"), nrf24l01.ErrInvalidAddress, powerOnAddress[:3], powerOnAddress[:3]},
+		{"nil", 5, 0x3F, nil, nrf24l01.ErrInvalidAddress, powerOnAddress, powerOnAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, chip := emutest.PowerOn("chip")
+			err := nrf.SetAddressWidth(tt.width)
+			if err == nil {
+				err = nrf.SetRegisterState(nrf24l01.EN_AA, tt.enAA)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = nrf.SetTXAddress(tt.address)
+			if err != tt.err {
+				t.Errorf("SetTXAddress(%x) = %v, want %v", tt.address, err, tt.err)
+			}
+			if got := chip.Address(nrf24l01.TX_ADDR); string(got) != string(tt.tx) {
+				t.Errorf("TX_ADDR = %x, want %x", got, tt.tx)
+			}
+			if got := chip.Address(nrf24l01.RX_ADDR_P0); string(got) != string(tt.p0) {
+				t.Errorf("RX_ADDR_P0 = %x, want %x", got, tt.p0)
+			}
+			got, err := nrf.GetTXAddress()
+			if err != nil || string(got) != string(tt.tx) {
+				t.Errorf("GetTXAddress() = %x, %v, want %x", got, err, tt.tx)
+			}
+		})
+	}
+}
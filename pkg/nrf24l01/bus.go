@@ -0,0 +1,20 @@
+package nrf24l01
+
+// SPI is the bus used to talk with the radio.
+// *machine.SPI satisfies it on TinyGo targets, on the host it can be
+// replaced by a fake or an emulated chip.
+type SPI interface {
+	// Transfer writes one byte and returns the byte read at the same time.
+	Transfer(w byte) (byte, error)
+
+	// Tx writes w and reads into r. Any of them can be nil,
+	// but if both are set they must have the same length.
+	Tx(w, r []byte) error
+}
+
+// Pin is a digital output driven by the driver (CE and CSN).
+// machine.Pin satisfies it on TinyGo targets.
+type Pin interface {
+	High()
+	Low()
+}
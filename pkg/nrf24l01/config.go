@@ -0,0 +1,255 @@
+package nrf24l01
+
+import (
+	"strconv"
+)
+
+// Maximum RF channel. F0 = 2400 + RF_CH [MHz].
+const MaxChannel = 125
+
+// DataRate is the air data rate, RF_DR_LOW and RF_DR_HIGH bits of RF_SETUP.
+type DataRate byte
+
+const (
+	DataRate1Mbps   DataRate = 0
+	DataRate2Mbps   DataRate = RF_SETUP_RF_DR_HIGH
+	DataRate250Kbps DataRate = RF_SETUP_RF_DR_LOW
+)
+
+// PALevel is the RF output power in TX mode, RF_PWR bits of RF_SETUP.
+type PALevel byte
+
+const (
+	PALevelMin  PALevel = 0b00000000 // -18dBm
+	PALevelLow  PALevel = 0b00000010 // -12dBm
+	PALevelHigh PALevel = 0b00000100 // -6dBm
+	PALevelMax  PALevel = 0b00000110 // 0dBm
+)
+
+// CRCLength is the CRC encoding scheme, EN_CRC and CRCO bits of CONFIG.
+type CRCLength byte
+
+const (
+	CRCDisabled CRCLength = 0
+	CRC8        CRCLength = CONFIG_EN_CRC
+	CRC16       CRCLength = CONFIG_EN_CRC | CONFIG_CRCO
+)
+
+// Config is the full setup of the radio. Both sides of a link can share
+// the same value, differences are only in TX/RX mode.
+type Config struct {
+	Channel      byte      // RF_CH, 0 to 125
+	DataRate     DataRate  // RF_SETUP
+	PALevel      PALevel   // RF_SETUP
+	CRC          CRCLength // CONFIG
+	AddressWidth byte      // SETUP_AW, 3 to 5 bytes
+
+	// TX_ADDR, AddressWidth bytes, LSByte first. nil keeps the current address.
+	// If pipe 0 has AutoAck and no Address, TXAddress is written to RX_ADDR_P0
+	// too, PTX receives ACK on pipe 0.
+	TXAddress []byte
+
+	Pipes [6]Pipe
+
+	RetryDelay byte // SETUP_RETR.ARD, 0 to 15: (RetryDelay+1)*250µs
+	RetryCount byte // SETUP_RETR.ARC, 0 to 15
+
+	DynamicPayload bool // FEATURE.EN_DPL
+	AckPayload     bool // FEATURE.EN_ACK_PAY
+	DynamicAck     bool // FEATURE.EN_DYN_ACK
+
+	// Interrupts not reflected on the IRQ pin.
+	// Any combination of CONFIG_MASK_RX_DR, CONFIG_MASK_TX_DS and CONFIG_MASK_MAX_RT.
+	InterruptMask byte
+}
+
+// Validate returns error if config can't be applied.
+func (c *Config) Validate() error {
+	if c.Channel > MaxChannel {
+		return ErrInvalidChannel
+	}
+	if c.AddressWidth < 3 || c.AddressWidth > 5 {
+		return ErrInvalidAddress
+	}
+	if c.TXAddress != nil && len(c.TXAddress) != int(c.AddressWidth) {
+		return ErrInvalidAddress
+	}
+	switch c.DataRate {
+	case DataRate1Mbps, DataRate2Mbps, DataRate250Kbps:
+	default:
+		return ErrInvalidConfig
+	}
+	if c.PALevel&^RF_SETUP_RF_PWR != 0 ||
+		c.RetryDelay > 15 || c.RetryCount > 15 ||
+		c.InterruptMask&^CONFIG_MASK_IRQ != 0 {
+		return ErrInvalidConfig
+	}
+	switch c.CRC {
+	case CRCDisabled, CRC8, CRC16:
+	default:
+		return ErrInvalidConfig
+	}
+
+	for i, p := range c.Pipes {
+		switch {
+		case p.Address == nil:
+		case i < 2 && len(p.Address) != int(c.AddressWidth):
+			return ErrInvalidAddress
+		case i >= 2 && len(p.Address) != 1:
+			return ErrInvalidAddress
+		}
+		if p.PayloadWidth > MaxPayloadWidth {
+			return ErrPayloadTooLarge
+		}
+		// RX_PW_Px = 0 is a pipe not used, it never receives.
+		if p.Enabled && !p.DynamicPayload && p.PayloadWidth == 0 {
+			return ErrInvalidPayloadWidth
+		}
+		// EN_CRC is forced high by EN_AA.
+		if p.AutoAck && c.CRC == CRCDisabled {
+			return ErrInvalidConfig
+		}
+		if p.DynamicPayload && !c.DynamicPayload {
+			return ErrInvalidConfig
+		}
+	}
+	if c.AckPayload && !c.DynamicPayload {
+		return ErrInvalidConfig
+	}
+	return nil
+}
+
+// Apply writes config into the radio and reads every register back.
+//
+// The radio is set to power down mode (CE low) for writing and stays
+// there, use SetTXMode or SetRXMode after it.
+// Returns *VerifyError if any register is different after writing.
+func (d *Device) Apply(c Config) error {
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+
+	d.Disable()
+	err = d.SetPowerDownMode()
+	if err != nil {
+		return err
+	}
+
+	regs := c.registers()
+	for _, r := range regs {
+		err = d.setRegisterBytes(r.register, r.state)
+		if err != nil {
+			return err
+		}
+	}
+
+	var read [5]byte
+	for _, r := range regs {
+		got := read[:len(r.state)]
+		err = d.getRegisterBytes(r.register, got)
+		if err != nil {
+			return err
+		}
+		if string(got) != string(r.state) {
+			return &VerifyError{
+				Register: r.register,
+				Written:  r.state,
+				Read:     append([]byte(nil), got...),
+			}
+		}
+	}
+
+	return nil
+}
+
+// registerState is a value for one register.
+type registerState struct {
+	register byte
+	state    []byte
+}
+
+// registers returns all register values of config, in write order.
+func (c *Config) registers() []registerState {
+	var enAA, enRXAddr, dynpd, feature byte
+	for i, p := range c.Pipes {
+		if p.AutoAck {
+			enAA |= 1 << i
+		}
+		if p.Enabled {
+			enRXAddr |= 1 << i
+		}
+		if p.DynamicPayload {
+			dynpd |= 1 << i
+		}
+	}
+	if c.DynamicPayload {
+		feature |= FEATURE_EN_DPL
+	}
+	if c.AckPayload {
+		feature |= FEATURE_EN_ACK_PAY
+	}
+	if c.DynamicAck {
+		feature |= FEATURE_EN_DYN_ACK
+	}
+
+	regs := []registerState{
+		{CONFIG, []byte{c.InterruptMask | byte(c.CRC)}}, // PWR_UP = 0, PRIM_RX = 0
+		{EN_AA, []byte{enAA}},
+		{EN_RXADDR, []byte{enRXAddr}},
+		{SETUP_AW, []byte{c.AddressWidth - 2}},
+		{SETUP_RETR, []byte{c.RetryDelay<<4 | c.RetryCount}},
+		{RF_CH, []byte{c.Channel}},
+		{RF_SETUP, []byte{byte(c.DataRate) | byte(c.PALevel)}},
+	}
+	if c.TXAddress != nil {
+		regs = append(regs, registerState{TX_ADDR, c.TXAddress})
+	}
+	for i, p := range c.Pipes {
+		switch {
+		case p.Address != nil:
+			regs = append(regs, registerState{GetPipesRXAddressRegisters()[i], p.Address})
+		case i == 0 && p.AutoAck && c.TXAddress != nil:
+			regs = append(regs, registerState{RX_ADDR_P0, c.TXAddress})
+		}
+		regs = append(regs, registerState{GetPipesRXPayloadWidthRegisters()[i], []byte{p.PayloadWidth}})
+	}
+	regs = append(regs,
+		registerState{FEATURE, []byte{feature}},
+		registerState{DYNPD, []byte{dynpd}},
+	)
+	return regs
+}
+
+// setRegisterBytes writes multi-byte register, LSByte first.
+func (d *Device) setRegisterBytes(r byte, s []byte) error {
+	d.csn.Low()
+	defer d.csn.High()
+	_, err := d.spi.Transfer(W_REGISTER | r)
+	if err == nil {
+		err = d.spi.Tx(s, nil)
+	}
+	return busError(opWrite, r, err)
+}
+
+// getRegisterBytes reads multi-byte register, LSByte first.
+func (d *Device) getRegisterBytes(r byte, s []byte) error {
+	d.csn.Low()
+	defer d.csn.High()
+	_, err := d.spi.Transfer(R_REGISTER | r)
+	if err == nil {
+		err = d.spi.Tx(nil, s)
+	}
+	return busError(opRead, r, err)
+}
+
+func hexBytes(b []byte) string {
+	res := "0x"
+	for _, v := range b {
+		if v < 0x10 {
+			res += "0"
+		}
+		res += strconv.FormatUint(uint64(v), 16)
+	}
+	return res
+}
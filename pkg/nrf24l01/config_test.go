@@ -0,0 +1,227 @@
+package nrf24l01_test
+
+import (
+	"errors"
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+var testAddress = []byte("IRQT0")
+
+// testConfig is a link with auto-ack and dynamic payload on pipe 0.
+func testConfig() nrf24l01.Config {
+	return nrf24l01.Config{
+		Channel:      40,
+		DataRate:     nrf24l01.DataRate2Mbps,
+		CRC:          nrf24l01.CRC16,
+		AddressWidth: 5,
+		TXAddress:    testAddress,
+		Pipes: [6]nrf24l01.Pipe{
+			{Enabled: true, AutoAck: true, DynamicPayload: true, Address: testAddress},
+		},
+		RetryCount:     2,
+		DynamicPayload: true,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *nrf24l01.Config)
+		want   error
+	}{
+		{"valid", func(c *nrf24l01.Config) {}, nil},
+		{"channel 125", func(c *nrf24l01.Config) { c.Channel = 125 }, nil},
+		{"channel 126", func(c *nrf24l01.Config) { c.Channel = 126 }, nrf24l01.ErrInvalidChannel},
+		{"address width 2", func(c *nrf24l01.Config) { c.AddressWidth = 2 }, nrf24l01.ErrInvalidAddress},
+		{"address width 6", func(c *nrf24l01.Config) { c.AddressWidth = 6 }, nrf24l01.ErrInvalidAddress},
+		{"short TX address", func(c *nrf24l01.Config) { c.TXAddress = testAddress[:4] }, nrf24l01.ErrInvalidAddress},
+		{"nil TX address", func(c *nrf24l01.Config) { c.TXAddress = nil }, nil},
+		{"data rate", func(c *nrf24l01.Config) { c.DataRate = nrf24l01.DataRate2Mbps | nrf24l01.DataRate250Kbps }, nrf24l01.ErrInvalidConfig},
+		{"PA level", func(c *nrf24l01.Config) { c.PALevel = 1 }, nrf24l01.ErrInvalidConfig},
+		{"retry delay", func(c *nrf24l01.Config) { c.RetryDelay = 16 }, nrf24l01.ErrInvalidConfig},
+		{"retry count", func(c *nrf24l01.Config) { c.RetryCount = 16 }, nrf24l01.ErrInvalidConfig},
+		{"interrupt mask", func(c *nrf24l01.Config) { c.InterruptMask = 0x01 }, nrf24l01.ErrInvalidConfig},
+		{"CRC", func(c *nrf24l01.Config) { c.CRC = nrf24l01.CRCLength(nrf24l01.CONFIG_CRCO) }, nrf24l01.ErrInvalidConfig},
+		{"auto-ack without CRC", func(c *nrf24l01.Config) { c.CRC = nrf24l01.CRCDisabled }, nrf24l01.ErrInvalidConfig},
+		{"dynamic pipe without EN_DPL", func(c *nrf24l01.Config) { c.DynamicPayload = false }, nrf24l01.ErrInvalidConfig},
+		{"ACK payload without EN_DPL", func(c *nrf24l01.Config) {
+			c.Pipes[0].DynamicPayload = false
+			c.Pipes[0].PayloadWidth = 4
+			c.DynamicPayload = false
+			c.AckPayload = true
+		}, nrf24l01.ErrInvalidConfig},
+		{"pipe 1 full address", func(c *nrf24l01.Config) { c.Pipes[1].Address = []byte("IRQT1") }, nil},
+		{"pipe 1 short address", func(c *nrf24l01.Config) { c.Pipes[1].Address = []byte{1} }, nrf24l01.ErrInvalidAddress},
+		{"pipe 2 LSByte", func(c *nrf24l01.Config) { c.Pipes[2].Address = []byte{2} }, nil},
+		{"pipe 2 full address", func(c *nrf24l01.Config) { c.Pipes[2].Address = []byte("IRQT2") }, nrf24l01.ErrInvalidAddress},
+		{"payload width 32", func(c *nrf24l01.Config) { c.Pipes[3].PayloadWidth = 32 }, nil},
+		{"payload width 33", func(c *nrf24l01.Config) { c.Pipes[3].PayloadWidth = 33 }, nrf24l01.ErrPayloadTooLarge},
+		{"static pipe without width", func(c *nrf24l01.Config) { c.Pipes[0].DynamicPayload = false }, nrf24l01.ErrInvalidPayloadWidth},
+		{"static pipe width 1", func(c *nrf24l01.Config) {
+			c.Pipes[0].DynamicPayload = false
+			c.Pipes[0].PayloadWidth = 1
+		}, nil},
+		{"disabled pipe without width", func(c *nrf24l01.Config) { c.Pipes[0].Enabled = false; c.Pipes[0].DynamicPayload = false }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testConfig()
+			tt.change(&c)
+			err := c.Validate()
+			if err != tt.want {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	full := testConfig()
+	full.PALevel = nrf24l01.PALevelHigh
+	full.RetryDelay = 5
+	full.AckPayload = true
+	full.DynamicAck = true
+	full.InterruptMask = nrf24l01.CONFIG_MASK_MAX_RT
+	full.Pipes[1] = nrf24l01.Pipe{Enabled: true, PayloadWidth: 8, Address: []byte("IRQT1")}
+	full.Pipes[4] = nrf24l01.Pipe{Enabled: true, AutoAck: true, DynamicPayload: true, Address: []byte{0x44}}
+
+	tests := []struct {
+		name   string
+		config nrf24l01.Config
+		regs   map[byte]byte   // single byte registers
+		addrs  map[byte][]byte // address registers
+	}{
+		{
+			name:   "pipe 0",
+			config: testConfig(),
+			regs: map[byte]byte{
+				nrf24l01.CONFIG:     byte(nrf24l01.CRC16),
+				nrf24l01.EN_AA:      0x01,
+				nrf24l01.EN_RXADDR:  0x01,
+				nrf24l01.SETUP_AW:   0x03,
+				nrf24l01.SETUP_RETR: 0x02,
+				nrf24l01.RF_CH:      40,
+				nrf24l01.RF_SETUP:   byte(nrf24l01.DataRate2Mbps),
+				nrf24l01.FEATURE:    nrf24l01.FEATURE_EN_DPL,
+				nrf24l01.DYNPD:      0x01,
+			},
+			addrs: map[byte][]byte{
+				nrf24l01.TX_ADDR:    testAddress,
+				nrf24l01.RX_ADDR_P0: testAddress,
+			},
+		},
+		{
+			name: "TX address mirrored into pipe 0",
+			config: func() nrf24l01.Config {
+				c := testConfig()
+				c.Pipes[0].Address = nil
+				return c
+			}(),
+			addrs: map[byte][]byte{
+				nrf24l01.RX_ADDR_P0: testAddress,
+			},
+		},
+		{
+			name: "TX address not mirrored without auto-ack",
+			config: func() nrf24l01.Config {
+				c := testConfig()
+				c.Pipes[0].Address = nil
+				c.Pipes[0].AutoAck = false
+				return c
+			}(),
+			regs: map[byte]byte{
+				nrf24l01.EN_AA: 0x00,
+			},
+			addrs: map[byte][]byte{
+				nrf24l01.TX_ADDR:    testAddress,
+				nrf24l01.RX_ADDR_P0: powerOnAddress,
+			},
+		},
+		{
+			name:   "all options",
+			config: full,
+			regs: map[byte]byte{
+				nrf24l01.CONFIG:     byte(nrf24l01.CRC16) | nrf24l01.CONFIG_MASK_MAX_RT,
+				nrf24l01.EN_AA:      0x11,
+				nrf24l01.EN_RXADDR:  0x13,
+				nrf24l01.SETUP_RETR: 0x52,
+				nrf24l01.RF_SETUP:   byte(nrf24l01.DataRate2Mbps) | byte(nrf24l01.PALevelHigh),
+				nrf24l01.RX_PW_P1:   8,
+				nrf24l01.RX_ADDR_P4: 0x44,
+				nrf24l01.FEATURE:    nrf24l01.FEATURE_EN_DPL | nrf24l01.FEATURE_EN_ACK_PAY | nrf24l01.FEATURE_EN_DYN_ACK,
+				nrf24l01.DYNPD:      0x11,
+			},
+			addrs: map[byte][]byte{
+				nrf24l01.RX_ADDR_P1: []byte("IRQT1"),
+			},
+		},
+		{
+			name: "3 byte addresses",
+			config: func() nrf24l01.Config {
+				c := testConfig()
+				c.AddressWidth = 3
+				c.TXAddress = []byte{1, 2, 3}
+				c.Pipes[0].Address = []byte{1, 2, 3}
+				return c
+			}(),
+			regs: map[byte]byte{
+				nrf24l01.SETUP_AW: 0x01,
+			},
+			addrs: map[byte][]byte{
+				nrf24l01.TX_ADDR:    {1, 2, 3},
+				nrf24l01.RX_ADDR_P0: {1, 2, 3},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, chip := emutest.PowerOn("chip")
+			err := nrf.Apply(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for r, want := range tt.regs {
+				if got := chip.Register(r); got != want {
+					t.Errorf("%s = %#x, want %#x", nrf24l01.RegisterName(r), got, want)
+				}
+			}
+			for r, want := range tt.addrs {
+				if got := chip.Address(r); string(got) != string(want) {
+					t.Errorf("%s = %x, want %x", nrf24l01.RegisterName(r), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyInvalid(t *testing.T) {
+	nrf, chip := emutest.PowerOn("chip")
+	c := testConfig()
+	c.Channel = 200
+	err := nrf.Apply(c)
+	if err != nrf24l01.ErrInvalidChannel {
+		t.Fatalf("err %v, want ErrInvalidChannel", err)
+	}
+	if chip.Register(nrf24l01.RF_CH) != 2 {
+		t.Errorf("invalid config was written")
+	}
+}
+
+func TestApplyVerify(t *testing.T) {
+	// nRF24L01 without + has no 250kbps, RF_DR_LOW reads 0.
+	nrf, chip := emutest.PowerOn("chip")
+	chip.Plus = false
+	c := testConfig()
+	c.DataRate = nrf24l01.DataRate250Kbps
+	err := nrf.Apply(c)
+	var verify *nrf24l01.VerifyError
+	if !errors.As(err, &verify) || !errors.Is(err, nrf24l01.ErrVerifyFailed) {
+		t.Fatalf("err %v, want *VerifyError", err)
+	}
+	if verify.Register != nrf24l01.RF_SETUP {
+		t.Errorf("register %s, want RF_SETUP", nrf24l01.RegisterName(verify.Register))
+	}
+}
@@ -0,0 +1,209 @@
+package emulator
+
+import (
+	"sync"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// Air connects emulated chips.
+type Air struct {
+	mu    sync.Mutex
+	chips []*Chip
+
+	// Drop, if set, is called for every packet (and for every ACK) on the air.
+	// Returning true loses it, as if it was never received.
+	Drop func(from, to *Chip) bool
+
+	// Noise, if set, reports a carrier over -64dBm from other 2.4GHz devices
+	// on the channel. It's called when a listening chip reads RPD and for
+	// every packet, a packet sent during carrier is lost. It's called with
+	// the air locked, so it must not use chips. See Interference.
+	Noise func(channel byte) bool
+}
+
+// NewAir returns an empty air.
+func NewAir() *Air {
+	return &Air{}
+}
+
+// NewChip returns a new chip in power on state attached to the air.
+func (a *Air) NewChip(name string) *Chip {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := newChip(a, name)
+	a.chips = append(a.chips, c)
+	return c
+}
+
+// unlock updates IRQ outputs of all chips, releases the mutex
+// and calls interrupt callbacks for falling edges.
+func (a *Air) unlock() {
+	var callbacks []func()
+	for _, c := range a.chips {
+		if c.updateIRQ() && c.callback != nil {
+			callbacks = append(callbacks, c.callback)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// transmit sends payloads from TX FIFO of a PTX while it's possible.
+// It's called with the mutex locked.
+func (a *Air) transmit(c *Chip) {
+	for c.ce && c.poweredUp() && !c.primRX() &&
+		c.regs[nrf24l01.STATUS]&nrf24l01.STATUS_MAX_RT == 0 {
+
+		i := c.nextTX()
+		if i < 0 {
+			return
+		}
+		p := c.tx[i]
+
+		if !a.send(c, p) {
+			c.regs[nrf24l01.STATUS] |= nrf24l01.STATUS_MAX_RT
+			if c.plos < 15 {
+				c.plos++
+			}
+			return
+		}
+
+		c.regs[nrf24l01.STATUS] |= nrf24l01.STATUS_TX_DS
+		if c.reuse {
+			// Reused payload is sent once per CE pulse.
+			return
+		}
+		c.tx = append(c.tx[:i], c.tx[i+1:]...)
+	}
+}
+
+// nextTX returns index of the first payload to send (ACK payloads are skipped).
+func (c *Chip) nextTX() int {
+	for i, p := range c.tx {
+		if !p.ack {
+			return i
+		}
+	}
+	return -1
+}
+
+// send transmits one packet with retransmissions. Returns true if the packet
+// was acknowledged or if no ACK was requested.
+func (a *Air) send(c *Chip, p packet) bool {
+	needAck := !p.noAck && c.regs[nrf24l01.EN_AA]&1 != 0
+	retries := c.regs[nrf24l01.SETUP_RETR] & 0x0F
+
+	for attempt := byte(0); ; attempt++ {
+		c.arc = attempt
+		if a.deliver(c, p, needAck) || !needAck {
+			return true
+		}
+		if attempt >= retries {
+			return false
+		}
+	}
+}
+
+// deliver puts the packet on the air once. Returns true if it was acknowledged.
+func (a *Air) deliver(c *Chip, p packet, needAck bool) bool {
+	addr := c.txAddr[:c.addressWidth()]
+
+	for _, r := range a.chips {
+		if r == c || !r.listening() {
+			continue
+		}
+		if r.regs[nrf24l01.RF_CH] == c.regs[nrf24l01.RF_CH] {
+			// Any packet on the channel is a carrier for RPD.
+			r.rpd = true
+		}
+		if !compatible(c, r) {
+			continue
+		}
+		pipe, ok := r.matchPipe(addr)
+		if !ok {
+			continue
+		}
+		if a.Drop != nil && a.Drop(c, r) {
+			continue
+		}
+		if a.Noise != nil && a.Noise(r.regs[nrf24l01.RF_CH]) {
+			// Packet is corrupted by interference.
+			continue
+		}
+		if !r.dynamicPayload(pipe) && int(r.regs[nrf24l01.RX_PW_P0+pipe]) != len(p.data) {
+			// Static width mismatch fails CRC on the receiver.
+			continue
+		}
+		if len(r.rx) >= fifoDepth {
+			// No room, packet is discarded and not acknowledged.
+			continue
+		}
+
+		last := &r.last[pipe]
+		duplicate := needAck && last.valid && last.from == c &&
+			last.pid == p.pid && last.data == string(p.data)
+		if !duplicate {
+			r.rx = append(r.rx, packet{pipe: pipe, data: append([]byte(nil), p.data...)})
+			r.regs[nrf24l01.STATUS] |= nrf24l01.STATUS_RX_DR
+			*last = received{valid: true, from: c, pid: p.pid, data: string(p.data)}
+		}
+
+		if !needAck || r.regs[nrf24l01.EN_AA]>>pipe&1 == 0 {
+			continue
+		}
+		return a.acknowledge(r, c, pipe)
+	}
+	return false
+}
+
+// acknowledge sends ACK (with ACK payload if any) from PRX r to PTX c.
+func (a *Air) acknowledge(r, c *Chip, pipe byte) bool {
+	if a.Drop != nil && a.Drop(r, c) {
+		return false
+	}
+	// PTX receives ACK on pipe 0, so RX_ADDR_P0 must be equal to TX_ADDR.
+	aw := c.addressWidth()
+	if string(c.rxAddr[0][:aw]) != string(c.txAddr[:aw]) {
+		return false
+	}
+
+	for i, ap := range r.tx {
+		if !ap.ack || ap.pipe != pipe {
+			continue
+		}
+		r.tx = append(r.tx[:i], r.tx[i+1:]...)
+		r.regs[nrf24l01.STATUS] |= nrf24l01.STATUS_TX_DS
+		if len(c.rx) < fifoDepth {
+			c.rx = append(c.rx, packet{pipe: 0, data: ap.data})
+			c.regs[nrf24l01.STATUS] |= nrf24l01.STATUS_RX_DR
+		}
+		break
+	}
+	return true
+}
+
+// compatible reports whether two chips are able to hear each other.
+func compatible(a, b *Chip) bool {
+	return a.regs[nrf24l01.RF_CH] == b.regs[nrf24l01.RF_CH] &&
+		a.dataRate() == b.dataRate() &&
+		a.addressWidth() != 0 &&
+		a.addressWidth() == b.addressWidth() &&
+		a.crcLength() == b.crcLength()
+}
+
+// matchPipe returns the enabled RX pipe with address addr.
+func (c *Chip) matchPipe(addr []byte) (byte, bool) {
+	for pipe := byte(0); pipe < 6; pipe++ {
+		if c.regs[nrf24l01.EN_RXADDR]>>pipe&1 == 0 {
+			continue
+		}
+		if string(c.pipeAddress(pipe)) == string(addr) {
+			return pipe, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,570 @@
+// Package emulator has a register-accurate software model of the nRF24L01+.
+//
+// A Chip implements the same SPI and pin interfaces used by nrf24l01.Device,
+// so the real driver runs against it on the host:
+//
+//	air := emulator.NewAir()
+//	tx := air.NewChip("tx")
+//	rx := air.NewChip("rx")
+//	ptx := nrf24l01.New(tx, tx.CE(), tx.CSN())
+//	prx := nrf24l01.New(rx, rx.CE(), rx.CSN())
+//
+// Chips attached to the same Air hear each other when their channel, data
+// rate, address width, CRC and addresses match, following Enhanced
+// ShockBurst™ rules (auto acknowledgement, retransmission, ACK payloads).
+// The air has no timing: a packet is delivered as soon as a PTX with CE high
+// has something in its TX FIFO.
+package emulator
+
+import (
+	"joystick/pkg/nrf24l01"
+)
+
+const (
+	fifoDepth  = 3
+	maxPayload = 32
+)
+
+// packet is one entry of TX or RX FIFO.
+type packet struct {
+	pipe  byte // RX pipe for RX FIFO, target pipe for ACK payloads
+	data  []byte
+	noAck bool // sent with W_TX_PAYLOAD_NO_ACK
+	ack   bool // written with W_ACK_PAYLOAD
+	pid   byte // packet identity, 2 bits
+}
+
+// received identifies last packet accepted on a pipe, for duplicate detection.
+type received struct {
+	valid bool
+	from  *Chip
+	pid   byte
+	data  string
+}
+
+// Chip is one emulated nRF24L01+.
+type Chip struct {
+	// Name of the chip, only for debug.
+	Name string
+
+	// Plus is true for nRF24L01+ (default). nRF24L01 has no RPD
+	// and no 250kbps, RF_DR_LOW bit reads always 0.
+	Plus bool
+
+	air *Air
+
+	regs   [0x20]byte
+	rxAddr [2][5]byte // RX_ADDR_P0, RX_ADDR_P1
+	txAddr [5]byte    // TX_ADDR
+
+	tx    []packet
+	rx    []packet
+	reuse bool
+	pid   byte
+	arc   byte // ARC_CNT
+	plos  byte // PLOS_CNT
+	last  [6]received
+	rpd   bool // carrier heard since RX mode was entered
+
+	ce  bool
+	csn bool
+
+	irq      bool // level of IRQ output, active low
+	callback func()
+
+	// current SPI transaction
+	active bool
+	cmd    byte
+	n      int
+	buf    []byte
+}
+
+// NewChip returns a chip alone in its own air.
+func NewChip(name string) *Chip {
+	return NewAir().NewChip(name)
+}
+
+func newChip(air *Air, name string) *Chip {
+	c := &Chip{
+		Name: name,
+		Plus: true,
+		air:  air,
+		csn:  true,
+		irq:  true,
+	}
+	c.Reset()
+	return c
+}
+
+// Reset sets registers and FIFOs to power on state.
+func (c *Chip) Reset() {
+	c.regs = [0x20]byte{}
+	c.regs[nrf24l01.CONFIG] = 0x08
+	c.regs[nrf24l01.EN_AA] = 0x3F
+	c.regs[nrf24l01.EN_RXADDR] = 0x03
+	c.regs[nrf24l01.SETUP_AW] = 0x03
+	c.regs[nrf24l01.SETUP_RETR] = 0x03
+	c.regs[nrf24l01.RF_CH] = 0x02
+	c.regs[nrf24l01.RF_SETUP] = 0x0E
+	c.regs[nrf24l01.RX_ADDR_P2] = 0xC3
+	c.regs[nrf24l01.RX_ADDR_P3] = 0xC4
+	c.regs[nrf24l01.RX_ADDR_P4] = 0xC5
+	c.regs[nrf24l01.RX_ADDR_P5] = 0xC6
+	c.rxAddr[0] = [5]byte{0xE7, 0xE7, 0xE7, 0xE7, 0xE7}
+	c.rxAddr[1] = [5]byte{0xC2, 0xC2, 0xC2, 0xC2, 0xC2}
+	c.txAddr = [5]byte{0xE7, 0xE7, 0xE7, 0xE7, 0xE7}
+	c.tx = nil
+	c.rx = nil
+	c.reuse = false
+	c.arc = 0
+	c.plos = 0
+	c.last = [6]received{}
+	c.rpd = false
+}
+
+// Transfer implements nrf24l01.SPI.
+// Bytes sent while CSN is high are ignored and read as 0xFF.
+func (c *Chip) Transfer(w byte) (byte, error) {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+	return c.transfer(w), nil
+}
+
+// Tx implements nrf24l01.SPI.
+func (c *Chip) Tx(w, r []byte) error {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+
+	n := len(w)
+	if len(r) > n {
+		n = len(r)
+	}
+	for i := 0; i < n; i++ {
+		var out byte
+		if i < len(w) {
+			out = w[i]
+		}
+		in := c.transfer(out)
+		if i < len(r) {
+			r[i] = in
+		}
+	}
+	return nil
+}
+
+// CE returns the Chip Enable input of the chip.
+func (c *Chip) CE() *Pin {
+	return &Pin{chip: c, set: c.setCE, get: func() bool { return c.ce }}
+}
+
+// CSN returns the SPI Chip Select input of the chip.
+func (c *Chip) CSN() *Pin {
+	return &Pin{chip: c, set: c.setCSN, get: func() bool { return c.csn }}
+}
+
+// IRQ returns the interrupt output of the chip.
+func (c *Chip) IRQ() *IRQ {
+	return &IRQ{chip: c}
+}
+
+// Register returns register state without touching the SPI bus.
+// For multi-byte address registers the LSByte is returned.
+func (c *Chip) Register(r byte) byte {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+	return c.readRegister(r&0x1F, 0)
+}
+
+// Address returns the content of RX_ADDR_P0...P5 or TX_ADDR,
+// with the width set in SETUP_AW (LSByte first).
+func (c *Chip) Address(r byte) []byte {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+	res := make([]byte, c.addressWidth())
+	for i := range res {
+		res[i] = c.readRegister(r, i)
+	}
+	return res
+}
+
+// TXCount returns number of payloads in TX FIFO.
+func (c *Chip) TXCount() int {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+	return len(c.tx)
+}
+
+// RXCount returns number of payloads in RX FIFO.
+func (c *Chip) RXCount() int {
+	c.air.mu.Lock()
+	defer c.air.unlock()
+	return len(c.rx)
+}
+
+func (c *Chip) setCE(level bool) {
+	rising := level && !c.ce
+	c.ce = level
+	if !level {
+		// RPD is reset when RX mode is left.
+		c.rpd = false
+	}
+	if rising {
+		c.air.transmit(c)
+	}
+}
+
+func (c *Chip) setCSN(level bool) {
+	if level == c.csn {
+		return
+	}
+	c.csn = level
+	if !level {
+		c.active = true
+		c.n = 0
+		c.buf = c.buf[:0]
+		return
+	}
+	if c.active {
+		c.active = false
+		c.finish()
+	}
+}
+
+// transfer handles one SPI byte inside a transaction.
+func (c *Chip) transfer(w byte) byte {
+	if !c.active {
+		return 0xFF
+	}
+	if c.n == 0 {
+		c.n++
+		c.cmd = w
+		status := c.status()
+		c.command()
+		return status
+	}
+	i := c.n - 1
+	c.n++
+
+	switch {
+	case c.cmd <= 0x1F: // R_REGISTER
+		return c.readRegister(c.cmd, i)
+	case c.cmd <= 0x3F: // W_REGISTER
+		c.writeRegister(c.cmd&0x1F, i, w)
+	case c.cmd == nrf24l01.R_RX_PAYLOAD:
+		if len(c.rx) > 0 && i < len(c.rx[0].data) {
+			return c.rx[0].data[i]
+		}
+	case c.cmd == nrf24l01.R_RX_PL_WID:
+		if len(c.rx) > 0 && i == 0 {
+			return byte(len(c.rx[0].data))
+		}
+	case c.cmd == nrf24l01.W_TX_PAYLOAD,
+		c.cmd == nrf24l01.W_TX_PAYLOAD_NO_ACK,
+		c.cmd&0xF8 == nrf24l01.W_ACK_PAYLOAD:
+		c.buf = append(c.buf, w)
+	}
+	return 0
+}
+
+// command executes commands without data bytes.
+func (c *Chip) command() {
+	switch c.cmd {
+	case nrf24l01.FLUSH_TX:
+		c.tx = c.tx[:0]
+		c.reuse = false
+	case nrf24l01.FLUSH_RX:
+		c.rx = c.rx[:0]
+	case nrf24l01.REUSE_TX_PL:
+		if !c.primRX() {
+			c.reuse = true
+		}
+	}
+}
+
+// finish completes commands at the end of transaction (CSN high).
+func (c *Chip) finish() {
+	switch {
+	case c.cmd == nrf24l01.R_RX_PAYLOAD:
+		if c.n > 1 && len(c.rx) > 0 {
+			c.rx = c.rx[1:]
+		}
+	case c.cmd == nrf24l01.W_TX_PAYLOAD:
+		c.push(packet{data: c.payload()})
+	case c.cmd == nrf24l01.W_TX_PAYLOAD_NO_ACK:
+		if c.regs[nrf24l01.FEATURE]&nrf24l01.FEATURE_EN_DYN_ACK != 0 {
+			c.push(packet{data: c.payload(), noAck: true})
+		} else {
+			c.push(packet{data: c.payload()})
+		}
+	case c.cmd&0xF8 == nrf24l01.W_ACK_PAYLOAD && c.cmd&0x07 <= 5:
+		if c.regs[nrf24l01.FEATURE]&nrf24l01.FEATURE_EN_ACK_PAY != 0 {
+			c.push(packet{data: c.payload(), ack: true, pipe: c.cmd & 0x07})
+		}
+	default:
+		return
+	}
+	if c.ce {
+		c.air.transmit(c)
+	}
+}
+
+func (c *Chip) payload() []byte {
+	if len(c.buf) > maxPayload {
+		return append([]byte(nil), c.buf[:maxPayload]...)
+	}
+	return append([]byte(nil), c.buf...)
+}
+
+func (c *Chip) push(p packet) {
+	if len(p.data) == 0 || len(c.tx) >= fifoDepth {
+		return
+	}
+	if !p.ack {
+		c.reuse = false
+		c.pid = (c.pid + 1) & 0b11
+		p.pid = c.pid
+	}
+	c.tx = append(c.tx, p)
+}
+
+func (c *Chip) status() byte {
+	s := c.regs[nrf24l01.STATUS] & nrf24l01.STATUS_IRQ
+	if len(c.rx) == 0 {
+		s |= nrf24l01.STATUS_RX_P_NO
+	} else {
+		s |= c.rx[0].pipe << 1
+	}
+	if len(c.tx) >= fifoDepth {
+		s |= nrf24l01.STATUS_TX_FULL
+	}
+	return s
+}
+
+func (c *Chip) fifoStatus() byte {
+	var s byte
+	if c.reuse {
+		s |= nrf24l01.FIFO_STATUS_TX_REUSE
+	}
+	if len(c.tx) >= fifoDepth {
+		s |= nrf24l01.FIFO_STATUS_TX_FULL
+	}
+	if len(c.tx) == 0 {
+		s |= nrf24l01.FIFO_STATUS_TX_EMPTY
+	}
+	if len(c.rx) >= fifoDepth {
+		s |= nrf24l01.FIFO_STATUS_RX_FULL
+	}
+	if len(c.rx) == 0 {
+		s |= nrf24l01.FIFO_STATUS_RX_EMPTY
+	}
+	return s
+}
+
+func (c *Chip) readRegister(r byte, i int) byte {
+	switch r {
+	case nrf24l01.STATUS:
+		return c.status()
+	case nrf24l01.FIFO_STATUS:
+		return c.fifoStatus()
+	case nrf24l01.OBSERVE_TX:
+		return c.plos<<4 | c.arc
+	case nrf24l01.RPD:
+		if !c.Plus || !c.listening() {
+			return 0
+		}
+		if c.rpd || c.air.Noise != nil && c.air.Noise(c.regs[nrf24l01.RF_CH]) {
+			return 1
+		}
+		return 0
+	case nrf24l01.RX_ADDR_P0, nrf24l01.RX_ADDR_P1:
+		if i < 5 {
+			return c.rxAddr[r-nrf24l01.RX_ADDR_P0][i]
+		}
+		return 0
+	case nrf24l01.TX_ADDR:
+		if i < 5 {
+			return c.txAddr[i]
+		}
+		return 0
+	}
+	return c.regs[r]
+}
+
+// writable bits of single byte registers.
+var writeMask = map[byte]byte{
+	nrf24l01.CONFIG:     0x7F,
+	nrf24l01.EN_AA:      0x3F,
+	nrf24l01.EN_RXADDR:  0x3F,
+	nrf24l01.SETUP_AW:   0x03,
+	nrf24l01.SETUP_RETR: 0xFF,
+	nrf24l01.RF_CH:      0x7F,
+	nrf24l01.RF_SETUP:   0xBE,
+	nrf24l01.RX_ADDR_P2: 0xFF,
+	nrf24l01.RX_ADDR_P3: 0xFF,
+	nrf24l01.RX_ADDR_P4: 0xFF,
+	nrf24l01.RX_ADDR_P5: 0xFF,
+	nrf24l01.RX_PW_P0:   0x3F,
+	nrf24l01.RX_PW_P1:   0x3F,
+	nrf24l01.RX_PW_P2:   0x3F,
+	nrf24l01.RX_PW_P3:   0x3F,
+	nrf24l01.RX_PW_P4:   0x3F,
+	nrf24l01.RX_PW_P5:   0x3F,
+	nrf24l01.DYNPD:      0x3F,
+	nrf24l01.FEATURE:    0x07,
+}
+
+func (c *Chip) writeRegister(r byte, i int, s byte) {
+	switch r {
+	case nrf24l01.STATUS:
+		// Write 1 to clear bit.
+		if i == 0 {
+			c.regs[r] &^= s & nrf24l01.STATUS_IRQ
+			if s&nrf24l01.STATUS_MAX_RT != 0 && c.ce {
+				defer c.air.transmit(c)
+			}
+		}
+		return
+	case nrf24l01.RX_ADDR_P0, nrf24l01.RX_ADDR_P1:
+		if i < 5 {
+			c.rxAddr[r-nrf24l01.RX_ADDR_P0][i] = s
+		}
+		return
+	case nrf24l01.TX_ADDR:
+		if i < 5 {
+			c.txAddr[i] = s
+		}
+		return
+	}
+
+	mask, ok := writeMask[r]
+	if !ok || i != 0 {
+		return
+	}
+	if r == nrf24l01.RF_SETUP && !c.Plus {
+		mask &^= 0b00100000 // RF_DR_LOW
+	}
+	c.regs[r] = s & mask
+
+	if r == nrf24l01.RF_CH {
+		c.plos = 0
+		c.rpd = false
+	}
+}
+
+func (c *Chip) primRX() bool {
+	return c.regs[nrf24l01.CONFIG]&nrf24l01.CONFIG_PRIM_RX != 0
+}
+
+func (c *Chip) poweredUp() bool {
+	return c.regs[nrf24l01.CONFIG]&nrf24l01.CONFIG_PWR_UP != 0
+}
+
+// addressWidth returns 3, 4, 5 or 0 for illegal SETUP_AW.
+func (c *Chip) addressWidth() int {
+	aw := int(c.regs[nrf24l01.SETUP_AW] & 0b11)
+	if aw == 0 {
+		return 0
+	}
+	return aw + 2
+}
+
+// crcLength returns CRC length in bytes. CRC is forced on by EN_AA.
+func (c *Chip) crcLength() int {
+	config := c.regs[nrf24l01.CONFIG]
+	if config&nrf24l01.CONFIG_EN_CRC == 0 && c.regs[nrf24l01.EN_AA] == 0 {
+		return 0
+	}
+	if config&nrf24l01.CONFIG_CRCO != 0 {
+		return 2
+	}
+	return 1
+}
+
+func (c *Chip) dataRate() byte {
+	return c.regs[nrf24l01.RF_SETUP] & 0b00101000
+}
+
+func (c *Chip) dynamicPayload(pipe byte) bool {
+	return c.regs[nrf24l01.FEATURE]&nrf24l01.FEATURE_EN_DPL != 0 && c.regs[nrf24l01.DYNPD]>>pipe&1 != 0
+}
+
+// pipeAddress returns address of RX pipe with the current width.
+func (c *Chip) pipeAddress(pipe byte) []byte {
+	aw := c.addressWidth()
+	addr := make([]byte, aw)
+	switch pipe {
+	case 0, 1:
+		copy(addr, c.rxAddr[pipe][:aw])
+	default:
+		copy(addr, c.rxAddr[1][:aw])
+		addr[0] = c.regs[nrf24l01.RX_ADDR_P0+pipe]
+	}
+	return addr
+}
+
+// listening reports whether chip is a powered up PRX with CE high.
+func (c *Chip) listening() bool {
+	return c.ce && c.poweredUp() && c.primRX()
+}
+
+// Pin is an input pin of the chip driven by the host.
+type Pin struct {
+	chip *Chip
+	set  func(bool)
+	get  func() bool
+}
+
+// High sets pin to high level.
+func (p *Pin) High() {
+	p.chip.air.mu.Lock()
+	defer p.chip.air.unlock()
+	p.set(true)
+}
+
+// Low sets pin to low level.
+func (p *Pin) Low() {
+	p.chip.air.mu.Lock()
+	defer p.chip.air.unlock()
+	p.set(false)
+}
+
+// Get returns current level.
+func (p *Pin) Get() bool {
+	p.chip.air.mu.Lock()
+	defer p.chip.air.unlock()
+	return p.get()
+}
+
+// IRQ is the interrupt output of the chip. Active low.
+// It satisfies nrf24l01.IRQPin.
+type IRQ struct {
+	chip *Chip
+}
+
+// Get returns current level. false - interrupt is asserted.
+func (p *IRQ) Get() bool {
+	p.chip.air.mu.Lock()
+	defer p.chip.air.unlock()
+	return p.chip.irq
+}
+
+// SetInterrupt calls callback on every falling edge of IRQ.
+// Callback is called after the SPI transfer or pin change that caused it,
+// so it can use the chip.
+func (p *IRQ) SetInterrupt(callback func()) error {
+	p.chip.air.mu.Lock()
+	defer p.chip.air.unlock()
+	p.chip.callback = callback
+	return nil
+}
+
+// updateIRQ sets level of IRQ output from STATUS and CONFIG masks.
+// Returns true on falling edge.
+func (c *Chip) updateIRQ() bool {
+	flags := c.regs[nrf24l01.STATUS] & nrf24l01.STATUS_IRQ
+	masked := c.regs[nrf24l01.CONFIG] & nrf24l01.CONFIG_MASK_IRQ
+	level := flags&^masked == 0
+	falling := c.irq && !level
+	c.irq = level
+	return falling
+}
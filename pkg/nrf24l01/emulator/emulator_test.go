@@ -0,0 +1,117 @@
+package emulator_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+var address = []byte("EMUL0")
+
+// config is the link of emutest on other channel, data rate and CRC.
+func config() nrf24l01.Config {
+	c := emutest.Config(address)
+	c.Channel = 76
+	c.DataRate = nrf24l01.DataRate1Mbps
+	c.CRC = nrf24l01.CRC16
+	return c
+}
+
+func TestSendReceive(t *testing.T) {
+	ptx, prx := emutest.Pair(t, emulator.NewAir(), config())
+
+	err := prx.WriteAckPayload(0, []byte("ack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := ptx.Send(10*time.Millisecond, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Delivered || !res.AckPayload || res.Retries != 0 {
+		t.Errorf("result %+v", res)
+	}
+
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	pipe, n, ok, err := prx.Receive(buf[:])
+	if err != nil || !ok || pipe != 0 || string(buf[:n]) != "hello" {
+		t.Errorf("receiver: pipe %d %q ok %v err %v", pipe, buf[:n], ok, err)
+	}
+	_, n, ok, err = ptx.Receive(buf[:])
+	if err != nil || !ok || string(buf[:n]) != "ack" {
+		t.Errorf("ACK payload: %q ok %v err %v", buf[:n], ok, err)
+	}
+	_, _, ok, _ = prx.Receive(buf[:])
+	if ok {
+		t.Errorf("RX FIFO isn't empty")
+	}
+}
+
+func TestRXFIFODepth(t *testing.T) {
+	ptx, prx := emutest.Pair(t, emulator.NewAir(), config())
+
+	for i := 0; i < 3; i++ {
+		_, err := ptx.Send(10*time.Millisecond, []byte{byte(i)})
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+	}
+	fifo, err := prx.GetFIFOStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fifo.RXFull() {
+		t.Errorf("FIFO_STATUS %#x, want RX_FULL", byte(fifo))
+	}
+	// Full RX FIFO doesn't acknowledge.
+	_, err = ptx.Send(10*time.Millisecond, []byte{3})
+	if !errors.Is(err, nrf24l01.ErrMaxRetries) {
+		t.Errorf("4th packet: %v, want ErrMaxRetries", err)
+	}
+
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	for i := 0; i < 3; i++ {
+		_, n, ok, err := prx.Receive(buf[:])
+		if err != nil || !ok || n != 1 || buf[0] != byte(i) {
+			t.Errorf("payload %d: %x ok %v err %v", i, buf[:n], ok, err)
+		}
+	}
+}
+
+func TestDrop(t *testing.T) {
+	air := emulator.NewAir()
+	ptx, _ := emutest.Pair(t, air, config())
+
+	drops := 0
+	air.Drop = func(from, to *emulator.Chip) bool {
+		drops++
+		return drops <= 2
+	}
+	res, err := ptx.Send(10*time.Millisecond, []byte("retry"))
+	if err != nil || res.Retries != 2 {
+		t.Errorf("two lost: %+v err %v, want 2 retries", res, err)
+	}
+
+	air.Drop = func(from, to *emulator.Chip) bool { return true }
+	res, err = ptx.Send(10*time.Millisecond, []byte("lost"))
+	if !errors.Is(err, nrf24l01.ErrMaxRetries) || res.Delivered || res.Lost != 1 {
+		t.Errorf("all lost: %+v err %v, want ErrMaxRetries", res, err)
+	}
+}
+
+func TestOtherChannel(t *testing.T) {
+	ptx, _ := emutest.Pair(t, emulator.NewAir(), config())
+
+	err := ptx.SetRFChannel(77)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ptx.Send(10*time.Millisecond, []byte("nobody"))
+	if !errors.Is(err, nrf24l01.ErrMaxRetries) {
+		t.Errorf("err %v, want ErrMaxRetries", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Package emutest has the fixtures of tests that run the driver on the
+// emulated air: a chip with its driver and the radio setup of a link.
+//
+//	air := emulator.NewAir()
+//	ptx, prx := emutest.Pair(t, air, emutest.Config([]byte("TEST0")))
+package emutest
+
+import (
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+)
+
+// Config returns the setup of a link on pipe 0 with address: 250kbps,
+// CRC8, auto-ack with 3 retries, dynamic payload and ACK payloads.
+// The address width is the length of address.
+func Config(address []byte) nrf24l01.Config {
+	return nrf24l01.Config{
+		DataRate:     nrf24l01.DataRate250Kbps,
+		CRC:          nrf24l01.CRC8,
+		AddressWidth: byte(len(address)),
+		TXAddress:    address,
+		Pipes: [6]nrf24l01.Pipe{
+			{Enabled: true, AutoAck: true, DynamicPayload: true, Address: address},
+		},
+		RetryCount:     3,
+		DynamicPayload: true,
+		AckPayload:     true,
+	}
+}
+
+// Radio returns the driver of a new chip on air with config applied.
+// The radio is in power down mode.
+func Radio(t testing.TB, air *emulator.Air, name string, config nrf24l01.Config) *nrf24l01.Device {
+	t.Helper()
+	nrf, _ := Chip(t, air, name, config)
+	return nrf
+}
+
+// Chip is Radio that returns the chip too, for its registers and IRQ.
+func Chip(t testing.TB, air *emulator.Air, name string, config nrf24l01.Config) (*nrf24l01.Device, *emulator.Chip) {
+	t.Helper()
+	chip := air.NewChip(name)
+	nrf := nrf24l01.New(chip, chip.CE(), chip.CSN())
+	err := nrf.Apply(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nrf, chip
+}
+
+// Pair returns a transmitter "tx" in TX mode and a receiver "rx" in RX
+// mode on air, both with config.
+func Pair(t testing.TB, air *emulator.Air, config nrf24l01.Config) (ptx, prx *nrf24l01.Device) {
+	t.Helper()
+	ptx = Radio(t, air, "tx", config)
+	prx = Radio(t, air, "rx", config)
+	err := ptx.SetTXMode()
+	if err == nil {
+		err = prx.SetRXMode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ptx, prx
+}
+
+// PowerOn returns the driver of a chip in power on state, not on any air.
+func PowerOn(name string) (*nrf24l01.Device, *emulator.Chip) {
+	chip := emulator.NewChip(name)
+	return nrf24l01.New(chip, chip.CE(), chip.CSN()), chip
+}
@@ -0,0 +1,37 @@
+package emulator
+
+import (
+	"math/rand"
+
+	"joystick/pkg/nrf24l01"
+)
+
+// Interference is a noise model of other 2.4GHz devices: every channel
+// has a probability of carrier. Use its Carrier method as Air.Noise.
+type Interference struct {
+	// Busy is the probability of carrier on every channel, 0 to 1.
+	Busy [nrf24l01.MaxChannel + 1]float64
+
+	rand *rand.Rand
+}
+
+// NewInterference returns quiet band. seed makes the noise repeatable.
+func NewInterference(seed int64) *Interference {
+	return &Interference{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Set probability of carrier on channels from to to, inclusive.
+// A Wi-Fi network is about 22 channels wide, e.g. Wi-Fi channel 6 is 26 to 48.
+func (n *Interference) Set(from, to byte, busy float64) {
+	for ch := int(from); ch <= int(to) && ch <= nrf24l01.MaxChannel; ch++ {
+		n.Busy[ch] = busy
+	}
+}
+
+// Carrier reports whether carrier is on the channel now.
+func (n *Interference) Carrier(channel byte) bool {
+	if int(channel) >= len(n.Busy) {
+		return false
+	}
+	return n.rand.Float64() < n.Busy[channel]
+}
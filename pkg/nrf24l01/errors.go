@@ -0,0 +1,86 @@
+package nrf24l01
+
+import (
+	"errors"
+)
+
+var (
+	ErrInvalidPipe         = errors.New("nrf24l01: pipe must be 0 to 5")
+	ErrInvalidChannel      = errors.New("nrf24l01: channel must be 0 to 125")
+	ErrInvalidAddress      = errors.New("nrf24l01: address width must be 3 to 5 bytes and addresses must have this width")
+	ErrInvalidConfig       = errors.New("nrf24l01: invalid config")
+	ErrPayloadTooLarge     = errors.New("nrf24l01: payload must be 1 to 32 bytes")
+	ErrInvalidPayloadWidth = errors.New("nrf24l01: invalid payload width: over 32 bytes in RX FIFO, or 0 for an enabled static pipe")
+	ErrTXFull              = errors.New("nrf24l01: TX FIFO is full")
+	ErrMaxRetries          = errors.New("nrf24l01: maximum number of retransmits reached")
+	ErrTimeout             = errors.New("nrf24l01: timeout")
+	ErrNoIRQ               = errors.New("nrf24l01: IRQ pin is not attached")
+	ErrChipNotPresent      = errors.New("nrf24l01: chip is not present")
+	ErrBusStuck            = errors.New("nrf24l01: SPI bus is stuck, MISO reads only 0x00")
+	ErrSelfTestFailed      = errors.New("nrf24l01: self test failed")
+	ErrVerifyFailed        = errors.New("nrf24l01: register verify failed")
+)
+
+// Error is returned when SPI transfer fails. It wraps the error of the bus,
+// errors.Is and errors.As see it with Unwrap.
+type Error struct {
+	Op       string // "read" or "write" of register, or name of command
+	Register byte   // register for "read" and "write"
+	Err      error  // error of the SPI bus
+}
+
+func (e *Error) Error() string {
+	if e.Op == opRead || e.Op == opWrite {
+		return "nrf24l01: " + e.Op + " " + RegisterName(e.Register) + ": " + e.Err.Error()
+	}
+	return "nrf24l01: " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError is returned by Apply when a register reads back different
+// from what was written. errors.Is(err, ErrVerifyFailed) is true for it.
+type VerifyError struct {
+	Register byte
+	Written  []byte
+	Read     []byte
+}
+
+func (e *VerifyError) Error() string {
+	return "nrf24l01: verify " + RegisterName(e.Register) +
+		": written " + hexBytes(e.Written) + ", read " + hexBytes(e.Read)
+}
+
+func (e *VerifyError) Is(target error) bool {
+	return target == ErrVerifyFailed
+}
+
+// SelfTestError is returned by SelfTest with the failed step and
+// FIFO_STATUS read on it. errors.Is(err, ErrSelfTestFailed) is true for it.
+type SelfTestError struct {
+	Step       string
+	FIFOStatus FIFOStatus
+}
+
+func (e *SelfTestError) Error() string {
+	return "nrf24l01: self test: " + e.Step + ": FIFO_STATUS " + hexBytes([]byte{byte(e.FIFOStatus)})
+}
+
+func (e *SelfTestError) Is(target error) bool {
+	return target == ErrSelfTestFailed
+}
+
+const (
+	opRead  = "read"
+	opWrite = "write"
+)
+
+// busError wraps err of SPI bus into *Error. nil stays nil.
+func busError(op string, r byte, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Op: op, Register: r, Err: err}
+}
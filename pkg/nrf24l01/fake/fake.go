@@ -0,0 +1,197 @@
+// Package fake has an in-memory implementation of the nrf24l01 bus.
+//
+// It records every CSN/CE edge and every SPI byte, so the driver can be
+// checked on the host with plain go test, without a radio on the bench.
+package fake
+
+// Kind of the recorded event.
+type Kind byte
+
+const (
+	// Edge of a pin. Pin and Level are set.
+	Edge Kind = iota
+
+	// One byte transferred through SPI. MOSI and MISO are set.
+	Byte
+)
+
+// Event is one recorded activity on the bus.
+type Event struct {
+	Kind  Kind
+	Pin   string // name of the pin, for Edge
+	Level bool   // new level of the pin, for Edge
+	MOSI  byte   // byte written by the driver, for Byte
+	MISO  byte   // byte answered to the driver, for Byte
+}
+
+// Bus is a fake SPI bus with its pins.
+// All pins created by Bus.Pin share the same event log with the SPI bytes.
+type Bus struct {
+	// Events in order of occurrence.
+	Events []Event
+
+	// Reply, if set, returns the MISO byte for every MOSI byte.
+	// If nil, bytes from Replies are used and then 0x00.
+	Reply func(mosi byte) byte
+
+	// Replies are returned one by one as MISO bytes.
+	Replies []byte
+
+	// Err, if set, is returned by every transfer.
+	Err error
+}
+
+// New returns an empty bus.
+func New() *Bus {
+	return &Bus{}
+}
+
+// Transfer writes one byte and returns the answer.
+func (b *Bus) Transfer(w byte) (byte, error) {
+	if b.Err != nil {
+		return 0, b.Err
+	}
+	r := b.next(w)
+	b.Events = append(b.Events, Event{Kind: Byte, MOSI: w, MISO: r})
+	return r, nil
+}
+
+// Tx writes w and reads into r. Bytes are clocked as 0x00 when w is nil.
+func (b *Bus) Tx(w, r []byte) error {
+	n := len(w)
+	if len(r) > n {
+		n = len(r)
+	}
+	for i := 0; i < n; i++ {
+		var out byte
+		if i < len(w) {
+			out = w[i]
+		}
+		in, err := b.Transfer(out)
+		if err != nil {
+			return err
+		}
+		if i < len(r) {
+			r[i] = in
+		}
+	}
+	return nil
+}
+
+func (b *Bus) next(w byte) byte {
+	if b.Reply != nil {
+		return b.Reply(w)
+	}
+	if len(b.Replies) > 0 {
+		r := b.Replies[0]
+		b.Replies = b.Replies[1:]
+		return r
+	}
+	return 0
+}
+
+// Pin returns a new output pin recording its edges into the bus log.
+// Starting level is low.
+func (b *Bus) Pin(name string) *Pin {
+	return &Pin{bus: b, name: name}
+}
+
+// Reset clears the recorded events.
+func (b *Bus) Reset() {
+	b.Events = b.Events[:0]
+}
+
+// Written returns all MOSI bytes in order.
+func (b *Bus) Written() []byte {
+	var res []byte
+	for _, e := range b.Events {
+		if e.Kind == Byte {
+			res = append(res, e.MOSI)
+		}
+	}
+	return res
+}
+
+// Transactions returns MOSI bytes grouped by CSN low-high frames.
+// csn - name of the chip select pin.
+func (b *Bus) Transactions(csn string) [][]byte {
+	var (
+		res    [][]byte
+		cur    []byte
+		active bool
+	)
+	for _, e := range b.Events {
+		switch {
+		case e.Kind == Edge && e.Pin == csn && !e.Level:
+			active = true
+			cur = []byte{}
+		case e.Kind == Edge && e.Pin == csn && e.Level:
+			if active {
+				res = append(res, cur)
+			}
+			active = false
+		case e.Kind == Byte && active:
+			cur = append(cur, e.MOSI)
+		}
+	}
+	return res
+}
+
+// Pin is a fake output pin.
+type Pin struct {
+	bus   *Bus
+	name  string
+	level bool
+}
+
+// High sets pin to high level.
+func (p *Pin) High() {
+	p.set(true)
+}
+
+// Low sets pin to low level.
+func (p *Pin) Low() {
+	p.set(false)
+}
+
+// Get returns current level.
+func (p *Pin) Get() bool {
+	return p.level
+}
+
+func (p *Pin) set(level bool) {
+	p.level = level
+	p.bus.Events = append(p.bus.Events, Event{Kind: Edge, Pin: p.name, Level: level})
+}
+
+// IRQ is a fake interrupt input driven by the test. Starting level is high.
+// It satisfies nrf24l01.IRQPin.
+type IRQ struct {
+	level    bool
+	callback func()
+}
+
+// NewIRQ returns not asserted IRQ line.
+func NewIRQ() *IRQ {
+	return &IRQ{level: true}
+}
+
+// Get returns current level.
+func (p *IRQ) Get() bool {
+	return p.level
+}
+
+// SetInterrupt sets callback called on falling edge.
+func (p *IRQ) SetInterrupt(callback func()) error {
+	p.callback = callback
+	return nil
+}
+
+// Set changes level of the line. Falling edge calls the callback.
+func (p *IRQ) Set(level bool) {
+	falling := p.level && !level
+	p.level = level
+	if falling && p.callback != nil {
+		p.callback()
+	}
+}
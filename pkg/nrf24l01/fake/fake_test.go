@@ -0,0 +1,243 @@
+package fake_test
+
+import (
+	"errors"
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+func TestBusReplies(t *testing.T) {
+	bus := fake.New()
+	bus.Replies = []byte{0x0E, 0x4C}
+	for i, want := range []byte{0x0E, 0x4C, 0x00} {
+		got, err := bus.Transfer(byte(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("transfer %d: %#x, want %#x", i, got, want)
+		}
+	}
+
+	// Reply has priority over Replies.
+	bus.Replies = []byte{0x11}
+	bus.Reply = func(mosi byte) byte { return ^mosi }
+	if got, _ := bus.Transfer(0x0F); got != 0xF0 {
+		t.Errorf("Reply: %#x, want 0xf0", got)
+	}
+
+	want := []fake.Event{
+		{Kind: fake.Byte, MOSI: 0, MISO: 0x0E},
+		{Kind: fake.Byte, MOSI: 1, MISO: 0x4C},
+		{Kind: fake.Byte, MOSI: 2, MISO: 0x00},
+		{Kind: fake.Byte, MOSI: 0x0F, MISO: 0xF0},
+	}
+	if len(bus.Events) != len(want) {
+		t.Fatalf("events %+v, want %+v", bus.Events, want)
+	}
+	for i := range want {
+		if bus.Events[i] != want[i] {
+			t.Errorf("event %d: %+v, want %+v", i, bus.Events[i], want[i])
+		}
+	}
+}
+
+func TestBusTx(t *testing.T) {
+	tests := []struct {
+		name    string
+		w       []byte
+		r       []byte
+		written []byte
+		read    []byte
+	}{
+		{"write", []byte{1, 2, 3}, nil, []byte{1, 2, 3}, nil},
+		{"read", nil, make([]byte, 3), []byte{0, 0, 0}, []byte{0xA0, 0xA1, 0xA2}},
+		{"longer read", []byte{7}, make([]byte, 2), []byte{7, 0}, []byte{0xA0, 0xA1}},
+		{"longer write", []byte{7, 8, 9}, make([]byte, 1), []byte{7, 8, 9}, []byte{0xA0}},
+	}
+	for _, tt := range tests {
+		bus := fake.New()
+		bus.Replies = []byte{0xA0, 0xA1, 0xA2}
+		err := bus.Tx(tt.w, tt.r)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(bus.Written()) != string(tt.written) {
+			t.Errorf("%s: written %x, want %x", tt.name, bus.Written(), tt.written)
+		}
+		if string(tt.r) != string(tt.read) {
+			t.Errorf("%s: read %x, want %x", tt.name, tt.r, tt.read)
+		}
+	}
+}
+
+func TestBusErr(t *testing.T) {
+	bus := fake.New()
+	bus.Err = errors.New("spi: stuck")
+	if _, err := bus.Transfer(1); err != bus.Err {
+		t.Errorf("Transfer: %v, want %v", err, bus.Err)
+	}
+	if err := bus.Tx([]byte{1, 2}, nil); err != bus.Err {
+		t.Errorf("Tx: %v, want %v", err, bus.Err)
+	}
+	if len(bus.Events) != 0 {
+		t.Errorf("failed transfers recorded: %+v", bus.Events)
+	}
+}
+
+func TestBusPins(t *testing.T) {
+	bus := fake.New()
+	ce, csn := bus.Pin("ce"), bus.Pin("csn")
+	if ce.Get() || csn.Get() {
+		t.Fatalf("pins start high")
+	}
+
+	csn.High()
+	bus.Transfer(0xFF) // outside of a transaction
+	csn.Low()
+	bus.Tx([]byte{0x20, 100}, nil)
+	csn.High()
+	ce.High()
+	csn.Low()
+	bus.Transfer(0xE1)
+	csn.High()
+	csn.Low()
+	bus.Transfer(0xE2) // CSN never goes back high
+
+	if !ce.Get() || csn.Get() {
+		t.Errorf("ce %v, csn %v, want high and low", ce.Get(), csn.Get())
+	}
+	want := [][]byte{{0x20, 100}, {0xE1}}
+	got := bus.Transactions("csn")
+	if len(got) != len(want) {
+		t.Fatalf("transactions %x, want %x", got, want)
+	}
+	for i := range want {
+		if string(got[i]) != string(want[i]) {
+			t.Errorf("transaction %d: %x, want %x", i, got[i], want[i])
+		}
+	}
+	if len(bus.Transactions("ce")) != 0 {
+		t.Errorf("transactions framed by CE: %x", bus.Transactions("ce"))
+	}
+	if string(bus.Written()) != "\xff\x20\x64\xe1\xe2" {
+		t.Errorf("written %x", bus.Written())
+	}
+
+	bus.Reset()
+	if len(bus.Events) != 0 || len(bus.Written()) != 0 {
+		t.Errorf("%d events after Reset", len(bus.Events))
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+
+	err := nrf.SetRFChannel(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nrf.FlushTX()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{
+		{nrf24l01.W_REGISTER | nrf24l01.RF_CH, 100},
+		{nrf24l01.FLUSH_TX},
+	}
+	got := bus.Transactions("csn")
+	if len(got) != len(want) {
+		t.Fatalf("transactions %x, want %x", got, want)
+	}
+	for i := range want {
+		if string(got[i]) != string(want[i]) {
+			t.Errorf("transaction %d: %x, want %x", i, got[i], want[i])
+		}
+	}
+	if string(bus.Written()) != string(append(want[0], want[1]...)) {
+		t.Errorf("written %x", bus.Written())
+	}
+
+	bus.Reset()
+	if len(bus.Events) != 0 {
+		t.Errorf("%d events after Reset", len(bus.Events))
+	}
+}
+
+func TestInvalidChannelDoesNotTouchBus(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+
+	err := nrf.SetRFChannel(nrf24l01.MaxChannel + 1)
+	if err != nrf24l01.ErrInvalidChannel {
+		t.Fatalf("err %v, want ErrInvalidChannel", err)
+	}
+	if len(bus.Events) != 0 {
+		t.Errorf("bus used: %+v", bus.Events)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+
+	// STATUS for the command byte, then the register.
+	bus.Replies = []byte{0x0E, 0x4C}
+	got, err := nrf.GetRegisterState(nrf24l01.RF_CH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0x4C {
+		t.Errorf("RF_CH %#x, want 0x4c", got)
+	}
+
+	bus.Reply = func(mosi byte) byte { return 0x0E | nrf24l01.STATUS_RX_DR }
+	status, err := nrf.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.RXDataReady() {
+		t.Errorf("status %#x without RX_DR", byte(status))
+	}
+}
+
+func TestBusError(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	bus.Err = errors.New("spi: stuck")
+
+	err := nrf.SetRFChannel(10)
+	var busErr *nrf24l01.Error
+	if !errors.As(err, &busErr) {
+		t.Fatalf("err %v, want *nrf24l01.Error", err)
+	}
+	if busErr.Register != nrf24l01.RF_CH || !errors.Is(err, bus.Err) {
+		t.Errorf("err %+v", busErr)
+	}
+	// CSN goes back high after the failed transfer.
+	last := bus.Events[len(bus.Events)-1]
+	if last.Kind != fake.Edge || last.Pin != "csn" || !last.Level {
+		t.Errorf("last event %+v, want CSN high", last)
+	}
+}
+
+func TestIRQ(t *testing.T) {
+	irq := fake.NewIRQ()
+	calls := 0
+	irq.SetInterrupt(func() { calls++ })
+
+	irq.Set(false)
+	irq.Set(false)
+	irq.Set(true)
+	irq.Set(false)
+	if calls != 2 {
+		t.Errorf("%d callbacks, want one per falling edge: 2", calls)
+	}
+	if irq.Get() {
+		t.Errorf("IRQ high after Set(false)")
+	}
+}
@@ -0,0 +1,51 @@
+package nrf24l01
+
+// Enable dynamic payload length (FEATURE.EN_DPL).
+// Pipes use it only if DYNPD is set for them too, see SetPipeDynamicPayload.
+func (d *Device) EnableDynamicPayloadLength(enable bool) error {
+	return d.updateRegister(FEATURE, FEATURE_EN_DPL, enable)
+}
+
+// Enable payload with ACK (FEATURE.EN_ACK_PAY).
+// Requires dynamic payload length on pipe 0 of both PTX and PRX.
+func (d *Device) EnableAckPayload(enable bool) error {
+	return d.updateRegister(FEATURE, FEATURE_EN_ACK_PAY, enable)
+}
+
+// Enable W_TX_PAYLOAD_NOACK command (FEATURE.EN_DYN_ACK).
+func (d *Device) EnableDynamicAck(enable bool) error {
+	return d.updateRegister(FEATURE, FEATURE_EN_DYN_ACK, enable)
+}
+
+// Write payload sent back with the next ACK on pipe (W_ACK_PAYLOAD).
+// Used in RX mode, payload stays in TX FIFO until a packet is received
+// on the pipe. Up to three payloads can be pending.
+//
+// pipe - number of pipe. From 0 to 5.
+//
+// data - 1 to 32 bytes.
+func (d *Device) WriteAckPayload(pipe byte, data []byte) error {
+	if pipe > MaxPipe {
+		return ErrInvalidPipe
+	}
+	if len(data) == 0 || len(data) > MaxPayloadWidth {
+		return ErrPayloadTooLarge
+	}
+
+	status, err := d.GetStatus()
+	if err != nil {
+		return err
+	}
+	if status.TXFull() {
+		return ErrTXFull
+	}
+
+	d.csn.Low()
+	defer d.csn.High()
+
+	_, err = d.spi.Transfer(W_ACK_PAYLOAD | pipe)
+	if err == nil {
+		err = d.spi.Tx(data, nil)
+	}
+	return busError("W_ACK_PAYLOAD", pipe, err)
+}
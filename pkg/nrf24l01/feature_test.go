@@ -0,0 +1,132 @@
+package nrf24l01_test
+
+import (
+	"bytes"
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+// chipReplies sets bus to answer like a chip: STATUS for the command byte,
+// then registers for R_REGISTER and the width for R_RX_PL_WID.
+// W_REGISTER writes the first data byte into regs.
+func chipReplies(bus *fake.Bus, status nrf24l01.Status, regs map[byte]byte, width byte) {
+	if regs == nil {
+		regs = map[byte]byte{}
+	}
+	var command byte
+	index := 0
+	bus.Reply = func(mosi byte) byte {
+		index++
+		// The first byte after CSN low is the command.
+		for i := len(bus.Events) - 1; i >= 0; i-- {
+			e := bus.Events[i]
+			if e.Kind == fake.Byte {
+				break
+			}
+			if e.Pin == "csn" && !e.Level {
+				command, index = mosi, 0
+				return byte(status)
+			}
+		}
+		switch {
+		case command == nrf24l01.R_RX_PL_WID:
+			return width
+		case command < nrf24l01.W_REGISTER:
+			return regs[command]
+		case command < nrf24l01.W_REGISTER+0x20 && index == 1:
+			regs[command-nrf24l01.W_REGISTER] = mosi
+		}
+		return 0
+	}
+}
+
+func TestReceiveInvalidPayloadWidth(t *testing.T) {
+	dynamic := map[byte]byte{nrf24l01.FEATURE: nrf24l01.FEATURE_EN_DPL, nrf24l01.DYNPD: 0x01}
+	tests := []struct {
+		name  string
+		regs  map[byte]byte
+		width byte // R_RX_PL_WID
+		want  error
+	}{
+		{"dynamic 32", dynamic, 32, nil},
+		{"dynamic 33", dynamic, 33, nrf24l01.ErrInvalidPayloadWidth},
+		{"dynamic 0xFF", dynamic, 0xFF, nrf24l01.ErrInvalidPayloadWidth},
+		{"static 32", map[byte]byte{nrf24l01.RX_PW_P0: 32}, 0xFF, nil},
+		{"static 40", map[byte]byte{nrf24l01.RX_PW_P0: 40}, 0, nrf24l01.ErrInvalidPayloadWidth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := fake.New()
+			nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+			chipReplies(bus, nrf24l01.STATUS_RX_DR, tt.regs, tt.width) // pipe 0
+			var buf [nrf24l01.MaxPayloadWidth]byte
+			_, n, ok, err := nrf.Receive(buf[:])
+			if err != tt.want || ok != (tt.want == nil) {
+				t.Fatalf("Receive() = %d bytes, ok %v, err %v, want %v", n, ok, err, tt.want)
+			}
+			flushed := false
+			read := false
+			for _, tr := range bus.Transactions("csn") {
+				flushed = flushed || tr[0] == nrf24l01.FLUSH_RX
+				read = read || tr[0] == nrf24l01.R_RX_PAYLOAD
+			}
+			if tt.want == nil {
+				if flushed || !read || n != nrf24l01.MaxPayloadWidth {
+					t.Errorf("%d bytes, flushed %v", n, flushed)
+				}
+				return
+			}
+			// The corrupted payload isn't read, RX FIFO is flushed and RX_DR cleared.
+			last := bus.Transactions("csn")
+			want := []byte{nrf24l01.W_REGISTER | nrf24l01.STATUS, nrf24l01.STATUS_RX_DR}
+			if read || !flushed || string(last[len(last)-1]) != string(want) {
+				t.Errorf("transactions %x, want FLUSH_RX and RX_DR cleared", last)
+			}
+		})
+	}
+}
+
+func TestWriteAckPayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		pipe   byte
+		data   []byte
+		status nrf24l01.Status
+		want   error
+		bus    bool // want: the bus was used
+	}{
+		{"pipe 6", 6, []byte("ack"), 0x0E, nrf24l01.ErrInvalidPipe, false},
+		{"empty", 0, nil, 0x0E, nrf24l01.ErrPayloadTooLarge, false},
+		{"33 bytes", 0, make([]byte, 33), 0x0E, nrf24l01.ErrPayloadTooLarge, false},
+		{"TX FIFO full", 0, []byte("ack"), 0x0E | nrf24l01.STATUS_TX_FULL, nrf24l01.ErrTXFull, true},
+		{"32 bytes on pipe 5", 5, bytes.Repeat([]byte{0xA5}, 32), 0x0E, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := fake.New()
+			nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+			chipReplies(bus, tt.status, nil, 0)
+			err := nrf.WriteAckPayload(tt.pipe, tt.data)
+			if err != tt.want {
+				t.Fatalf("WriteAckPayload(%d, %d bytes) = %v, want %v", tt.pipe, len(tt.data), err, tt.want)
+			}
+			if used := len(bus.Events) != 0; used != tt.bus {
+				t.Fatalf("bus used %v: %+v", used, bus.Events)
+			}
+			written := false
+			for _, tr := range bus.Transactions("csn") {
+				if tr[0]&^0x07 == nrf24l01.W_ACK_PAYLOAD {
+					written = true
+					if tr[0] != nrf24l01.W_ACK_PAYLOAD|tt.pipe || string(tr[1:]) != string(tt.data) {
+						t.Errorf("transaction %x", tr)
+					}
+				}
+			}
+			if written != (tt.want == nil) {
+				t.Errorf("payload written %v: %x", written, bus.Transactions("csn"))
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package nrf24l01
+
+import (
+	"time"
+)
+
+// IRQPin is the IRQ output of the radio (active low) connected to an input
+// with interrupt support.
+type IRQPin interface {
+	// Get returns current level. false - interrupt is asserted.
+	Get() bool
+
+	// SetInterrupt calls callback on every falling edge of the pin.
+	// nil callback disables interrupt.
+	// Callback can be called from interrupt context, so it must not block.
+	SetInterrupt(callback func()) error
+}
+
+// Attach IRQ pin of the radio.
+//
+// The interrupt only wakes up the device, STATUS is read and cleared
+// later by WaitEvent, Listen or Send, outside of interrupt context.
+func (d *Device) UseIRQ(irq IRQPin) error {
+	signal := make(chan struct{}, 1)
+	err := irq.SetInterrupt(func() {
+		select {
+		case signal <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	d.irq = irq
+	d.irqSignal = signal
+	return nil
+}
+
+// Set which interrupts are reflected on the IRQ pin.
+//
+// mask - any combination of CONFIG_MASK_RX_DR, CONFIG_MASK_TX_DS
+// and CONFIG_MASK_MAX_RT. Masked interrupt is still set in STATUS,
+// but it doesn't assert IRQ pin.
+func (d *Device) SetInterruptMask(mask byte) error {
+	state, err := d.GetRegisterState(CONFIG)
+	if err != nil {
+		return err
+	}
+	return d.SetRegisterState(CONFIG, state&^CONFIG_MASK_IRQ|mask&CONFIG_MASK_IRQ)
+}
+
+// Get interrupts reflected on the IRQ pin.
+// Returns combination of CONFIG_MASK_* bits set to 1 for masked interrupts.
+func (d *Device) GetInterruptMask() (byte, error) {
+	state, err := d.GetRegisterState(CONFIG)
+	if err != nil {
+		return 0, err
+	}
+	return state & CONFIG_MASK_IRQ, nil
+}
+
+// Wait for interrupt from the IRQ pin.
+//
+// Returns STATUS read when interrupt was asserted. Interrupt flags
+// (RX_DR, TX_DS, MAX_RT) are already cleared in the radio, use
+// Status.RXDataReady, Status.TXDataSent and Status.MaxRetries to know
+// the events. With RX_DR, payload is read by Receive.
+//
+// timeout - maximum time to wait. 0 - wait forever.
+func (d *Device) WaitEvent(timeout time.Duration) (Status, error) {
+	if d.irq == nil {
+		return 0, ErrNoIRQ
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	for {
+		if !d.waitIRQ(deadline) {
+			return 0, ErrTimeout
+		}
+
+		status, err := d.GetStatus()
+		if err != nil {
+			return 0, err
+		}
+		if byte(status)&STATUS_IRQ == 0 {
+			// Stale signal, event was already handled.
+			continue
+		}
+
+		err = d.ClearInterrupts(byte(status))
+		if err != nil {
+			return 0, err
+		}
+		return status, nil
+	}
+}
+
+// Listen calls handler for every interrupt from the IRQ pin
+// until handler returns false or error happens.
+func (d *Device) Listen(handler func(status Status) bool) error {
+	for {
+		status, err := d.WaitEvent(0)
+		if err != nil {
+			return err
+		}
+		if !handler(status) {
+			return nil
+		}
+	}
+}
+
+// waitIRQ sleeps until IRQ pin is asserted.
+// Zero deadline - wait forever. Returns false on deadline.
+// Without IRQ pin returns true at once, so the caller polls.
+func (d *Device) waitIRQ(deadline time.Time) bool {
+	if d.irq == nil || !d.irq.Get() {
+		return true
+	}
+
+	if deadline.IsZero() {
+		<-d.irqSignal
+		return true
+	}
+
+	wait := time.Until(deadline)
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-d.irqSignal:
+		return true
+	case <-timer.C:
+		return !d.irq.Get()
+	}
+}
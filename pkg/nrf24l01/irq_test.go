@@ -0,0 +1,170 @@
+package nrf24l01_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+// emulated returns transmitter and receiver with IRQ pins attached,
+// in TX and RX mode.
+func emulated(t *testing.T) (ptx, prx *nrf24l01.Device) {
+	t.Helper()
+	air := emulator.NewAir()
+	ptx, tx := emutest.Chip(t, air, "tx", testConfig())
+	prx, rx := emutest.Chip(t, air, "rx", testConfig())
+	for _, d := range []struct {
+		nrf  *nrf24l01.Device
+		chip *emulator.Chip
+	}{{ptx, tx}, {prx, rx}} {
+		err := d.nrf.UseIRQ(d.chip.IRQ())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ptx.SetTXMode()
+	if err == nil {
+		err = prx.SetRXMode()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ptx, prx
+}
+
+func TestWaitEventRXReady(t *testing.T) {
+	ptx, prx := emulated(t)
+
+	_, err := prx.WaitEvent(time.Millisecond)
+	if err != nrf24l01.ErrTimeout {
+		t.Fatalf("without packets: %v, want ErrTimeout", err)
+	}
+
+	res, err := ptx.Send(10*time.Millisecond, []byte("irq"))
+	if err != nil || !res.Delivered {
+		t.Fatalf("send: %+v %v", res, err)
+	}
+	status, err := prx.WaitEvent(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe, ok := status.RXPipe()
+	if !status.RXDataReady() || !ok || pipe != 0 {
+		t.Errorf("status %#x, want RX_DR on pipe 0", byte(status))
+	}
+
+	// Flags are cleared by WaitEvent.
+	status, err = prx.GetStatus()
+	if err != nil || byte(status)&nrf24l01.STATUS_IRQ != 0 {
+		t.Errorf("status after WaitEvent %#x, err %v", byte(status), err)
+	}
+}
+
+func TestInterruptMask(t *testing.T) {
+	ptx, prx := emulated(t)
+
+	err := prx.SetInterruptMask(nrf24l01.CONFIG_MASK_RX_DR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mask, err := prx.GetInterruptMask()
+	if err != nil || mask != nrf24l01.CONFIG_MASK_RX_DR {
+		t.Fatalf("mask %#x, err %v", mask, err)
+	}
+
+	_, err = ptx.Send(10*time.Millisecond, []byte("masked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = prx.WaitEvent(time.Millisecond)
+	if err != nrf24l01.ErrTimeout {
+		t.Errorf("masked RX_DR: %v, want ErrTimeout", err)
+	}
+	// Masked interrupt is still in STATUS.
+	status, err := prx.GetStatus()
+	if err != nil || !status.RXDataReady() {
+		t.Errorf("status %#x, err %v, want RX_DR", byte(status), err)
+	}
+}
+
+func TestWaitEventMaxRetries(t *testing.T) {
+	ptx, prx := emulated(t)
+
+	prx.Disable()
+	_, err := ptx.Send(10*time.Millisecond, []byte("lost"))
+	if !errors.Is(err, nrf24l01.ErrMaxRetries) {
+		t.Fatalf("send to nobody: %v, want ErrMaxRetries", err)
+	}
+	// Send clears the flags it waits for.
+	_, err = ptx.WaitEvent(time.Millisecond)
+	if err != nrf24l01.ErrTimeout {
+		t.Errorf("after Send: %v, want ErrTimeout", err)
+	}
+}
+
+func TestWaitEventFakeIRQ(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+
+	_, err := nrf.WaitEvent(time.Millisecond)
+	if err != nrf24l01.ErrNoIRQ {
+		t.Fatalf("without IRQ: %v, want ErrNoIRQ", err)
+	}
+
+	irq := fake.NewIRQ()
+	err = nrf.UseIRQ(irq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := byte(nrf24l01.STATUS_TX_DS | nrf24l01.STATUS_RX_P_NO)
+	bus.Reply = func(mosi byte) byte { return status }
+
+	// A pulse of the line is remembered until WaitEvent.
+	irq.Set(false)
+	irq.Set(true)
+	got, err := nrf.WaitEvent(time.Millisecond)
+	if err != nil || !got.TXDataSent() {
+		t.Fatalf("status %#x, err %v, want TX_DS", byte(got), err)
+	}
+	clear := []byte{nrf24l01.W_REGISTER | nrf24l01.STATUS, nrf24l01.STATUS_TX_DS}
+	tr := bus.Transactions("csn")
+	if len(tr) != 2 || string(tr[1]) != string(clear) {
+		t.Errorf("transactions %x, want NOP and clear of TX_DS", tr)
+	}
+
+	// Stale signal: IRQ fired but the flags are already cleared.
+	status = nrf24l01.STATUS_RX_P_NO
+	irq.Set(false)
+	irq.Set(true)
+	_, err = nrf.WaitEvent(time.Millisecond)
+	if err != nrf24l01.ErrTimeout {
+		t.Errorf("stale signal: %v, want ErrTimeout", err)
+	}
+}
+
+func TestListen(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	irq := fake.NewIRQ()
+	err := nrf.UseIRQ(irq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Reply = func(mosi byte) byte { return nrf24l01.STATUS_RX_DR }
+
+	// The line stays asserted, every WaitEvent sees it.
+	irq.Set(false)
+	events := 0
+	err = nrf.Listen(func(status nrf24l01.Status) bool {
+		events++
+		return events < 3
+	})
+	if err != nil || events != 3 {
+		t.Errorf("%d events, err %v, want 3", events, err)
+	}
+}
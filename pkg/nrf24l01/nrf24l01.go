@@ -5,24 +5,26 @@ package nrf24l01
 // https://github.com/tinygo-org/drivers/issues/245
 
 import (
-	"machine"
 	"time"
 )
 
-var err error
-
 type Device struct {
-	spi *machine.SPI // Digital Input	bus
+	spi SPI // Digital Input	bus
+
+	ce  Pin // Digital Input	Chip Enable Activates RX or TX mode
+	csn Pin // Digital Input	SPI Chip Select
 
-	ce  *machine.Pin // Digital Input	Chip Enable Activates RX or TX mode
-	csn *machine.Pin // Digital Input	SPI Chip Select
+	irq       IRQPin        // Digital Output	Maskable interrupt pin. Active low. Optional
+	irqSignal chan struct{} // signaled from the IRQ pin interrupt
 }
 
 // New returns a new NRF device.
 // spi - SPI bus with LSBFirst = false (defualt).
 // ce - use for switch radio to RX or TX.
 // csn - begin-end of transmitting to NRF.
-func New(spi *machine.SPI, ce, csn *machine.Pin) *Device {
+//
+// ce and csn must be already configured as outputs.
+func New(spi SPI, ce, csn Pin) *Device {
 	return &Device{
 		spi: spi,
 		ce:  ce,
@@ -32,9 +34,6 @@ func New(spi *machine.SPI, ce, csn *machine.Pin) *Device {
 
 // Set start values of parameters.
 func (d *Device) Configure() error {
-	d.ce.Configure(machine.PinConfig{Mode: machine.PinOutput})
-	d.csn.Configure(machine.PinConfig{Mode: machine.PinOutput})
-
 	d.Enable()   // start position
 	d.csn.High() // start position
 
@@ -44,7 +43,7 @@ func (d *Device) Configure() error {
 	// Source: https://github.com/AlexGyver/nRF24L01/blob/master/RF24-master/RF24.cpp
 	// SETUP_RETR = 0x04
 	// ARD = 0b01000000  +  ARC = 0b00001111
-	err = d.SetAutoRetransmission(15, 15)
+	err := d.SetAutoRetransmission(15, 15)
 	if err != nil {
 		return err
 	}
@@ -78,8 +77,14 @@ func (d *Device) Configure() error {
 		return err
 	}
 
-	d.FlushRX()
-	d.FlushTX()
+	err = d.FlushRX()
+	if err != nil {
+		return err
+	}
+	err = d.FlushTX()
+	if err != nil {
+		return err
+	}
 
 	d.Disable() // start position
 
@@ -97,10 +102,11 @@ func (d *Device) Disable() {
 }
 
 // Get STATUS-register state.
-func (d *Device) GetStatus() (byte, error) {
+func (d *Device) GetStatus() (Status, error) {
 	d.csn.Low()
 	defer d.csn.High()
-	return d.spi.Transfer(NOP)
+	s, err := d.spi.Transfer(NOP)
+	return Status(s), busError("NOP", NOP, err)
 }
 
 // Get register state.
@@ -108,12 +114,12 @@ func (d *Device) GetStatus() (byte, error) {
 func (d *Device) GetRegisterState(r byte) (byte, error) {
 	d.csn.Low()
 	defer d.csn.High()
-	_, err = d.spi.Transfer(r)
+	_, err := d.spi.Transfer(R_REGISTER | r)
 	if err != nil {
-		// return 0, errors.New("Error with request d.spi.Transfer(r) in nrf24l01.GetRegisterState(r): " + err.Error())
-		return 0, err
+		return 0, busError(opRead, r, err)
 	}
-	return d.spi.Transfer(NOP)
+	s, err := d.spi.Transfer(NOP)
+	return s, busError(opRead, r, err)
 }
 
 // Set register state.
@@ -122,15 +128,28 @@ func (d *Device) GetRegisterState(r byte) (byte, error) {
 func (d *Device) SetRegisterState(r byte, s byte) error {
 	d.csn.Low()
 	defer d.csn.High()
-	_, err = d.spi.Transfer(0x20 + r)
-	if err != nil {
-		return err
+	_, err := d.spi.Transfer(W_REGISTER | r)
+	if err == nil {
+		_, err = d.spi.Transfer(s)
 	}
-	_, err = d.spi.Transfer(s)
+	return busError(opWrite, r, err)
+}
+
+// Update bits of register state (read-modify-write).
+// r - register.
+// bits - mask of bits to change.
+// set - true sets bits to 1, false clears them to 0.
+func (d *Device) updateRegister(r byte, bits byte, set bool) error {
+	state, err := d.GetRegisterState(r)
 	if err != nil {
 		return err
 	}
-	return nil
+	if set {
+		state |= bits
+	} else {
+		state &^= bits
+	}
+	return d.SetRegisterState(r, state)
 }
 
 // Set nrf24l01 to RX-mode.
@@ -185,10 +204,13 @@ func (d *Device) SetTXMode() error {
 }
 
 // Set RF channel.
-// c - channel. Have range only from 0 to 127.
+// c - channel. Have range only from 0 to 125.
 func (d *Device) SetRFChannel(c byte) error {
+	if c > MaxChannel {
+		return ErrInvalidChannel
+	}
 
-	err = d.SetRegisterState(RF_CH, c)
+	err := d.SetRegisterState(RF_CH, c)
 	if err != nil {
 		return err
 	}
@@ -228,17 +250,14 @@ func (d *Device) SetPowerUpMode() error {
 	return nil
 }
 
-//  Flush TX FIFO, used in TX mode.
+//	Flush TX FIFO, used in TX mode.
+//
 // TODO: Need add check that set TX mode.
 func (d *Device) FlushTX() error {
 	d.csn.Low()
 	defer d.csn.High()
-	_, err = d.spi.Transfer(FLUSH_TX)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err := d.spi.Transfer(FLUSH_TX)
+	return busError("FLUSH_TX", FLUSH_TX, err)
 }
 
 // Flush RX FIFO, used in RX mode
@@ -249,12 +268,8 @@ func (d *Device) FlushTX() error {
 func (d *Device) FlushRX() error {
 	d.csn.Low()
 	defer d.csn.High()
-	_, err = d.spi.Transfer(FLUSH_RX)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	_, err := d.spi.Transfer(FLUSH_RX)
+	return busError("FLUSH_RX", FLUSH_RX, err)
 }
 
 // Set 16-bit CRC.
@@ -305,7 +320,7 @@ func (d *Device) Set8CRC() error {
 // ……
 // ‘1111’ – Up to 15 Re-Transmit on fail of AA
 func (d *Device) SetAutoRetransmission(delay byte, count byte) error {
-	err = d.SetRegisterState(SETUP_RETR, delay<<4+count)
+	err := d.SetRegisterState(SETUP_RETR, delay<<4+count)
 	if err != nil {
 		return err
 	}
@@ -423,23 +438,26 @@ func (d *Device) SetRF2MBPS() error {
 
 // Get RX payload width
 func (d *Device) GetRXPayloadWidth() (byte, error) {
-	width, err := d.GetRegisterState(R_RX_PL_WID)
+	d.csn.Low()
+	defer d.csn.High()
+	_, err := d.spi.Transfer(R_RX_PL_WID)
 	if err != nil {
-		return 0, err
+		return 0, busError("R_RX_PL_WID", R_RX_PL_WID, err)
 	}
-	return width, nil
+	width, err := d.spi.Transfer(NOP)
+	return width, busError("R_RX_PL_WID", R_RX_PL_WID, err)
 }
 
 // Enable ‘Auto Acknowledgment’ for all data pipes.
 func (d *Device) EnableAutoAck(enable bool) error {
 	if enable {
-		err = d.SetRegisterState(EN_AA, 0b00111111)
+		err := d.SetRegisterState(EN_AA, 0b00111111)
 		if err != nil {
 			return err
 		}
 		// TODO: setting pipes EN_AA
 	} else {
-		err = d.SetRegisterState(EN_AA, 0b00000000)
+		err := d.SetRegisterState(EN_AA, 0b00000000)
 		if err != nil {
 			return err
 		}
@@ -453,35 +471,18 @@ func (d *Device) EnableAutoAck(enable bool) error {
 // Example: pipe = 0b00000010 - it's pipe 1.
 // Can set multiple pipes.
 func (d *Device) EnablePipesAutoAck(pipes byte, enable bool) error {
-	state, err := d.GetRegisterState(EN_AA)
-	if err != nil {
-		return err
-	}
-
-	if enable {
-		err = d.SetRegisterState(EN_AA, state|pipes)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = d.SetRegisterState(EN_AA, state|pipes-pipes)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return d.updateRegister(EN_AA, pipes&0b00111111, enable)
 }
 
 // Enable dynamic payloads for all data pipes.
 func (d *Device) EnableDynamicPayloads(enable bool) error {
 	if enable {
-		err = d.SetRegisterState(DYNPD, 0b00111111)
+		err := d.SetRegisterState(DYNPD, 0b00111111)
 		if err != nil {
 			return err
 		}
 	} else {
-		err = d.SetRegisterState(DYNPD, 0b00000000)
+		err := d.SetRegisterState(DYNPD, 0b00000000)
 		if err != nil {
 			return err
 		}
@@ -494,35 +495,18 @@ func (d *Device) EnableDynamicPayloads(enable bool) error {
 // Example: pipe = 0b00000010 - it's pipe 1.
 // Can set multiple pipes.
 func (d *Device) EnablePipesDynamicPayloads(pipes byte, enable bool) error {
-	state, err := d.GetRegisterState(EN_AA)
-	if err != nil {
-		return err
-	}
-
-	if enable {
-		err = d.SetRegisterState(EN_AA, state|pipes)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = d.SetRegisterState(EN_AA, state|pipes-pipes)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return d.updateRegister(DYNPD, pipes&0b00111111, enable)
 }
 
 // Enable RX address for all data pipes.
 func (d *Device) EnableRXAddresses(enable bool) error {
 	if enable {
-		err = d.SetRegisterState(EN_RXADDR, 0b00111111)
+		err := d.SetRegisterState(EN_RXADDR, 0b00111111)
 		if err != nil {
 			return err
 		}
 	} else {
-		err = d.SetRegisterState(EN_RXADDR, 0b00000000)
+		err := d.SetRegisterState(EN_RXADDR, 0b00000000)
 		if err != nil {
 			return err
 		}
@@ -535,30 +519,16 @@ func (d *Device) EnableRXAddresses(enable bool) error {
 // Example: pipe = 0b00000010 - it's pipe 1.
 // Can set multiple pipes.
 func (d *Device) EnablePipesRXAddresses(pipes byte, enable bool) error {
-	state, err := d.GetRegisterState(EN_RXADDR)
-	if err != nil {
-		return err
-	}
-
-	if enable {
-		err = d.SetRegisterState(EN_RXADDR, state|pipes)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = d.SetRegisterState(EN_RXADDR, state|pipes-pipes)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return d.updateRegister(EN_RXADDR, pipes&0b00111111, enable)
 }
 
 // Get pipe RX address.
 //
 // pipe - number of pipe. From 0 to 5.
 func (d *Device) GetPipeRXAddress(pipe byte) (byte, error) {
+	if pipe > MaxPipe {
+		return 0, ErrInvalidPipe
+	}
 	return d.GetRegisterState(GetPipesRXAddressRegisters()[pipe])
 }
 
@@ -566,21 +536,14 @@ func (d *Device) GetPipeRXAddress(pipe byte) (byte, error) {
 //
 // pipe - number of pipe. From 0 to 5.
 //
-// address - slice with address. Length must be meeting to register SETUP_AW.
+// address - slice with address. Length must be meeting to register SETUP_AW
+// for pipes 0 and 1, and 1 for pipes 2 to 5 (only LSByte is stored).
 func (d *Device) GetFullPipeRXAddress(pipe byte, address []byte) error {
-	d.csn.Low()
-	defer d.csn.High()
-
-	_, err = d.spi.Transfer(GetPipesRXAddressRegisters()[pipe])
+	err := d.checkPipeAddress(pipe, address)
 	if err != nil {
 		return err
 	}
-	err = d.spi.Tx(nil, address)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return d.getRegisterBytes(GetPipesRXAddressRegisters()[pipe], address)
 }
 
 // Set pipe RX address.
@@ -589,6 +552,9 @@ func (d *Device) GetFullPipeRXAddress(pipe byte, address []byte) error {
 //
 // address - address of pipe.
 func (d *Device) SetPipeRXAddress(pipe, address byte) error {
+	if pipe > MaxPipe {
+		return ErrInvalidPipe
+	}
 	return d.SetRegisterState(GetPipesRXAddressRegisters()[pipe], address)
 }
 
@@ -596,27 +562,23 @@ func (d *Device) SetPipeRXAddress(pipe, address byte) error {
 //
 // pipe - number of pipe. From 0 to 5.
 //
-// address - slice with address. Length must be meeting to register SETUP_AW.
+// address - slice with address. Length must be meeting to register SETUP_AW
+// for pipes 0 and 1, and 1 for pipes 2 to 5 (only LSByte is stored).
 func (d *Device) SetFullPipeRXAddress(pipe byte, address []byte) error {
-	d.csn.Low()
-	defer d.csn.High()
-
-	_, err = d.spi.Transfer(0x20 + GetPipesRXAddressRegisters()[pipe])
-	if err != nil {
-		return err
-	}
-	err = d.spi.Tx(address, nil)
+	err := d.checkPipeAddress(pipe, address)
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return d.setRegisterBytes(GetPipesRXAddressRegisters()[pipe], address)
 }
 
 // Get pipe RX payload width.
 //
 // pipe - number of pipe. From 0 to 5.
 func (d *Device) GetPipeRXPayloadWidth(pipe byte) (byte, error) {
+	if pipe > MaxPipe {
+		return 0, ErrInvalidPipe
+	}
 	return d.GetRegisterState(GetPipesRXPayloadWidthRegisters()[pipe])
 }
 
@@ -634,6 +596,12 @@ func (d *Device) GetPipeRXPayloadWidth(pipe byte) (byte, error) {
 //
 // 32 = 32 bytes
 func (d *Device) SetPipeRXPayloadWidth(pipe, width byte) error {
+	if pipe > MaxPipe {
+		return ErrInvalidPipe
+	}
+	if width > MaxPayloadWidth {
+		return ErrPayloadTooLarge
+	}
 	return d.SetRegisterState(GetPipesRXPayloadWidthRegisters()[pipe], width)
 }
 
@@ -645,15 +613,11 @@ func (d *Device) TransmitDataWithAck(w []byte) error {
 	d.csn.Low()
 	defer d.csn.High()
 
-	_, err = d.spi.Transfer(W_TX_PAYLOAD)
-	if err != nil {
-		return err
+	_, err := d.spi.Transfer(W_TX_PAYLOAD)
+	if err == nil {
+		err = d.spi.Tx(w, nil)
 	}
-	err = d.spi.Tx(w, nil)
-	if err != nil {
-		return err
-	}
-	return nil
+	return busError("W_TX_PAYLOAD", W_TX_PAYLOAD, err)
 }
 
 // Transmit data whithout AUTOACK on this specific packet to TX pipe address.
@@ -664,15 +628,11 @@ func (d *Device) TransmitDataWithoutAck(w []byte) error {
 	d.csn.Low()
 	defer d.csn.High()
 
-	_, err = d.spi.Transfer(W_TX_PAYLOAD_NO_ACK)
-	if err != nil {
-		return err
+	_, err := d.spi.Transfer(W_TX_PAYLOAD_NO_ACK)
+	if err == nil {
+		err = d.spi.Tx(w, nil)
 	}
-	err = d.spi.Tx(w, nil)
-	if err != nil {
-		return err
-	}
-	return nil
+	return busError("W_TX_PAYLOAD_NO_ACK", W_TX_PAYLOAD_NO_ACK, err)
 }
 
 // Receive data to TX pipe address.
@@ -683,68 +643,9 @@ func (d *Device) ReceiveData(r []byte) error {
 	d.csn.Low()
 	defer d.csn.High()
 
-	_, err = d.spi.Transfer(R_RX_PAYLOAD)
-	if err != nil {
-		return err
-	}
-	err = d.spi.Tx(nil, r)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Hear carrier on channels
-//
-// Only for test RX mode.
-func (d *Device) HearChannels() error {
-	// Header channels numbers
-	for i := 0; i < 128; i++ {
-		if i < 100 {
-			print(0)
-		} else {
-			print(1)
-		}
-	}
-	println("")
-	for i := 0; i < 128; i++ {
-		if i/100 > 0 {
-			print((i % 100) / 10)
-		} else {
-			print(i / 10)
-		}
-	}
-	println("")
-	for i := 0; i < 128; i++ {
-		if i/10 > 0 {
-			print(i % 10)
-		} else {
-			print(i)
-		}
-	}
-	println("")
-
-	// Try read PAYLOAD
-	for {
-		for i := 0; i < 128; i++ {
-			err = d.SetRFChannel(byte(i))
-			if err != nil {
-				return err
-			}
-
-			time.Sleep(1000 * time.Microsecond)
-			res, err := d.GetRegisterState(RPD)
-			if err != nil {
-				return err
-			}
-
-			d.FlushRX()
-			d.FlushTX()
-
-			print(res)
-		}
-		println("")
-		time.Sleep(time.Second / 2)
+	_, err := d.spi.Transfer(R_RX_PAYLOAD)
+	if err == nil {
+		err = d.spi.Tx(nil, r)
 	}
+	return busError("R_RX_PAYLOAD", R_RX_PAYLOAD, err)
 }
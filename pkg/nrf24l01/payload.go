@@ -0,0 +1,202 @@
+package nrf24l01
+
+import (
+	"time"
+)
+
+const (
+	// Maximum payload width in bytes.
+	MaxPayloadWidth = 32
+
+	// Minimum CE high pulse to start transmission. Specs p.24 (Thce).
+	cePulse = 10 * time.Microsecond
+)
+
+// SendResult is the outcome of Device.Send.
+type SendResult struct {
+	// Delivered is true when TX_DS was asserted: ACK received,
+	// or packet sent if auto acknowledgement is disabled.
+	Delivered bool
+
+	// Retries - retransmitted packets (OBSERVE_TX.ARC_CNT).
+	Retries byte
+
+	// Lost - lost packets since the last RF_CH write (OBSERVE_TX.PLOS_CNT).
+	Lost byte
+
+	// AckPayload is true when ACK came with payload (RX_DR with TX_DS).
+	// It is in RX FIFO on pipe 0, read it with Receive.
+	AckPayload bool
+}
+
+// Send payload in Enhanced ShockBurst™ mode and wait for completion.
+//
+// Device must be in TX mode. Payload is loaded into TX FIFO, CE is pulsed
+// for at least 10µs and STATUS is polled until TX_DS or MAX_RT is asserted,
+// or until timeout. Flags are cleared after that. On MAX_RT or timeout
+// TX FIFO is flushed and ErrMaxRetries or ErrTimeout is returned with the
+// result read from OBSERVE_TX.
+//
+// If IRQ pin is attached by UseIRQ, STATUS is read only on interrupt,
+// so TX_DS and MAX_RT must not be masked.
+//
+// timeout - maximum time to wait. With ARD=4000µs and ARC=15 a packet can
+// take up to 60ms.
+//
+// payload - 1 to 32 bytes. With static payload length it must be
+// the same as width of pipe on receiver.
+func (d *Device) Send(timeout time.Duration, payload []byte) (SendResult, error) {
+	var res SendResult
+
+	if len(payload) == 0 || len(payload) > MaxPayloadWidth {
+		return res, ErrPayloadTooLarge
+	}
+
+	status, err := d.GetStatus()
+	if err != nil {
+		return res, err
+	}
+	if status.TXFull() {
+		return res, ErrTXFull
+	}
+
+	// Old flags would be taken as the result of this packet.
+	err = d.ClearInterrupts(STATUS_TX_DS | STATUS_MAX_RT)
+	if err != nil {
+		return res, err
+	}
+
+	err = d.TransmitDataWithAck(payload)
+	if err != nil {
+		return res, err
+	}
+
+	d.Disable()
+	d.Enable()
+	time.Sleep(cePulse)
+	d.Disable()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err = d.GetStatus()
+		if err != nil {
+			return res, err
+		}
+		if status.TXDataSent() || status.MaxRetries() {
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		d.waitIRQ(deadline)
+	}
+
+	observe, err := d.GetRegisterState(OBSERVE_TX)
+	if err != nil {
+		return res, err
+	}
+	res.Retries = observe & OBSERVE_TX_ARC_CNT
+	res.Lost = (observe & OBSERVE_TX_PLOS_CNT) >> 4
+	res.Delivered = status.TXDataSent()
+	res.AckPayload = res.Delivered && status.RXDataReady()
+
+	err = d.ClearInterrupts(STATUS_TX_DS | STATUS_MAX_RT)
+	if err != nil {
+		return res, err
+	}
+
+	if res.Delivered {
+		return res, nil
+	}
+
+	err = d.FlushTX()
+	if err != nil {
+		return res, err
+	}
+	if status.MaxRetries() {
+		return res, ErrMaxRetries
+	}
+	return res, ErrTimeout
+}
+
+// Receive the next payload from RX FIFO.
+//
+// buf - buffer for data. If it's shorter than the payload, the rest of
+// payload is lost.
+//
+// pipe - data pipe the payload was received on.
+//
+// n - number of bytes copied into buf.
+//
+// ok - false if RX FIFO is empty, nothing was read.
+//
+// Payload width is read by R_RX_PL_WID when dynamic payload length is enabled
+// for the pipe, otherwise from RX_PW_Px. RX_DR is cleared after reading.
+// If R_RX_PL_WID is over 32 bytes the payload is corrupted: RX FIFO is
+// flushed and ErrInvalidPayloadWidth is returned.
+//
+// In TX mode it reads ACK payloads, received on pipe 0.
+func (d *Device) Receive(buf []byte) (pipe int, n int, ok bool, err error) {
+	status, err := d.GetStatus()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	p, ok := status.RXPipe()
+	if !ok {
+		return 0, 0, false, nil
+	}
+
+	width, err := d.payloadWidth(p)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var data [MaxPayloadWidth]byte
+	err = d.ReceiveData(data[:width])
+	if err != nil {
+		return 0, 0, false, err
+	}
+	n = copy(buf, data[:width])
+
+	err = d.ClearInterrupts(STATUS_RX_DR)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	return int(p), n, true, nil
+}
+
+// payloadWidth returns width of the top payload in RX FIFO received on pipe.
+func (d *Device) payloadWidth(pipe byte) (byte, error) {
+	feature, err := d.GetRegisterState(FEATURE)
+	if err != nil {
+		return 0, err
+	}
+	dynpd, err := d.GetRegisterState(DYNPD)
+	if err != nil {
+		return 0, err
+	}
+
+	var width byte
+	if feature&FEATURE_EN_DPL != 0 && dynpd>>pipe&1 != 0 {
+		width, err = d.GetRXPayloadWidth()
+	} else {
+		width, err = d.GetPipeRXPayloadWidth(pipe)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if width > MaxPayloadWidth {
+		// Specs p.51: flush RX FIFO if the read value is larger than 32 bytes.
+		err = d.FlushRX()
+		if err != nil {
+			return 0, err
+		}
+		err = d.ClearInterrupts(STATUS_RX_DR)
+		if err != nil {
+			return 0, err
+		}
+		return 0, ErrInvalidPayloadWidth
+	}
+	return width, nil
+}
@@ -0,0 +1,132 @@
+package nrf24l01_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+const sendTimeout = 10 * time.Millisecond
+
+func TestSendPayloadWidth(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	for _, n := range []int{0, nrf24l01.MaxPayloadWidth + 1} {
+		_, err := nrf.Send(sendTimeout, make([]byte, n))
+		if err != nrf24l01.ErrPayloadTooLarge {
+			t.Errorf("%d bytes: %v, want ErrPayloadTooLarge", n, err)
+		}
+	}
+	if len(bus.Events) != 0 {
+		t.Errorf("bus used: %+v", bus.Events)
+	}
+}
+
+func TestSendTXFull(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	bus.Reply = func(mosi byte) byte { return 0x0E | nrf24l01.STATUS_TX_FULL }
+	_, err := nrf.Send(sendTimeout, []byte("full"))
+	if err != nrf24l01.ErrTXFull {
+		t.Fatalf("err %v, want ErrTXFull", err)
+	}
+	if bytes.IndexByte(bus.Written(), nrf24l01.W_TX_PAYLOAD) >= 0 {
+		t.Errorf("payload written into full TX FIFO: %x", bus.Written())
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	// The radio never asserts TX_DS or MAX_RT.
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	bus.Reply = func(mosi byte) byte { return 0x0E }
+	start := time.Now()
+	res, err := nrf.Send(2*time.Millisecond, []byte("nobody"))
+	if err != nrf24l01.ErrTimeout || res.Delivered {
+		t.Fatalf("%+v %v, want ErrTimeout", res, err)
+	}
+	if time.Since(start) < 2*time.Millisecond {
+		t.Errorf("returned after %v, before the timeout", time.Since(start))
+	}
+	written := bus.Written()
+	payload := bytes.IndexByte(written, nrf24l01.W_TX_PAYLOAD)
+	if payload < 0 || written[len(written)-1] != nrf24l01.FLUSH_TX {
+		t.Errorf("written %x, want W_TX_PAYLOAD and FLUSH_TX at the end", written)
+	}
+}
+
+func TestSendMaxRetries(t *testing.T) {
+	air := emulator.NewAir()
+	ptx, _ := emutest.Pair(t, air, emutest.Config(testAddress))
+	air.Drop = func(from, to *emulator.Chip) bool { return true }
+
+	res, err := ptx.Send(sendTimeout, []byte("lost"))
+	if !errors.Is(err, nrf24l01.ErrMaxRetries) || res.Delivered || res.Retries != 3 {
+		t.Fatalf("%+v %v, want ErrMaxRetries after 3 retries", res, err)
+	}
+	// The payload is flushed and MAX_RT cleared, the next packet goes.
+	fifo, err := ptx.GetFIFOStatus()
+	if err != nil || !fifo.TXEmpty() {
+		t.Errorf("FIFO_STATUS %#x %v, want TX_EMPTY", byte(fifo), err)
+	}
+	status, err := ptx.GetStatus()
+	if err != nil || status.MaxRetries() || status.TXDataSent() {
+		t.Errorf("STATUS %#x %v, want flags cleared", byte(status), err)
+	}
+
+	air.Drop = nil
+	res, err = ptx.Send(sendTimeout, []byte("next"))
+	if err != nil || !res.Delivered || res.Retries != 0 {
+		t.Errorf("next packet: %+v %v", res, err)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	ptx, prx := emutest.Pair(t, emulator.NewAir(), emutest.Config(testAddress))
+	var buf [nrf24l01.MaxPayloadWidth]byte
+	_, _, ok, err := prx.Receive(buf[:])
+	if ok || err != nil {
+		t.Fatalf("empty RX FIFO: ok %v, err %v", ok, err)
+	}
+
+	payloads := []string{"first", "second payload"}
+	for _, p := range payloads {
+		_, err = ptx.Send(sendTimeout, []byte(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, p := range payloads {
+		pipe, n, ok, err := prx.Receive(buf[:])
+		if err != nil || !ok || pipe != 0 || string(buf[:n]) != p {
+			t.Fatalf("payload %d: %q pipe %d ok %v err %v", i, buf[:n], pipe, ok, err)
+		}
+		// RX_DR is cleared for every payload, RX_P_NO shows the next one.
+		status, err := prx.GetStatus()
+		if err != nil || status.RXDataReady() {
+			t.Errorf("payload %d: STATUS %#x %v, want RX_DR cleared", i, byte(status), err)
+		}
+		if _, ok := status.RXPipe(); ok != (i < len(payloads)-1) {
+			t.Errorf("payload %d: STATUS %#x, more payloads %v", i, byte(status), ok)
+		}
+	}
+
+	// A short buffer gets the start of the payload.
+	_, err = ptx.Send(sendTimeout, []byte("truncated"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, n, ok, err := prx.Receive(buf[:5])
+	if err != nil || !ok || string(buf[:n]) != "trunc" {
+		t.Errorf("short buffer: %q ok %v err %v", buf[:n], ok, err)
+	}
+	if _, _, ok, _ := prx.Receive(buf[:]); ok {
+		t.Errorf("rest of the payload received")
+	}
+}
@@ -1,14 +1,21 @@
 package nrf24l01
 
-// var addressLengthArray = [3]byte{3, 4, 5}
+// Maximum data pipe number.
+const MaxPipe = 5
 
+// Pipe is the setup of one RX data pipe.
+//
+// Pipes 0 and 1 have full addresses (SETUP_AW bytes). Pipes 2 to 5 have
+// only the LSByte, MSBytes are equal to pipe 1.
 type Pipe struct {
-	EnableAutoAck        byte // 1 - yes / 0 - no
-	EnableRXAddress      byte // 1 - yes / 0 - no
-	RXAddress            byte
-	FullRXAddress        []byte
-	RXPayloadWidth       byte
-	DynamicPayloadLength byte // 1 - yes / 0 - no
+	Enabled        bool // EN_RXADDR
+	AutoAck        bool // EN_AA
+	DynamicPayload bool // DYNPD. Works only with FEATURE.EN_DPL
+	PayloadWidth   byte // RX_PW_Px, 1 to 32 bytes. 0 - pipe not used. Not used with DynamicPayload
+
+	// RX_ADDR_Px, LSByte first. SETUP_AW bytes for pipes 0 and 1,
+	// 1 byte for pipes 2 to 5. nil keeps the current address on writing.
+	Address []byte
 }
 
 // Get array of registers of pipes RX address
@@ -25,88 +32,142 @@ func GetPipesRXPayloadWidthRegisters() [6]byte {
 //
 // n - pipe number. Allowed only 0...5.
 //
-// pipe - strusture for loading data.
+// pipe - strusture for loading data. Address is allocated if it
+// doesn't have the width of pipe address.
 func (d *Device) GetPipeConfig(n byte, pipe *Pipe) error {
-	pipe.EnableAutoAck, err = d.GetRegisterState(EN_AA)
-	if err != nil {
-		return err
+	if n > MaxPipe {
+		return ErrInvalidPipe
 	}
-	pipe.EnableAutoAck = pipe.EnableAutoAck >> n & 1
 
-	pipe.EnableRXAddress, err = d.GetRegisterState(EN_RXADDR)
-	if err != nil {
-		return err
+	var regs [3]byte // EN_AA, EN_RXADDR, DYNPD
+	for i, r := range [...]byte{EN_AA, EN_RXADDR, DYNPD} {
+		state, err := d.GetRegisterState(r)
+		if err != nil {
+			return err
+		}
+		regs[i] = state >> n & 1
 	}
-	pipe.EnableRXAddress = pipe.EnableRXAddress >> n & 1
+	pipe.AutoAck = regs[0] == 1
+	pipe.Enabled = regs[1] == 1
+	pipe.DynamicPayload = regs[2] == 1
 
-	pipe.RXAddress, err = d.GetRegisterState(GetPipesRXAddressRegisters()[n])
+	width, err := d.pipeAddressWidth(n)
 	if err != nil {
 		return err
 	}
-
-	err = d.GetFullPipeRXAddress(n, pipe.FullRXAddress)
-	if err != nil {
-		return err
+	if len(pipe.Address) != width {
+		pipe.Address = make([]byte, width)
 	}
-
-	pipe.RXPayloadWidth, err = d.GetRegisterState(GetPipesRXPayloadWidthRegisters()[n])
+	err = d.getRegisterBytes(GetPipesRXAddressRegisters()[n], pipe.Address)
 	if err != nil {
 		return err
 	}
 
-	pipe.DynamicPayloadLength, err = d.GetRegisterState(DYNPD)
+	pipe.PayloadWidth, err = d.GetRegisterState(GetPipesRXPayloadWidthRegisters()[n])
 	if err != nil {
 		return err
 	}
-	pipe.EnableRXAddress = pipe.EnableRXAddress >> n & 1
 
 	return nil
 }
 
 // Write pipe config from "pipe" to nrf24l01.
+// All flags are written, set or cleared, other pipes are not changed.
 //
 // n - pipe number. Allowed only 0...5.
 //
 // pipe - strusture with data.
 func (d *Device) SetPipeConfig(n byte, pipe *Pipe) error {
-	res, err := d.GetRegisterState(EN_AA)
-	if err != nil {
-		return err
+	if n > MaxPipe {
+		return ErrInvalidPipe
 	}
-	err = d.SetRegisterState(EN_AA, pipe.EnableAutoAck<<n|res)
-	if err != nil {
-		return err
+	if pipe.PayloadWidth > MaxPayloadWidth {
+		return ErrPayloadTooLarge
+	}
+	if pipe.Address != nil {
+		err := d.checkPipeAddress(n, pipe.Address)
+		if err != nil {
+			return err
+		}
 	}
 
-	res, err = d.GetRegisterState(EN_RXADDR)
+	err := d.updateRegister(EN_AA, 1<<n, pipe.AutoAck)
 	if err != nil {
 		return err
 	}
-	err = d.SetRegisterState(EN_AA, pipe.EnableRXAddress<<n|res)
+
+	err = d.updateRegister(EN_RXADDR, 1<<n, pipe.Enabled)
 	if err != nil {
 		return err
 	}
 
-	err = d.SetRegisterState(GetPipesRXAddressRegisters()[n], pipe.RXAddress)
-	if err != nil {
-		return err
+	if pipe.Address != nil {
+		err = d.setRegisterBytes(GetPipesRXAddressRegisters()[n], pipe.Address)
+		if err != nil {
+			return err
+		}
 	}
 
-	err = d.SetFullPipeRXAddress(n, pipe.FullRXAddress)
+	err = d.SetRegisterState(GetPipesRXPayloadWidthRegisters()[n], pipe.PayloadWidth)
 	if err != nil {
 		return err
 	}
 
-	err = d.SetRegisterState(GetPipesRXPayloadWidthRegisters()[n], pipe.RXPayloadWidth)
-	if err != nil {
-		return err
+	return d.updateRegister(DYNPD, 1<<n, pipe.DynamicPayload)
+}
+
+// Enable or disable data pipe (EN_RXADDR).
+//
+// n - pipe number. Allowed only 0...5.
+func (d *Device) SetPipeEnabled(n byte, enable bool) error {
+	if n > MaxPipe {
+		return ErrInvalidPipe
+	}
+	return d.updateRegister(EN_RXADDR, 1<<n, enable)
+}
+
+// Enable or disable ‘Auto Acknowledgment’ for data pipe (EN_AA).
+//
+// n - pipe number. Allowed only 0...5.
+func (d *Device) SetPipeAutoAck(n byte, enable bool) error {
+	if n > MaxPipe {
+		return ErrInvalidPipe
+	}
+	return d.updateRegister(EN_AA, 1<<n, enable)
+}
+
+// Enable or disable dynamic payload length for data pipe (DYNPD).
+// FEATURE.EN_DPL must be set too.
+//
+// n - pipe number. Allowed only 0...5.
+func (d *Device) SetPipeDynamicPayload(n byte, enable bool) error {
+	if n > MaxPipe {
+		return ErrInvalidPipe
 	}
+	return d.updateRegister(DYNPD, 1<<n, enable)
+}
 
-	res, err = d.GetRegisterState(DYNPD)
+// checkPipeAddress returns error if address doesn't fit the pipe.
+func (d *Device) checkPipeAddress(n byte, address []byte) error {
+	if n > MaxPipe {
+		return ErrInvalidPipe
+	}
+	width, err := d.pipeAddressWidth(n)
 	if err != nil {
 		return err
 	}
-	err = d.SetRegisterState(DYNPD, pipe.DynamicPayloadLength<<n|res)
-
+	if len(address) != width {
+		return ErrInvalidAddress
+	}
 	return nil
 }
+
+// pipeAddressWidth returns number of address bytes stored for pipe:
+// SETUP_AW for pipes 0 and 1, 1 for pipes 2 to 5.
+func (d *Device) pipeAddressWidth(n byte) (int, error) {
+	if n >= 2 {
+		return 1, nil
+	}
+	width, err := d.GetAddressWidth()
+	return int(width), err
+}
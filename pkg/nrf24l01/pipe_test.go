@@ -0,0 +1,169 @@
+package nrf24l01_test
+
+import (
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+func TestPipeConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		n    byte
+		pipe nrf24l01.Pipe
+		// EN_AA, EN_RXADDR and DYNPD after writing, power on: 0x3F, 0x03, 0x00
+		enAA, enRXAddr, dynpd byte
+	}{
+		{
+			name:     "pipe 0 all set",
+			n:        0,
+			pipe:     nrf24l01.Pipe{Enabled: true, AutoAck: true, DynamicPayload: true, PayloadWidth: 32, Address: []byte("PIPE0")},
+			enAA:     0x3F,
+			enRXAddr: 0x03,
+			dynpd:    0x01,
+		},
+		{
+			name:     "pipe 1 all cleared",
+			n:        1,
+			pipe:     nrf24l01.Pipe{Address: []byte("PIPE1")},
+			enAA:     0x3D,
+			enRXAddr: 0x01,
+			dynpd:    0x00,
+		},
+		{
+			name:     "pipe 2 LSByte",
+			n:        2,
+			pipe:     nrf24l01.Pipe{Enabled: true, PayloadWidth: 4, Address: []byte{0x12}},
+			enAA:     0x3B,
+			enRXAddr: 0x07,
+			dynpd:    0x00,
+		},
+		{
+			name:     "pipe 5 dynamic",
+			n:        5,
+			pipe:     nrf24l01.Pipe{Enabled: true, AutoAck: true, DynamicPayload: true, Address: []byte{0x15}},
+			enAA:     0x3F,
+			enRXAddr: 0x23,
+			dynpd:    0x20,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, chip := emutest.PowerOn("chip")
+			err := nrf.SetPipeConfig(tt.n, &tt.pipe)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for r, want := range map[byte]byte{
+				nrf24l01.EN_AA:     tt.enAA,
+				nrf24l01.EN_RXADDR: tt.enRXAddr,
+				nrf24l01.DYNPD:     tt.dynpd,
+			} {
+				if got := chip.Register(r); got != want {
+					t.Errorf("%s = %#x, want %#x", nrf24l01.RegisterName(r), got, want)
+				}
+			}
+
+			var got nrf24l01.Pipe
+			err = nrf.GetPipeConfig(tt.n, &got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Enabled != tt.pipe.Enabled || got.AutoAck != tt.pipe.AutoAck ||
+				got.DynamicPayload != tt.pipe.DynamicPayload || got.PayloadWidth != tt.pipe.PayloadWidth ||
+				string(got.Address) != string(tt.pipe.Address) {
+				t.Errorf("GetPipeConfig = %+v, want %+v", got, tt.pipe)
+			}
+		})
+	}
+}
+
+func TestPipeConfigKeepsAddress(t *testing.T) {
+	nrf, _ := emutest.PowerOn("chip")
+	err := nrf.SetPipeConfig(3, &nrf24l01.Pipe{Enabled: true, PayloadWidth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got nrf24l01.Pipe
+	err = nrf.GetPipeConfig(3, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Address) != "\xC4" {
+		t.Errorf("pipe 3 address %x, want power on c4", got.Address)
+	}
+}
+
+func TestPipeConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		n    byte
+		pipe nrf24l01.Pipe
+		want error
+	}{
+		{"pipe 6", 6, nrf24l01.Pipe{}, nrf24l01.ErrInvalidPipe},
+		{"payload width", 0, nrf24l01.Pipe{PayloadWidth: 33}, nrf24l01.ErrPayloadTooLarge},
+		{"pipe 1 LSByte only", 1, nrf24l01.Pipe{Address: []byte{1}}, nrf24l01.ErrInvalidAddress},
+		{"pipe 2 full address", 2, nrf24l01.Pipe{Address: []byte("PIPE2")}, nrf24l01.ErrInvalidAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, chip := emutest.PowerOn("chip")
+			err := nrf.SetPipeConfig(tt.n, &tt.pipe)
+			if err != tt.want {
+				t.Errorf("err %v, want %v", err, tt.want)
+			}
+			if chip.Register(nrf24l01.EN_RXADDR) != 0x03 {
+				t.Errorf("registers written on error")
+			}
+		})
+	}
+
+	nrf, _ := emutest.PowerOn("chip")
+	var pipe nrf24l01.Pipe
+	if err := nrf.GetPipeConfig(6, &pipe); err != nrf24l01.ErrInvalidPipe {
+		t.Errorf("GetPipeConfig(6): %v, want ErrInvalidPipe", err)
+	}
+}
+
+func TestPipeFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		set    func(nrf *nrf24l01.Device, n byte, enable bool) error
+		reg    byte
+		before byte // power on state
+	}{
+		{"enabled", (*nrf24l01.Device).SetPipeEnabled, nrf24l01.EN_RXADDR, 0x03},
+		{"auto-ack", (*nrf24l01.Device).SetPipeAutoAck, nrf24l01.EN_AA, 0x3F},
+		{"dynamic payload", (*nrf24l01.Device).SetPipeDynamicPayload, nrf24l01.DYNPD, 0x00},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, chip := emutest.PowerOn("chip")
+			for n := byte(0); n <= nrf24l01.MaxPipe; n++ {
+				err := tt.set(nrf, n, true)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := chip.Register(tt.reg); got != tt.before|1<<n {
+					t.Fatalf("set pipe %d: %#x", n, got)
+				}
+				err = tt.set(nrf, n, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := chip.Register(tt.reg); got != tt.before&^(1<<n) {
+					t.Fatalf("clear pipe %d: %#x", n, got)
+				}
+				err = tt.set(nrf, n, tt.before>>n&1 == 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.set(nrf, 6, true); err != nrf24l01.ErrInvalidPipe {
+				t.Errorf("pipe 6: %v, want ErrInvalidPipe", err)
+			}
+		})
+	}
+}
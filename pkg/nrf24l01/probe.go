@@ -0,0 +1,191 @@
+package nrf24l01
+
+import (
+	"time"
+)
+
+// Variant is the chip found by Probe.
+type Variant byte
+
+const (
+	VariantNone         Variant = iota // chip doesn't answer
+	VariantNRF24L01                    // no 250kbps and RPD
+	VariantNRF24L01Plus                // nRF24L01+, with 250kbps and RPD
+)
+
+func (v Variant) String() string {
+	switch v {
+	case VariantNRF24L01:
+		return "nRF24L01"
+	case VariantNRF24L01Plus:
+		return "nRF24L01+"
+	}
+	return "none"
+}
+
+// Probe checks that the chip answers on SPI and finds out its variant.
+//
+// A pattern is written to RX_ADDR_P2 and read back, then RF_DR_LOW of
+// RF_SETUP is set: nRF24L01 keeps it 0, nRF24L01+ supports 250kbps (and RPD).
+// Both registers are restored.
+//
+// Returns ErrBusStuck if every byte read is 0x00 (MISO is held low),
+// ErrChipNotPresent if every byte is 0xFF (nothing drives MISO) or the
+// pattern reads back wrong.
+func (d *Device) Probe() (Variant, error) {
+	status, err := d.GetStatus()
+	if err != nil {
+		return VariantNone, err
+	}
+	saved, err := d.GetRegisterState(RX_ADDR_P2)
+	if err != nil {
+		return VariantNone, err
+	}
+
+	// STATUS bit 7 is always 0, answer 0xFF is not a chip.
+	read := []byte{byte(status), saved}
+	for _, pattern := range [...]byte{0xA5, 0x5A} {
+		err = d.SetRegisterState(RX_ADDR_P2, pattern)
+		if err != nil {
+			return VariantNone, err
+		}
+		got, err := d.GetRegisterState(RX_ADDR_P2)
+		if err != nil {
+			return VariantNone, err
+		}
+		if got != pattern {
+			return VariantNone, stuckError(append(read, got))
+		}
+	}
+	err = d.SetRegisterState(RX_ADDR_P2, saved)
+	if err != nil {
+		return VariantNone, err
+	}
+
+	rfSetup, err := d.GetRegisterState(RF_SETUP)
+	if err != nil {
+		return VariantNone, err
+	}
+	err = d.SetRegisterState(RF_SETUP, rfSetup|RF_SETUP_RF_DR_LOW)
+	if err != nil {
+		return VariantNone, err
+	}
+	got, err := d.GetRegisterState(RF_SETUP)
+	if err != nil {
+		return VariantNone, err
+	}
+	err = d.SetRegisterState(RF_SETUP, rfSetup)
+	if err != nil {
+		return VariantNone, err
+	}
+
+	if got&RF_SETUP_RF_DR_LOW == 0 {
+		return VariantNRF24L01, nil
+	}
+	return VariantNRF24L01Plus, nil
+}
+
+// stuckError returns error for bytes read from a not answering chip.
+func stuckError(read []byte) error {
+	for _, b := range read {
+		if b != 0x00 {
+			return ErrChipNotPresent
+		}
+	}
+	return ErrBusStuck
+}
+
+// SelfTest loops a packet through the chip: the packet is written into
+// TX FIFO and sent without auto acknowledgement, so no receiver is needed.
+// FIFO_STATUS is checked on every step and TX_DS must be asserted after the
+// CE pulse, that checks SPI, CE and the RF part of the chip.
+//
+// The test changes CONFIG and EN_AA, FIFOs are flushed. Call it before
+// Apply, the radio is left in power down mode (CE low).
+// Returns *SelfTestError on failure.
+func (d *Device) SelfTest() error {
+	_, err := d.Probe()
+	if err != nil {
+		return err
+	}
+
+	d.Disable()
+	err = d.SetRegisterState(EN_AA, 0)
+	if err != nil {
+		return err
+	}
+	err = d.SetRegisterState(CONFIG, CONFIG_EN_CRC|CONFIG_PWR_UP) // PRIM_RX = 0
+	if err != nil {
+		return err
+	}
+	// Start up from power down to standby-I (Tpd2stby). Specs p.22.
+	time.Sleep(5 * time.Millisecond)
+
+	err = d.FlushTX()
+	if err != nil {
+		return err
+	}
+	err = d.FlushRX()
+	if err != nil {
+		return err
+	}
+	err = d.ClearInterrupts(STATUS_IRQ)
+	if err != nil {
+		return err
+	}
+
+	err = d.expectFIFO("flush", FIFO_STATUS_TX_EMPTY|FIFO_STATUS_RX_EMPTY)
+	if err != nil {
+		return err
+	}
+
+	err = d.TransmitDataWithAck([]byte{0xA5, 0x5A, 0x0F, 0xF0})
+	if err != nil {
+		return err
+	}
+	err = d.expectFIFO("write payload", FIFO_STATUS_RX_EMPTY)
+	if err != nil {
+		return err
+	}
+
+	d.Enable()
+	time.Sleep(cePulse)
+	d.Disable()
+
+	var status Status
+	deadline := time.Now().Add(10 * time.Millisecond)
+	for {
+		status, err = d.GetStatus()
+		if err != nil {
+			return err
+		}
+		if status.TXDataSent() || time.Now().After(deadline) {
+			break
+		}
+	}
+	fifo, err := d.GetFIFOStatus()
+	if err != nil {
+		return err
+	}
+	if !status.TXDataSent() || fifo != FIFO_STATUS_TX_EMPTY|FIFO_STATUS_RX_EMPTY {
+		return &SelfTestError{Step: "transmit", FIFOStatus: fifo}
+	}
+
+	err = d.ClearInterrupts(STATUS_IRQ)
+	if err != nil {
+		return err
+	}
+	return d.SetPowerDownMode()
+}
+
+// expectFIFO returns *SelfTestError if FIFO_STATUS isn't want.
+func (d *Device) expectFIFO(step string, want FIFOStatus) error {
+	fifo, err := d.GetFIFOStatus()
+	if err != nil {
+		return err
+	}
+	if fifo != want {
+		return &SelfTestError{Step: step, FIFOStatus: fifo}
+	}
+	return nil
+}
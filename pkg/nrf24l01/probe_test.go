@@ -0,0 +1,116 @@
+package nrf24l01_test
+
+import (
+	"errors"
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+func TestProbeBus(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func(mosi byte) byte
+		want  error
+	}{
+		{"no chip", func(mosi byte) byte { return 0xFF }, nrf24l01.ErrChipNotPresent},
+		{"MISO stuck low", func(mosi byte) byte { return 0x00 }, nrf24l01.ErrBusStuck},
+		{"MISO echoes MOSI", func(mosi byte) byte { return mosi }, nrf24l01.ErrChipNotPresent},
+		{"registers don't keep values", func(mosi byte) byte { return 0x0E }, nrf24l01.ErrChipNotPresent},
+	}
+	for _, tt := range tests {
+		bus := fake.New()
+		nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+		bus.Reply = tt.reply
+		variant, err := nrf.Probe()
+		if err != tt.want || variant != nrf24l01.VariantNone {
+			t.Errorf("%s: Probe() = %s, %v, want %v", tt.name, variant, err, tt.want)
+		}
+		if err := nrf.SelfTest(); err != tt.want {
+			t.Errorf("%s: SelfTest() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	for _, tt := range []struct {
+		plus bool
+		want nrf24l01.Variant
+	}{
+		{false, nrf24l01.VariantNRF24L01},
+		{true, nrf24l01.VariantNRF24L01Plus},
+	} {
+		nrf, chip := emutest.PowerOn("chip")
+		chip.Plus = tt.plus
+		err := nrf.SetRegisterState(nrf24l01.RF_SETUP, byte(nrf24l01.DataRate2Mbps)|byte(nrf24l01.PALevelLow))
+		if err != nil {
+			t.Fatal(err)
+		}
+		variant, err := nrf.Probe()
+		if err != nil || variant != tt.want {
+			t.Errorf("Probe() = %s, %v, want %s", variant, err, tt.want)
+		}
+		// The registers used by Probe are restored.
+		if got := chip.Register(nrf24l01.RX_ADDR_P2); got != 0xC3 {
+			t.Errorf("%s: RX_ADDR_P2 = %#x, want 0xc3", tt.want, got)
+		}
+		if got := chip.Register(nrf24l01.RF_SETUP); got != byte(nrf24l01.DataRate2Mbps)|byte(nrf24l01.PALevelLow) {
+			t.Errorf("%s: RF_SETUP = %#x", tt.want, got)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	nrf, chip := emutest.PowerOn("chip")
+	err := nrf.TransmitDataWithAck([]byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nrf.SelfTest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Power down, FIFOs empty and flags cleared.
+	if chip.Register(nrf24l01.CONFIG)&nrf24l01.CONFIG_PWR_UP != 0 || chip.TXCount() != 0 || chip.RXCount() != 0 ||
+		chip.Register(nrf24l01.STATUS)&nrf24l01.STATUS_IRQ != 0 {
+		t.Errorf("after SelfTest: CONFIG %#x, STATUS %#x, TX %d, RX %d", chip.Register(nrf24l01.CONFIG),
+			chip.Register(nrf24l01.STATUS), chip.TXCount(), chip.RXCount())
+	}
+}
+
+func TestSelfTestFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		fifo byte // FIFO_STATUS, it never changes
+		step string
+	}{
+		{"TX FIFO not flushed", 0x01, "flush"},
+		{"RX FIFO not flushed", 0x10, "flush"},
+		{"payload not written", 0x11, "write payload"},
+	}
+	for _, tt := range tests {
+		bus := fake.New()
+		nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+		chipReplies(bus, 0x0E, map[byte]byte{nrf24l01.FIFO_STATUS: tt.fifo}, 0)
+		err := nrf.SelfTest()
+		var selfTest *nrf24l01.SelfTestError
+		if !errors.As(err, &selfTest) || !errors.Is(err, nrf24l01.ErrSelfTestFailed) {
+			t.Fatalf("%s: err %v, want *SelfTestError", tt.name, err)
+		}
+		if selfTest.Step != tt.step || byte(selfTest.FIFOStatus) != tt.fifo {
+			t.Errorf("%s: %+v, want step %q", tt.name, selfTest, tt.step)
+		}
+	}
+
+	// CE isn't connected, the chip never sends the payload.
+	bus := fake.New()
+	_, chip := emutest.PowerOn("chip")
+	nrf := nrf24l01.New(chip, bus.Pin("ce"), chip.CSN())
+	err := nrf.SelfTest()
+	var selfTest *nrf24l01.SelfTestError
+	if !errors.As(err, &selfTest) || selfTest.Step != "transmit" || selfTest.FIFOStatus.TXEmpty() {
+		t.Errorf("CE not connected: %v, want *SelfTestError at transmit", err)
+	}
+}
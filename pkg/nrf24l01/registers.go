@@ -1,43 +1,50 @@
 package nrf24l01
 
+import (
+	"strconv"
+)
+
 const (
 	// ------------------- CONFIG -------------------
 	// Configuration Register
 	CONFIG = 0x00
 
-	// // Mask interrupt caused by RX_DR
-	// // 1: Interrupt not reflected on the IRQ pin
-	// // 0: Reflect RX_DR as active low interrupt on the
-	// // IRQ pin
-	// CONFIG_MASK_RX_DR = 0b01000000 // 6 R/W
+	// Mask interrupt caused by RX_DR
+	// 1: Interrupt not reflected on the IRQ pin
+	// 0: Reflect RX_DR as active low interrupt on the
+	// IRQ pin
+	CONFIG_MASK_RX_DR = 0b01000000 // 6 R/W
+
+	// Mask interrupt caused by TX_DS
+	// 1: Interrupt not reflected on the IRQ pin
+	// 0: Reflect TX_DS as active low interrupt on the IRQ
+	// pin
+	CONFIG_MASK_TX_DS = 0b00100000 // 5 R/W
 
-	// // Mask interrupt caused by TX_DS
-	// // 1: Interrupt not reflected on the IRQ pin
-	// // 0: Reflect TX_DS as active low interrupt on the IRQ
-	// // pin
-	// CONFIG_MASK_TX_DS = 0b00100000 // 5 R/W
+	// Mask interrupt caused by MAX_RT
+	// 1: Interrupt not reflected on the IRQ pin
+	// 0: Reflect MAX_RT as active low interrupt on the
+	// IRQ pin
+	CONFIG_MASK_MAX_RT = 0b00010000 // 4 R/W
 
-	// // Mask interrupt caused by MAX_RT
-	// // 1: Interrupt not reflected on the IRQ pin
-	// // 0: Reflect MAX_RT as active low interrupt on the
-	// // IRQ pin
-	// CONFIG_MASK_MAX_RT = 0b00010000 // 4 R/W
+	// All interrupt masks.
+	CONFIG_MASK_IRQ = CONFIG_MASK_RX_DR | CONFIG_MASK_TX_DS | CONFIG_MASK_MAX_RT
 
-	// // Enable CRC. Forced high if one of the bits in the
-	// // EN_AA is high
-	// CONFIG_EN_CRC = 0b00001000 // 3  R/W
+	// Enable CRC. Forced high if one of the bits in the
+	// EN_AA is high
+	CONFIG_EN_CRC = 0b00001000 // 3  R/W
 
-	// // CRC encoding scheme
-	// // '0' - 1 byte
-	// // '1' – 2 bytes
-	// CONFIG_CRCO = 0b00000100 // 2 R/W
+	// CRC encoding scheme
+	// '0' - 1 byte
+	// '1' – 2 bytes
+	CONFIG_CRCO = 0b00000100 // 2 R/W
 
-	// // 1: POWER UP, 0:POWER DOWN
-	// CONFIG_PWR_UP = 0b00000010 // 1 R/W
+	// 1: POWER UP, 0:POWER DOWN
+	CONFIG_PWR_UP = 0b00000010 // 1 R/W
 
-	// // RX/TX control
-	// // 1: PRX, 0: PTX
-	// CONFIG_PRIM_RX = 0b00000001 // 0 R/W
+	// RX/TX control
+	// 1: PRX, 0: PTX
+	CONFIG_PRIM_RX = 0b00000001 // 0 R/W
 
 	// --------------------- EN_AA ---------------------
 	// Enhanced ShockBurst™
@@ -94,6 +101,20 @@ const (
 	// Setup of Automatic Retransmission
 	SETUP_RETR = 0x04
 
+	// Auto Retransmit Delay
+	// ‘0000’ – Wait 250µS
+	// ‘0001’ – Wait 500µS
+	// ……..
+	// ‘1111’ – Wait 4000µS
+	SETUP_RETR_ARD = 0b11110000 // 7:4 R/W
+
+	// Auto Retransmit Count
+	// ‘0000’ –Re-Transmit disabled
+	// ‘0001’ – Up to 1 Re-Transmit on fail of AA
+	// ……
+	// ‘1111’ – Up to 15 Re-Transmit on fail of AA
+	SETUP_RETR_ARC = 0b00001111 // 3:0 R/W
+
 	// --------------------- RF_CH ---------------------
 	// RF Channel
 	RF_CH = 0x05
@@ -102,16 +123,82 @@ const (
 	// RF Setup Register
 	RF_SETUP = 0x06
 
+	// Enables continuous carrier transmit when high.
+	RF_SETUP_CONT_WAVE = 0b10000000 // 7 R/W
+
+	// Set RF Data Rate to 250kbps. See RF_DR_HIGH
+	// for encoding.
+	RF_SETUP_RF_DR_LOW = 0b00100000 // 5 R/W
+
+	// Force PLL lock signal. Only used in test
+	RF_SETUP_PLL_LOCK = 0b00010000 // 4 R/W
+
+	// Select between the high speed data rates. This bit
+	// is don’t care if RF_DR_LOW is set.
+	// Encoding:
+	// [RF_DR_LOW, RF_DR_HIGH]:
+	// ‘00’ – 1Mbps
+	// ‘01’ – 2Mbps
+	// ‘10’ – 250kbps
+	// ‘11’ – Reserved
+	RF_SETUP_RF_DR_HIGH = 0b00001000 // 3 R/W
+
+	// Set RF output power in TX mode
+	// '00' – -18dBm
+	// '01' – -12dBm
+	// '10' – -6dBm
+	// '11' – 0dBm
+	RF_SETUP_RF_PWR = 0b00000110 // 2:1 R/W
+
 	// -------------------- STATUS ---------------------
 	// Status Register (In parallel to the SPI command
 	// word applied on the MOSI pin, the STATUS register
 	// is shifted serially out on the MISO pin)
 	STATUS = 0x07
 
+	// Data Ready RX FIFO interrupt. Asserted when
+	// new data arrives RX FIFO. Write 1 to clear bit.
+	STATUS_RX_DR = 0b01000000 // 6 R/W
+
+	// Data Sent TX FIFO interrupt. Asserted when
+	// packet transmitted on TX. If AUTO_ACK is activated,
+	// this bit is set high only when ACK is received.
+	// Write 1 to clear bit.
+	STATUS_TX_DS = 0b00100000 // 5 R/W
+
+	// Maximum number of TX retransmits interrupt
+	// Write 1 to clear bit. If MAX_RT is asserted it must
+	// be cleared to enable further communication.
+	STATUS_MAX_RT = 0b00010000 // 4 R/W
+
+	// All interrupt flags.
+	STATUS_IRQ = STATUS_RX_DR | STATUS_TX_DS | STATUS_MAX_RT
+
+	// Data pipe number for the payload available for
+	// reading from RX_FIFO
+	// 000-101: Data Pipe Number
+	// 110: Not Used
+	// 111: RX FIFO Empty
+	STATUS_RX_P_NO = 0b00001110 // 3:1 R
+
+	// TX FIFO full flag.
+	// 1: TX FIFO full.
+	// 0: Available locations in TX FIFO.
+	STATUS_TX_FULL = 0b00000001 // 0 R
+
 	// ------------------ OBSERVE_TX -------------------
 	// Transmit observe register
 	OBSERVE_TX = 0x08
 
+	// Count lost packets. The counter is overflow pro-
+	// tected to 15, and discontinues at max until reset.
+	// The counter is reset by writing to RF_CH.
+	OBSERVE_TX_PLOS_CNT = 0b11110000 // 7:4 R
+
+	// Count retransmitted packets. The counter is reset
+	// when transmission of a new packet starts.
+	OBSERVE_TX_ARC_CNT = 0b00001111 // 3:0 R
+
 	// ---------------------- RPD ----------------------
 	// Received Power Detector. This register is called
 	// CD (Carrier Detect) in the nRF24L01. The name is
@@ -217,6 +304,34 @@ const (
 	// FIFO Status Register
 	FIFO_STATUS = 0x17
 
+	// Used for a PTX device
+	// Pulse the rfce high for at least 10µs to Reuse last
+	// transmitted payload. TX payload reuse is active
+	// until W_TX_PAYLOAD or FLUSH TX is executed.
+	// TX_REUSE is set by the SPI command
+	// REUSE_TX_PL, and is reset by the SPI commands
+	// W_TX_PAYLOAD or FLUSH TX
+	FIFO_STATUS_TX_REUSE = 0b01000000 // 6 R
+
+	// TX FIFO full flag. 1: TX FIFO full. 0: Available loca-
+	// tions in TX FIFO.
+	FIFO_STATUS_TX_FULL = 0b00100000 // 5 R
+
+	// TX FIFO empty flag.
+	// 1: TX FIFO empty.
+	// 0: Data in TX FIFO.
+	FIFO_STATUS_TX_EMPTY = 0b00010000 // 4 R
+
+	// RX FIFO full flag.
+	// 1: RX FIFO full.
+	// 0: Available locations in RX FIFO.
+	FIFO_STATUS_RX_FULL = 0b00000010 // 1 R
+
+	// RX FIFO empty flag.
+	// 1: RX FIFO empty.
+	// 0: Data in RX FIFO.
+	FIFO_STATUS_RX_EMPTY = 0b00000001 // 0 R
+
 	// ------------------ DYNPD ------------------------
 	// Enable dynamic payload length
 	DYNPD = 0x1C
@@ -224,4 +339,72 @@ const (
 	// ----------------- FEATURE -----------------------
 	// Feature Register
 	FEATURE = 0x1D
+
+	// Enables Dynamic Payload Length
+	FEATURE_EN_DPL = 0b00000100 // 2 R/W
+
+	// Enables Payload with ACK
+	FEATURE_EN_ACK_PAY = 0b00000010 // 1 R/W
+
+	// Enables the W_TX_PAYLOAD_NOACK command
+	FEATURE_EN_DYN_ACK = 0b00000001 // 0 R/W
 )
+
+// Get name of register, as in the datasheet.
+func RegisterName(r byte) string {
+	switch r {
+	case CONFIG:
+		return "CONFIG"
+	case EN_AA:
+		return "EN_AA"
+	case EN_RXADDR:
+		return "EN_RXADDR"
+	case SETUP_AW:
+		return "SETUP_AW"
+	case SETUP_RETR:
+		return "SETUP_RETR"
+	case RF_CH:
+		return "RF_CH"
+	case RF_SETUP:
+		return "RF_SETUP"
+	case STATUS:
+		return "STATUS"
+	case OBSERVE_TX:
+		return "OBSERVE_TX"
+	case RPD:
+		return "RPD"
+	case RX_ADDR_P0:
+		return "RX_ADDR_P0"
+	case RX_ADDR_P1:
+		return "RX_ADDR_P1"
+	case RX_ADDR_P2:
+		return "RX_ADDR_P2"
+	case RX_ADDR_P3:
+		return "RX_ADDR_P3"
+	case RX_ADDR_P4:
+		return "RX_ADDR_P4"
+	case RX_ADDR_P5:
+		return "RX_ADDR_P5"
+	case TX_ADDR:
+		return "TX_ADDR"
+	case RX_PW_P0:
+		return "RX_PW_P0"
+	case RX_PW_P1:
+		return "RX_PW_P1"
+	case RX_PW_P2:
+		return "RX_PW_P2"
+	case RX_PW_P3:
+		return "RX_PW_P3"
+	case RX_PW_P4:
+		return "RX_PW_P4"
+	case RX_PW_P5:
+		return "RX_PW_P5"
+	case FIFO_STATUS:
+		return "FIFO_STATUS"
+	case DYNPD:
+		return "DYNPD"
+	case FEATURE:
+		return "FEATURE"
+	}
+	return "0x" + strconv.FormatUint(uint64(r), 16)
+}
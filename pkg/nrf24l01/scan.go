@@ -0,0 +1,125 @@
+package nrf24l01
+
+import (
+	"time"
+)
+
+// Minimum time in RX mode before RPD is valid. Specs p.25 (Tstby2a + Tdelay_AGC).
+const rpdSettle = 170 * time.Microsecond
+
+// ChannelReport is the result of Scan.
+type ChannelReport struct {
+	// Scanned channels.
+	Channels []byte
+
+	// RPD hits per channel, the same index as in Channels.
+	// Each channel is sampled once per sweep.
+	Hits []int
+
+	// Number of sweeps.
+	Sweeps int
+}
+
+// Quietest returns the channel with the fewest hits.
+// The first one wins among equal channels.
+func (r *ChannelReport) Quietest() byte {
+	if len(r.Channels) == 0 {
+		return 0
+	}
+	best := 0
+	for i, h := range r.Hits {
+		if h < r.Hits[best] {
+			best = i
+		}
+	}
+	return r.Channels[best]
+}
+
+// Scan samples the Received Power Detector (RPD) on channels.
+// RPD is set when a carrier over -64dBm is on the channel, so hits show
+// how busy the channel is with other 2.4GHz devices.
+//
+// channels - channels to scan, nil - all channels 0 to 125.
+//
+// dwell - time in RX mode on every channel before RPD is read,
+// at least 170µs.
+//
+// sweeps - number of passes over all channels.
+//
+// The radio is switched to RX mode for scanning. After it CE is low,
+// RF_CH is restored and RX FIFO is flushed, set the mode again with
+// SetRXMode or SetTXMode.
+// nRF24L01 (not +) has Carrier Detect (CD) in place of RPD, it works the same.
+func (d *Device) Scan(channels []byte, dwell time.Duration, sweeps int) (ChannelReport, error) {
+	if channels == nil {
+		channels = make([]byte, MaxChannel+1)
+		for i := range channels {
+			channels[i] = byte(i)
+		}
+	}
+	for _, ch := range channels {
+		if ch > MaxChannel {
+			return ChannelReport{}, ErrInvalidChannel
+		}
+	}
+	if sweeps < 1 {
+		sweeps = 1
+	}
+	if dwell < rpdSettle {
+		dwell = rpdSettle
+	}
+
+	report := ChannelReport{
+		Channels: channels,
+		Hits:     make([]int, len(channels)),
+		Sweeps:   sweeps,
+	}
+
+	saved, err := d.GetRegisterState(RF_CH)
+	if err != nil {
+		return report, err
+	}
+
+	err = d.SetRXMode()
+	if err != nil {
+		return report, err
+	}
+
+	for sweep := 0; sweep < sweeps; sweep++ {
+		for i, ch := range channels {
+			d.Disable()
+			err = d.SetRFChannel(ch)
+			if err != nil {
+				return report, err
+			}
+			d.Enable()
+			time.Sleep(dwell)
+
+			rpd, err := d.GetRPD()
+			if err != nil {
+				return report, err
+			}
+			if rpd {
+				report.Hits[i]++
+			}
+		}
+	}
+
+	d.Disable()
+	err = d.SetRFChannel(saved)
+	if err != nil {
+		return report, err
+	}
+	return report, d.FlushRX()
+}
+
+// GetRPD reads the Received Power Detector. In RX mode it's latched when
+// a valid packet is received, so read right after a packet it tells
+// whether the packet was stronger than -64dBm.
+func (d *Device) GetRPD() (bool, error) {
+	rpd, err := d.GetRegisterState(RPD)
+	if err != nil {
+		return false, err
+	}
+	return rpd&1 != 0, nil
+}
@@ -0,0 +1,124 @@
+package nrf24l01_test
+
+import (
+	"testing"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+)
+
+func TestScan(t *testing.T) {
+	const sweeps = 40
+	air := emulator.NewAir()
+	noise := emulator.NewInterference(1)
+	noise.Set(10, 10, 1)
+	noise.Set(20, 20, 0.5)
+	air.Noise = noise.Carrier
+	nrf, chip := emutest.Chip(t, air, "scanner", testConfig())
+
+	report, err := nrf.Scan([]byte{10, 20, 30}, 0, sweeps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sweeps != sweeps || len(report.Hits) != 3 {
+		t.Fatalf("report %+v", report)
+	}
+	if report.Hits[0] != sweeps {
+		t.Errorf("busy channel 10: %d hits, want %d", report.Hits[0], sweeps)
+	}
+	if report.Hits[1] == 0 || report.Hits[1] == sweeps {
+		t.Errorf("half busy channel 20: %d hits of %d", report.Hits[1], sweeps)
+	}
+	if report.Hits[2] != 0 {
+		t.Errorf("quiet channel 30: %d hits, want 0", report.Hits[2])
+	}
+	if q := report.Quietest(); q != 30 {
+		t.Errorf("Quietest() = %d, want 30", q)
+	}
+
+	// Channel of the config is back, CE low and RX FIFO empty.
+	if ch := chip.Register(nrf24l01.RF_CH); ch != 40 {
+		t.Errorf("RF_CH = %d after Scan, want 40", ch)
+	}
+	if chip.CE().Get() {
+		t.Errorf("CE high after Scan")
+	}
+	if chip.RXCount() != 0 {
+		t.Errorf("%d payloads in RX FIFO after Scan", chip.RXCount())
+	}
+}
+
+func TestScanAllChannels(t *testing.T) {
+	nrf, _ := emutest.Chip(t, emulator.NewAir(), "scanner", testConfig())
+	report, err := nrf.Scan(nil, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Channels) != nrf24l01.MaxChannel+1 || report.Sweeps != 1 {
+		t.Fatalf("%d channels, %d sweeps, want all channels once", len(report.Channels), report.Sweeps)
+	}
+	for i, ch := range report.Channels {
+		if int(ch) != i || report.Hits[i] != 0 {
+			t.Fatalf("channel %d: %d with %d hits on quiet air", i, ch, report.Hits[i])
+		}
+	}
+}
+
+func TestScanInvalidChannel(t *testing.T) {
+	nrf, chip := emutest.Chip(t, emulator.NewAir(), "scanner", testConfig())
+	config := chip.Register(nrf24l01.CONFIG)
+	_, err := nrf.Scan([]byte{10, nrf24l01.MaxChannel + 1}, 0, 1)
+	if err != nrf24l01.ErrInvalidChannel {
+		t.Fatalf("err %v, want ErrInvalidChannel", err)
+	}
+	if chip.Register(nrf24l01.RF_CH) != 40 || chip.Register(nrf24l01.CONFIG) != config || chip.CE().Get() {
+		t.Errorf("radio changed by an invalid scan")
+	}
+}
+
+func TestGetRPD(t *testing.T) {
+	air := emulator.NewAir()
+	air.Noise = func(channel byte) bool { return true }
+	nrf := emutest.Radio(t, air, "scanner", testConfig())
+
+	rpd, err := nrf.GetRPD()
+	if err != nil || rpd {
+		t.Errorf("RPD %t in power down, err %v", rpd, err)
+	}
+	err = nrf.SetRXMode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rpd, err = nrf.GetRPD()
+	if err != nil || !rpd {
+		t.Errorf("RPD %t listening on a busy channel, err %v", rpd, err)
+	}
+	nrf.Disable()
+	rpd, err = nrf.GetRPD()
+	if err != nil || rpd {
+		t.Errorf("RPD %t with CE low, err %v", rpd, err)
+	}
+}
+
+func TestQuietest(t *testing.T) {
+	tests := []struct {
+		name   string
+		report nrf24l01.ChannelReport
+		want   byte
+	}{
+		{"empty", nrf24l01.ChannelReport{}, 0},
+		{"one channel", nrf24l01.ChannelReport{Channels: []byte{7}, Hits: []int{3}}, 7},
+		{"fewest hits", nrf24l01.ChannelReport{Channels: []byte{1, 2, 3}, Hits: []int{5, 0, 2}}, 2},
+		{"last", nrf24l01.ChannelReport{Channels: []byte{1, 2, 3}, Hits: []int{5, 4, 1}}, 3},
+		{"first of equal", nrf24l01.ChannelReport{Channels: []byte{9, 8, 7}, Hits: []int{2, 1, 1}}, 8},
+		{"all equal", nrf24l01.ChannelReport{Channels: []byte{60, 40, 20}, Hits: []int{0, 0, 0}}, 60},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.report.Quietest(); got != tt.want {
+				t.Errorf("Quietest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
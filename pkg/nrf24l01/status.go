@@ -0,0 +1,77 @@
+package nrf24l01
+
+// Status is the state of STATUS register.
+type Status byte
+
+// RXDataReady - data ready RX FIFO interrupt (RX_DR).
+// Asserted when new data arrives RX FIFO.
+func (s Status) RXDataReady() bool {
+	return s&STATUS_RX_DR != 0
+}
+
+// TXDataSent - data sent TX FIFO interrupt (TX_DS).
+// Asserted when packet transmitted on TX. If AUTO_ACK is activated,
+// this bit is set high only when ACK is received.
+func (s Status) TXDataSent() bool {
+	return s&STATUS_TX_DS != 0
+}
+
+// MaxRetries - maximum number of TX retransmits interrupt (MAX_RT).
+// If MAX_RT is asserted it must be cleared to enable further communication.
+func (s Status) MaxRetries() bool {
+	return s&STATUS_MAX_RT != 0
+}
+
+// RXPipe returns data pipe number for the payload available for reading
+// from RX FIFO (RX_P_NO). ok is false when RX FIFO is empty.
+func (s Status) RXPipe() (pipe byte, ok bool) {
+	pipe = byte(s&STATUS_RX_P_NO) >> 1
+	return pipe, pipe <= 5
+}
+
+// TXFull - TX FIFO full flag (TX_FULL).
+func (s Status) TXFull() bool {
+	return s&STATUS_TX_FULL != 0
+}
+
+// FIFOStatus is the state of FIFO_STATUS register.
+type FIFOStatus byte
+
+// TXReuse - payload is reused by REUSE_TX_PL command (TX_REUSE).
+func (s FIFOStatus) TXReuse() bool {
+	return s&FIFO_STATUS_TX_REUSE != 0
+}
+
+// TXFull - TX FIFO full flag (TX_FULL).
+func (s FIFOStatus) TXFull() bool {
+	return s&FIFO_STATUS_TX_FULL != 0
+}
+
+// TXEmpty - TX FIFO empty flag (TX_EMPTY).
+func (s FIFOStatus) TXEmpty() bool {
+	return s&FIFO_STATUS_TX_EMPTY != 0
+}
+
+// RXFull - RX FIFO full flag (RX_FULL).
+func (s FIFOStatus) RXFull() bool {
+	return s&FIFO_STATUS_RX_FULL != 0
+}
+
+// RXEmpty - RX FIFO empty flag (RX_EMPTY).
+func (s FIFOStatus) RXEmpty() bool {
+	return s&FIFO_STATUS_RX_EMPTY != 0
+}
+
+// Get FIFO_STATUS-register state.
+func (d *Device) GetFIFOStatus() (FIFOStatus, error) {
+	s, err := d.GetRegisterState(FIFO_STATUS)
+	return FIFOStatus(s), err
+}
+
+// Clear interrupts in STATUS register.
+//
+// mask - any combination of STATUS_RX_DR, STATUS_TX_DS and STATUS_MAX_RT.
+// Flags are cleared by writing 1, other bits are written as 0.
+func (d *Device) ClearInterrupts(mask byte) error {
+	return d.SetRegisterState(STATUS, mask&STATUS_IRQ)
+}
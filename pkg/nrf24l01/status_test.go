@@ -0,0 +1,130 @@
+package nrf24l01_test
+
+import (
+	"testing"
+	"time"
+
+	"joystick/pkg/nrf24l01"
+	"joystick/pkg/nrf24l01/emulator"
+	"joystick/pkg/nrf24l01/emulator/emutest"
+	"joystick/pkg/nrf24l01/fake"
+)
+
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		status     nrf24l01.Status
+		rxReady    bool
+		txSent     bool
+		maxRetries bool
+		pipe       byte
+		ok         bool
+		txFull     bool
+	}{
+		{0x0E, false, false, false, 7, false, false}, // power on, RX FIFO empty
+		{0x00, false, false, false, 0, true, false},
+		{0x4A, true, false, false, 5, true, false},
+		{0x42, true, false, false, 1, true, false},
+		{0x0C, false, false, false, 6, false, false}, // not used
+		{0x2E, false, true, false, 7, false, false},
+		{0x1F, false, false, true, 7, false, true},
+		{0x7F, true, true, true, 7, false, true},
+		{0x01, false, false, false, 0, true, true},
+	}
+	for _, tt := range tests {
+		s := tt.status
+		pipe, ok := s.RXPipe()
+		if s.RXDataReady() != tt.rxReady || s.TXDataSent() != tt.txSent || s.MaxRetries() != tt.maxRetries ||
+			pipe != tt.pipe || ok != tt.ok || s.TXFull() != tt.txFull {
+			t.Errorf("status %#x: RX_DR %v, TX_DS %v, MAX_RT %v, pipe %d %v, TX_FULL %v",
+				byte(s), s.RXDataReady(), s.TXDataSent(), s.MaxRetries(), pipe, ok, s.TXFull())
+		}
+	}
+}
+
+func TestFIFOStatus(t *testing.T) {
+	tests := []struct {
+		fifo                   nrf24l01.FIFOStatus
+		reuse, txFull, txEmpty bool
+		rxFull, rxEmpty        bool
+	}{
+		{0x11, false, false, true, false, true}, // power on
+		{0x00, false, false, false, false, false},
+		{0x22, false, true, false, true, false},
+		{0x40, true, false, false, false, false},
+		{0x73, true, true, true, true, true},
+	}
+	for _, tt := range tests {
+		f := tt.fifo
+		if f.TXReuse() != tt.reuse || f.TXFull() != tt.txFull || f.TXEmpty() != tt.txEmpty ||
+			f.RXFull() != tt.rxFull || f.RXEmpty() != tt.rxEmpty {
+			t.Errorf("FIFO_STATUS %#x: TX_REUSE %v, TX_FULL %v, TX_EMPTY %v, RX_FULL %v, RX_EMPTY %v",
+				byte(f), f.TXReuse(), f.TXFull(), f.TXEmpty(), f.RXFull(), f.RXEmpty())
+		}
+	}
+}
+
+func TestGetFIFOStatus(t *testing.T) {
+	nrf, _ := emutest.PowerOn("chip")
+	fifo, err := nrf.GetFIFOStatus()
+	if err != nil || byte(fifo) != 0x11 {
+		t.Fatalf("power on: %#x %v, want 0x11", byte(fifo), err)
+	}
+	// TX FIFO is 3 payloads deep, CE is low and nothing is sent.
+	for i := 0; i < 3; i++ {
+		err = nrf.TransmitDataWithAck([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fifo, err = nrf.GetFIFOStatus()
+	if err != nil || !fifo.TXFull() || fifo.TXEmpty() || !fifo.RXEmpty() {
+		t.Errorf("3 payloads: %#x %v, want TX_FULL", byte(fifo), err)
+	}
+	status, err := nrf.GetStatus()
+	if err != nil || !status.TXFull() {
+		t.Errorf("STATUS %#x %v, want TX_FULL", byte(status), err)
+	}
+}
+
+func TestClearInterrupts(t *testing.T) {
+	bus := fake.New()
+	nrf := nrf24l01.New(bus, bus.Pin("ce"), bus.Pin("csn"))
+	// Only the flags are written, RX_P_NO and TX_FULL are read only.
+	err := nrf.ClearInterrupts(0xFF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{nrf24l01.W_REGISTER | nrf24l01.STATUS, nrf24l01.STATUS_IRQ}
+	got := bus.Transactions("csn")
+	if len(got) != 1 || string(got[0]) != string(want) {
+		t.Errorf("transactions %x, want %x", got, want)
+	}
+
+	// On the chip, writing 1 clears only the given flag.
+	ptx, prx := emutest.Pair(t, emulator.NewAir(), emutest.Config(testAddress))
+	_, err = ptx.Send(10*time.Millisecond, []byte("flags"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _ := prx.GetStatus()
+	if !status.RXDataReady() {
+		t.Fatalf("receiver STATUS %#x, want RX_DR", byte(status))
+	}
+	err = prx.ClearInterrupts(nrf24l01.STATUS_TX_DS | nrf24l01.STATUS_MAX_RT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ = prx.GetStatus(); !status.RXDataReady() {
+		t.Errorf("RX_DR cleared by TX_DS|MAX_RT: %#x", byte(status))
+	}
+	err = prx.ClearInterrupts(nrf24l01.STATUS_RX_DR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ = prx.GetStatus(); status.RXDataReady() {
+		t.Errorf("RX_DR not cleared: %#x", byte(status))
+	}
+	if pipe, ok := status.RXPipe(); !ok || pipe != 0 {
+		t.Errorf("payload lost with the flag: pipe %d %v", pipe, ok)
+	}
+}
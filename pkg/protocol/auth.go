@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+)
+
+// Authenticated packet is the packet with the auth flag in Type, followed by:
+//
+//	offset size field
+//	18     2    Epoch, high 16 bits of the counter, little endian
+//	20     6    MAC, HMAC-SHA256 of bytes 0 to 19, truncated
+//
+// The counter is Epoch<<16 | Seq. The sender must never reuse it with the
+// same key: Epoch is stored in flash, increased at every start and when Seq
+// wraps around. The receiver rejects counters it has seen, and after
+// a restart the epochs it accepted before (see Auth.Resume).
+const (
+	MACSize  = 6
+	AuthSize = Size + 2 + MACSize
+
+	offEpoch = Size
+	offMAC   = offEpoch + 2
+
+	// flagAuth in Type marks authenticated packets.
+	flagAuth = 0x80
+)
+
+var (
+	ErrAuth   = errors.New("protocol: authentication failed")
+	ErrReplay = errors.New("protocol: replayed packet")
+	ErrMode   = errors.New("protocol: packet mode (plain, authenticated, sealed) mismatch")
+)
+
+// Auth authenticates packets with a pre-shared key (see bind.Binding).
+// One Auth is used by one side of a link: the sender sets Epoch, the
+// receiver keeps the replay window in it.
+type Auth struct {
+	// Epoch of the sender, see AuthSize.
+	Epoch uint16
+
+	mac    hash.Hash
+	sum    [sha256.Size]byte
+	window replayWindow
+}
+
+// NewAuth returns Auth with key, 16 to 64 bytes.
+func NewAuth(key []byte) *Auth {
+	return &Auth{mac: hmac.New(sha256.New, key)}
+}
+
+// Reset forgets the replay window, for example when the key is changed.
+func (a *Auth) Reset() {
+	a.window = replayWindow{}
+}
+
+// Resume starts the replay window of the receiver after epoch, the last
+// one accepted before a restart: packets of it and older epochs are
+// rejected.
+func (a *Auth) Resume(epoch uint16) {
+	a.window.resume(epoch)
+}
+
+// LastEpoch returns the epoch of the newest packet accepted by the
+// receiver. Save it and Resume after it at the next start.
+func (a *Auth) LastEpoch() uint16 {
+	return a.window.epoch()
+}
+
+// sign returns MAC of data.
+func (a *Auth) sign(data []byte) []byte {
+	a.mac.Reset()
+	a.mac.Write(data)
+	return a.mac.Sum(a.sum[:0])[:MACSize]
+}
+
+// MarshalAuth writes authenticated packet into buf, at least AuthSize bytes.
+// Returns number of written bytes, always AuthSize.
+func (p *Packet) MarshalAuth(buf []byte, a *Auth) (int, error) {
+	if len(buf) < AuthSize {
+		return 0, ErrShortBuffer
+	}
+	q := *p
+	q.Type |= flagAuth
+	_, err := q.Marshal(buf)
+	if err != nil {
+		return 0, err
+	}
+	binary.LittleEndian.PutUint16(buf[offEpoch:], a.Epoch)
+	copy(buf[offMAC:], a.sign(buf[:offMAC]))
+	return AuthSize, nil
+}
+
+// UnmarshalAuth reads authenticated packet from data. Packets with bad MAC
+// return ErrAuth, already received packets ErrReplay. On error p isn't
+// changed.
+func (p *Packet) UnmarshalAuth(data []byte, a *Auth) error {
+	if len(data) < AuthSize {
+		return ErrShortBuffer
+	}
+	if data[offType]&(flagAuth|flagSealed) != flagAuth {
+		return ErrMode
+	}
+	if !hmac.Equal(data[offMAC:AuthSize], a.sign(data[:offMAC])) {
+		return ErrAuth
+	}
+	var q Packet
+	err := q.unmarshal(data)
+	if err != nil {
+		return err
+	}
+	counter := uint32(binary.LittleEndian.Uint16(data[offEpoch:]))<<16 | uint32(q.Seq)
+	if !a.window.check(counter) {
+		return ErrReplay
+	}
+	q.Type &^= flagAuth
+	*p = q
+	return nil
+}
@@ -0,0 +1,250 @@
+package protocol
+
+import (
+	"testing"
+)
+
+var (
+	testKey  = []byte("0123456789abcdef")
+	otherKey = []byte("fedcba9876543210")
+)
+
+// mode is one way to send packets: authenticated or sealed.
+type mode struct {
+	name      string
+	size      int
+	marshal   func(p *Packet, buf []byte) (int, error)
+	unmarshal func(p *Packet, data []byte) error
+	epoch     func(e uint16) // of the sender
+	resume    func(e uint16) // of the receiver
+	last      func() uint16  // of the receiver
+}
+
+func authMode(key []byte) mode {
+	tx, rx := NewAuth(key), NewAuth(key)
+	return mode{
+		name:      "auth",
+		size:      AuthSize,
+		marshal:   func(p *Packet, buf []byte) (int, error) { return p.MarshalAuth(buf, tx) },
+		unmarshal: func(p *Packet, data []byte) error { return p.UnmarshalAuth(data, rx) },
+		epoch:     func(e uint16) { tx.Epoch = e },
+		resume:    rx.Resume,
+		last:      rx.LastEpoch,
+	}
+}
+
+func sealedMode(key []byte) mode {
+	tx, err := NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	rx, _ := NewCipher(key)
+	return mode{
+		name:      "sealed",
+		size:      SealedSize,
+		marshal:   func(p *Packet, buf []byte) (int, error) { return p.MarshalSealed(buf, tx) },
+		unmarshal: func(p *Packet, data []byte) error { return p.UnmarshalSealed(data, rx) },
+		epoch:     func(e uint16) { tx.Epoch = e },
+		resume:    rx.Resume,
+		last:      rx.LastEpoch,
+	}
+}
+
+// forModes runs test with both modes: m with testKey, foreign with otherKey.
+func forModes(t *testing.T, test func(t *testing.T, m, foreign mode)) {
+	t.Run("auth", func(t *testing.T) { test(t, authMode(testKey), authMode(otherKey)) })
+	t.Run("sealed", func(t *testing.T) { test(t, sealedMode(testKey), sealedMode(otherKey)) })
+}
+
+// send marshals testPacket with seq.
+func send(t *testing.T, m mode, seq uint16) []byte {
+	t.Helper()
+	p := testPacket
+	p.Seq = seq
+	buf := make([]byte, m.size)
+	n, err := m.marshal(&p, buf)
+	if err != nil || n != m.size {
+		t.Fatalf("marshal = %d, %v", n, err)
+	}
+	return buf
+}
+
+func TestAuthRoundTrip(t *testing.T) {
+	forModes(t, func(t *testing.T, m, _ mode) {
+		m.epoch(1)
+		var got Packet
+		err := m.unmarshal(&got, send(t, m, testPacket.Seq))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != testPacket {
+			t.Errorf("got %+v, want %+v", got, testPacket)
+		}
+		if m.last() != 1 {
+			t.Errorf("last epoch %d, want 1", m.last())
+		}
+	})
+}
+
+func TestAuthTamper(t *testing.T) {
+	forModes(t, func(t *testing.T, m, _ mode) {
+		m.epoch(1)
+		// Every bit of the packet is protected.
+		for i := 0; i < m.size; i++ {
+			for bit := 0; bit < 8; bit++ {
+				data := send(t, m, uint16(8*i+bit))
+				data[i] ^= 1 << bit
+				var got Packet
+				if err := m.unmarshal(&got, data); err == nil {
+					t.Fatalf("bit %d of byte %d changed, packet accepted: %+v", bit, i, got)
+				}
+				if got != (Packet{}) {
+					t.Fatalf("packet changed on error: %+v", got)
+				}
+			}
+		}
+	})
+}
+
+func TestAuthErrors(t *testing.T) {
+	forModes(t, func(t *testing.T, m, foreign mode) {
+		m.epoch(1)
+		foreign.epoch(1)
+		var got Packet
+		if err := m.unmarshal(&got, send(t, foreign, 5)); err != ErrAuth {
+			t.Errorf("other key: %v, want ErrAuth", err)
+		}
+
+		plain := make([]byte, m.size)
+		testPacket.Marshal(plain)
+		if err := m.unmarshal(&got, plain); err != ErrMode {
+			t.Errorf("plain packet: %v, want ErrMode", err)
+		}
+		if err := got.Unmarshal(send(t, m, 6)); err != ErrMode {
+			t.Errorf("in plain mode: %v, want ErrMode", err)
+		}
+		if err := m.unmarshal(&got, send(t, m, 7)[:m.size-1]); err != ErrShortBuffer {
+			t.Errorf("short packet: %v, want ErrShortBuffer", err)
+		}
+		if _, err := m.marshal(&got, make([]byte, m.size-1)); err != ErrShortBuffer {
+			t.Errorf("marshal into short buffer: %v, want ErrShortBuffer", err)
+		}
+	})
+
+	// An authenticated packet isn't sealed and the other way round.
+	auth, sealed := authMode(testKey), sealedMode(testKey)
+	var got Packet
+	if err := sealed.unmarshal(&got, send(t, auth, 1)); err != ErrMode {
+		t.Errorf("authenticated packet as sealed: %v, want ErrMode", err)
+	}
+	if err := auth.unmarshal(&got, send(t, sealed, 1)[:AuthSize]); err != ErrMode {
+		t.Errorf("sealed packet as authenticated: %v, want ErrMode", err)
+	}
+}
+
+func TestAuthReplay(t *testing.T) {
+	forModes(t, func(t *testing.T, m, _ mode) {
+		var got Packet
+		expect := func(name string, data []byte, want error) {
+			t.Helper()
+			if err := m.unmarshal(&got, data); err != want {
+				t.Errorf("%s: %v, want %v", name, err, want)
+			}
+		}
+		m.epoch(1)
+		first := send(t, m, 1)
+		expect("valid", first, nil)
+		expect("replay", first, ErrReplay)
+
+		late := send(t, m, 3)
+		expect("newer", send(t, m, 10), nil)
+		expect("late in window", late, nil)
+		expect("late replay", late, ErrReplay)
+		old := send(t, m, 11)
+		expect("newest", send(t, m, 200), nil)
+		expect("too old", old, ErrReplay)
+
+		// After restart the controller takes the next epoch, Seq starts again.
+		m.epoch(2)
+		expect("next epoch", send(t, m, 1), nil)
+		m.epoch(1)
+		expect("previous epoch", send(t, m, 500), ErrReplay)
+	})
+}
+
+func TestAuthResume(t *testing.T) {
+	forModes(t, func(t *testing.T, m, _ mode) {
+		var got Packet
+		// Packets recorded before the vehicle restarted.
+		m.epoch(4)
+		recorded := send(t, m, 1)
+		m.epoch(5)
+		last := send(t, m, 1)
+		m.unmarshal(&got, last)
+		if m.last() != 5 {
+			t.Fatalf("last epoch %d, want 5", m.last())
+		}
+
+		m.resume(5)
+		for _, data := range [][]byte{recorded, last} {
+			if err := m.unmarshal(&got, data); err != ErrReplay {
+				t.Errorf("recorded packet after resume: %v, want ErrReplay", err)
+			}
+		}
+		m.epoch(6)
+		if err := m.unmarshal(&got, send(t, m, 1)); err != nil {
+			t.Errorf("next epoch after resume: %v", err)
+		}
+
+		// No epoch is newer than the last one.
+		m.resume(0xFFFF)
+		m.epoch(0xFFFF)
+		if err := m.unmarshal(&got, send(t, m, 2)); err != ErrReplay {
+			t.Errorf("after the last epoch: %v, want ErrReplay", err)
+		}
+	})
+}
+
+func TestAuthReset(t *testing.T) {
+	a := NewAuth(testKey)
+	a.Epoch = 3
+	var buf [AuthSize]byte
+	testPacket.MarshalAuth(buf[:], a)
+
+	var got Packet
+	a.Resume(3)
+	if err := got.UnmarshalAuth(buf[:], a); err != ErrReplay {
+		t.Fatalf("after resume: %v, want ErrReplay", err)
+	}
+	a.Reset()
+	if err := got.UnmarshalAuth(buf[:], a); err != nil {
+		t.Errorf("after reset: %v", err)
+	}
+}
+
+func BenchmarkMarshalAuth(b *testing.B) {
+	a := NewAuth(testKey)
+	var buf [AuthSize]byte
+	p := testPacket
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Seq++
+		p.MarshalAuth(buf[:], a)
+	}
+}
+
+func BenchmarkUnmarshalAuth(b *testing.B) {
+	var buf [AuthSize]byte
+	testPacket.MarshalAuth(buf[:], NewAuth(testKey))
+	a := NewAuth(testKey)
+	var p Packet
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// The same packet again, the window would reject it.
+		a.Reset()
+		err := p.UnmarshalAuth(buf[:], a)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// ccm is AES-CCM (RFC 3610, NIST SP 800-38C) with 13 bytes nonce (L=2),
+// tagSize bytes tag and associated data shorter than 0xFF00 bytes.
+// The standard library has only GCM, its tag is at least 12 bytes and
+// doesn't fit in a payload. ccm doesn't allocate.
+type ccm struct {
+	block cipher.Block
+	x     [16]byte // CBC-MAC state
+	s     [16]byte // key stream block
+	a     [16]byte // counter block
+}
+
+const (
+	ccmNonceSize = 13
+	ccmTagSize   = 8
+)
+
+// Flags of B0: Adata, M' = (M-2)/2, L' = L-1.
+const ccmFlags = 0x40 | (ccmTagSize-2)/2<<3 | (2 - 1)
+
+// mac computes CBC-MAC of nonce, aad and plaintext into c.x.
+func (c *ccm) mac(nonce, aad, plaintext []byte) {
+	x := &c.x
+	x[0] = ccmFlags
+	copy(x[1:], nonce)
+	x[14] = byte(len(plaintext) >> 8)
+	x[15] = byte(len(plaintext))
+	c.block.Encrypt(x[:], x[:])
+
+	// Associated data with 2 bytes length, padded to blocks.
+	i := 2
+	x[0] ^= byte(len(aad) >> 8)
+	x[1] ^= byte(len(aad))
+	for _, b := range aad {
+		if i == 16 {
+			c.block.Encrypt(x[:], x[:])
+			i = 0
+		}
+		x[i] ^= b
+		i++
+	}
+	c.block.Encrypt(x[:], x[:])
+
+	for len(plaintext) > 0 {
+		n := subtle.XORBytes(x[:], x[:], plaintext)
+		plaintext = plaintext[n:]
+		c.block.Encrypt(x[:], x[:])
+	}
+}
+
+// ctr XORs src with the key stream for nonce into dst, from counter 1.
+// Counter 0 encrypts the tag, it's left in c.s.
+func (c *ccm) ctr(nonce, dst, src []byte) {
+	a := &c.a
+	a[0] = 2 - 1
+	copy(a[1:], nonce)
+	for i := uint16(1); len(src) > 0; i++ {
+		a[14], a[15] = byte(i>>8), byte(i)
+		c.block.Encrypt(c.s[:], a[:])
+		n := subtle.XORBytes(dst, src, c.s[:])
+		dst, src = dst[n:], src[n:]
+	}
+	a[14], a[15] = 0, 0
+	c.block.Encrypt(c.s[:], a[:])
+}
+
+// seal encrypts plaintext into dst and writes the tag into tag.
+// dst may be plaintext.
+func (c *ccm) seal(nonce, aad, dst, plaintext, tag []byte) {
+	c.mac(nonce, aad, plaintext)
+	c.ctr(nonce, dst, plaintext)
+	subtle.XORBytes(tag[:ccmTagSize], c.x[:ccmTagSize], c.s[:ccmTagSize])
+}
+
+// open decrypts ciphertext into dst and checks the tag. dst may be
+// ciphertext, it's garbage when false is returned.
+func (c *ccm) open(nonce, aad, dst, ciphertext, tag []byte) bool {
+	c.ctr(nonce, dst, ciphertext)
+	var expected [ccmTagSize]byte
+	subtle.XORBytes(expected[:], tag[:ccmTagSize], c.s[:ccmTagSize])
+	c.mac(nonce, aad, dst)
+	return subtle.ConstantTimeCompare(expected[:], c.x[:ccmTagSize]) == 1
+}
@@ -0,0 +1,176 @@
+// Package protocol is the binary format of messages from the joystick
+// to the vehicle.
+//
+// Packet version 1, 18 bytes, multi-byte fields are little endian:
+//
+//	offset size field
+//	0      1    Version, 1
+//	1      1    Type of message, TypeControl
+//	2      1    Sender ID
+//	3      1    Target ID, Broadcast - all vehicles
+//	4      2    Seq, sequence number, wraps around
+//	6      8    Axes, 4 × int16: left X, left Y, right X, right Y. 0 - center
+//	14     2    Buttons, bitfield, 1 - pressed
+//	16     2    Checksum, CRC-16/CCITT-FALSE of bytes 0 to 15
+//
+// Marshal and Unmarshal don't allocate. Authenticated packets (see Auth)
+// and sealed packets (see Cipher) are 8 bytes longer.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	// Version of the packet format.
+	Version = 1
+
+	// Size of the packet in bytes.
+	Size = 18
+
+	// Broadcast target, every vehicle accepts it.
+	Broadcast = 0xFF
+)
+
+// Type of message. Values are below 0x40, the high bits of the type byte
+// are flags of authenticated and sealed packets.
+type Type byte
+
+const (
+	TypeControl Type = 1 // stick and buttons state
+)
+
+// Axes order.
+const (
+	AxisLeftX = iota
+	AxisLeftY
+	AxisRightX
+	AxisRightY
+
+	NumAxes
+)
+
+// Buttons bits.
+const (
+	ButtonLeft  = 1 << 0 // left stick pressed
+	ButtonRight = 1 << 1 // right stick pressed
+)
+
+var (
+	ErrShortBuffer = errors.New("protocol: buffer is shorter than packet")
+	ErrVersion     = errors.New("protocol: unsupported packet version")
+	ErrChecksum    = errors.New("protocol: checksum mismatch")
+	ErrType        = errors.New("protocol: unexpected message type")
+)
+
+const (
+	offVersion  = 0
+	offType     = 1
+	offSender   = 2
+	offTarget   = 3
+	offSeq      = 4
+	offAxes     = 6
+	offButtons  = offAxes + 2*NumAxes
+	offChecksum = offButtons + 2
+)
+
+// Packet is one message from the joystick.
+type Packet struct {
+	Type    Type
+	Sender  byte
+	Target  byte
+	Seq     uint16
+	Axes    [NumAxes]int16
+	Buttons uint16
+}
+
+// Marshal writes packet into buf, at least Size bytes.
+// Returns number of written bytes, always Size.
+func (p *Packet) Marshal(buf []byte) (int, error) {
+	if len(buf) < Size {
+		return 0, ErrShortBuffer
+	}
+	buf[offVersion] = Version
+	buf[offType] = byte(p.Type)
+	buf[offSender] = p.Sender
+	buf[offTarget] = p.Target
+	binary.LittleEndian.PutUint16(buf[offSeq:], p.Seq)
+	for i, v := range p.Axes {
+		binary.LittleEndian.PutUint16(buf[offAxes+2*i:], uint16(v))
+	}
+	binary.LittleEndian.PutUint16(buf[offButtons:], p.Buttons)
+	binary.LittleEndian.PutUint16(buf[offChecksum:], Checksum(buf[:offChecksum]))
+	return Size, nil
+}
+
+// Unmarshal reads packet from data. Bytes after Size are ignored.
+// On error p isn't changed.
+func (p *Packet) Unmarshal(data []byte) error {
+	if len(data) >= Size && data[offType]&(flagAuth|flagSealed) != 0 {
+		return ErrMode
+	}
+	return p.unmarshal(data)
+}
+
+func (p *Packet) unmarshal(data []byte) error {
+	if len(data) < Size {
+		return ErrShortBuffer
+	}
+	if data[offVersion] != Version {
+		return ErrVersion
+	}
+	if binary.LittleEndian.Uint16(data[offChecksum:]) != Checksum(data[:offChecksum]) {
+		return ErrChecksum
+	}
+	p.Type = Type(data[offType])
+	p.Sender = data[offSender]
+	p.Target = data[offTarget]
+	p.Seq = binary.LittleEndian.Uint16(data[offSeq:])
+	for i := range p.Axes {
+		p.Axes[i] = int16(binary.LittleEndian.Uint16(data[offAxes+2*i:]))
+	}
+	p.Buttons = binary.LittleEndian.Uint16(data[offButtons:])
+	return nil
+}
+
+// For reports whether packet is addressed to the vehicle id.
+func (p *Packet) For(id byte) bool {
+	return p.Target == id || p.Target == Broadcast
+}
+
+// Pressed reports whether all buttons of mask are pressed.
+func (p *Packet) Pressed(mask uint16) bool {
+	return p.Buttons&mask == mask
+}
+
+// Neutral reports whether all axes are within ±deadband from center.
+func (p *Packet) Neutral(deadband int16) bool {
+	for _, v := range p.Axes {
+		if v > deadband || v < -deadband {
+			return false
+		}
+	}
+	return true
+}
+
+// AxisFromADC converts ADC reading (0 to 65535, center 32768) into axis value.
+func AxisFromADC(v uint16) int16 {
+	return int16(int32(v) - 0x8000)
+}
+
+// Checksum returns CRC-16/CCITT-FALSE (poly 0x1021, init 0xFFFF) of data.
+func Checksum(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"testing"
+)
+
+var testPacket = Packet{
+	Type:    TypeControl,
+	Sender:  0x11,
+	Target:  0x22,
+	Seq:     0xBEEF,
+	Axes:    [NumAxes]int16{-32768, 32767, 0, -1},
+	Buttons: ButtonLeft | ButtonRight,
+}
+
+func TestChecksum(t *testing.T) {
+	// CRC-16/CCITT-FALSE check values.
+	tests := []struct {
+		data string
+		want uint16
+	}{
+		{"", 0xFFFF},
+		{"123456789", 0x29B1},
+		{"A", 0xB915},
+		{"\x00", 0xE1F0},
+		{"\xFF\xFF\xFF\xFF", 0x1D0F},
+		{"The quick brown fox jumps over the lazy dog", 0x8FDD},
+	}
+	for _, tt := range tests {
+		if got := Checksum([]byte(tt.data)); got != tt.want {
+			t.Errorf("Checksum(%q) = %#04x, want %#04x", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	var buf [Size]byte
+	n, err := testPacket.Marshal(buf[:])
+	if err != nil || n != Size {
+		t.Fatalf("Marshal = %d, %v", n, err)
+	}
+	want := []byte{
+		Version, byte(TypeControl), 0x11, 0x22,
+		0xEF, 0xBE,
+		0x00, 0x80, 0xFF, 0x7F, 0x00, 0x00, 0xFF, 0xFF,
+		0x03, 0x00,
+	}
+	if string(buf[:offChecksum]) != string(want) {
+		t.Errorf("Marshal = %x, want %x", buf[:offChecksum], want)
+	}
+
+	var p Packet
+	err = p.Unmarshal(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != testPacket {
+		t.Errorf("Unmarshal = %+v, want %+v", p, testPacket)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	var valid [Size]byte
+	testPacket.Marshal(valid[:])
+
+	tests := []struct {
+		name   string
+		change func(b []byte) []byte
+		want   error
+	}{
+		{"short", func(b []byte) []byte { return b[:Size-1] }, ErrShortBuffer},
+		{"version", func(b []byte) []byte { b[offVersion] = 2; return b }, ErrVersion},
+		{"checksum", func(b []byte) []byte { b[offAxes] ^= 1; return b }, ErrChecksum},
+		{"authenticated", func(b []byte) []byte { b[offType] |= flagAuth; return b }, ErrMode},
+		{"sealed", func(b []byte) []byte { b[offType] |= flagSealed; return b }, ErrMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := valid
+			p := Packet{Seq: 7}
+			err := p.Unmarshal(tt.change(data[:]))
+			if err != tt.want {
+				t.Errorf("err %v, want %v", err, tt.want)
+			}
+			if p != (Packet{Seq: 7}) {
+				t.Errorf("packet changed on error: %+v", p)
+			}
+		})
+	}
+
+	if _, err := testPacket.Marshal(make([]byte, Size-1)); err != ErrShortBuffer {
+		t.Errorf("Marshal into short buffer: %v", err)
+	}
+}
+
+func TestNoAllocs(t *testing.T) {
+	var buf [Size]byte
+	var p Packet
+	allocs := testing.AllocsPerRun(100, func() {
+		testPacket.Marshal(buf[:])
+		p.Unmarshal(buf[:])
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per Marshal and Unmarshal", allocs)
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	p := Packet{Target: 5, Buttons: ButtonLeft, Axes: [NumAxes]int16{100, -100, 0, 50}}
+	if !p.For(5) || p.For(6) {
+		t.Errorf("For: target 5")
+	}
+	p.Target = Broadcast
+	if !p.For(6) {
+		t.Errorf("For: broadcast")
+	}
+	if !p.Pressed(ButtonLeft) || p.Pressed(ButtonLeft|ButtonRight) {
+		t.Errorf("Pressed: buttons %b", p.Buttons)
+	}
+	if !p.Neutral(100) || p.Neutral(99) {
+		t.Errorf("Neutral: axes %v", p.Axes)
+	}
+	for adc, want := range map[uint16]int16{0: -32768, 0x8000: 0, 0xFFFF: 32767} {
+		if got := AxisFromADC(adc); got != want {
+			t.Errorf("AxisFromADC(%#x) = %d, want %d", adc, got, want)
+		}
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	var buf [Size]byte
+	testPacket.Marshal(buf[:])
+	f.Add(buf[:])
+	f.Add(buf[:Size-1])
+	f.Add([]byte{})
+	f.Add(append(buf[:], 0xAA, 0x55))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var p Packet
+		if p.Unmarshal(data) != nil {
+			return
+		}
+		var out [Size]byte
+		n, err := p.Marshal(out[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out[:n]) != string(data[:Size]) {
+			t.Errorf("accepted %x, marshaled back to %x", data[:Size], out[:n])
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package protocol
+
+// replayDepth is how far behind the newest counter a late packet
+// is accepted.
+const replayDepth = 64
+
+// replayWindow of the receiver: the newest counter and bitmap of
+// received counters, bit 0 is the newest.
+type replayWindow struct {
+	newest uint32
+	seen   uint64
+	valid  bool
+
+	// Counters of epoch floor and older ones are rejected, if hasFloor.
+	floor    uint16
+	hasFloor bool
+}
+
+// resume starts the window after epoch: only newer epochs are accepted.
+func (w *replayWindow) resume(epoch uint16) {
+	*w = replayWindow{floor: epoch, hasFloor: true}
+}
+
+// epoch returns the epoch of the newest counter.
+func (w *replayWindow) epoch() uint16 {
+	return uint16(w.newest >> 16)
+}
+
+// check tells whether counter wasn't received yet and records it.
+func (w *replayWindow) check(counter uint32) bool {
+	if w.hasFloor && uint16(counter>>16) <= w.floor {
+		return false
+	}
+	if !w.valid {
+		w.valid = true
+		w.newest, w.seen = counter, 1
+		return true
+	}
+	if counter > w.newest {
+		shift := counter - w.newest
+		if shift >= 64 {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+		w.seen |= 1
+		w.newest = counter
+		return true
+	}
+	behind := w.newest - counter
+	if behind >= replayDepth || w.seen&(1<<behind) != 0 {
+		return false
+	}
+	w.seen |= 1 << behind
+	return true
+}
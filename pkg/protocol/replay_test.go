@@ -0,0 +1,60 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestReplayWindow(t *testing.T) {
+	const epoch2 = 2 << 16
+	tests := []struct {
+		name     string
+		counters []uint32
+		want     []bool
+	}{
+		{"first", []uint32{1000}, []bool{true}},
+		{"first zero", []uint32{0, 0}, []bool{true, false}},
+		{"in order", []uint32{1, 2, 3}, []bool{true, true, true}},
+		{"duplicate", []uint32{1, 2, 2, 1}, []bool{true, true, false, false}},
+		{"late", []uint32{1, 5, 3, 4, 3}, []bool{true, true, true, true, false}},
+		{"oldest in window", []uint32{100, 100 + replayDepth - 1, 101}, []bool{true, true, true}},
+		{"behind window", []uint32{100, 100 + replayDepth, 100}, []bool{true, true, false}},
+		{"far ahead", []uint32{5, 5 + 1000, 5, 6}, []bool{true, true, false, false}},
+		{"next epoch", []uint32{0x1FFFF, epoch2, epoch2 + 1, 0x1FFFF}, []bool{true, true, true, false}},
+		{"older epoch", []uint32{epoch2 + 500, 0x10000 + 600}, []bool{true, false}},
+		{"maximum", []uint32{0xFFFFFFFF, 0xFFFFFFFF, 0xFFFFFFFE}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w replayWindow
+			for i, counter := range tt.counters {
+				if got := w.check(counter); got != tt.want[i] {
+					t.Errorf("check(%#x) = %v, want %v", counter, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplayWindowResume(t *testing.T) {
+	var w replayWindow
+	w.resume(3)
+	tests := []struct {
+		counter uint32
+		want    bool
+	}{
+		{0, false},
+		{3<<16 | 0xFFFF, false},
+		{4 << 16, true},
+		{3<<16 | 0xFFFF, false}, // in the window, but of an old epoch
+		{4 << 16, false},
+		{4<<16 | 1, true},
+	}
+	for _, tt := range tests {
+		if got := w.check(tt.counter); got != tt.want {
+			t.Errorf("check(%#x) = %v, want %v", tt.counter, got, tt.want)
+		}
+	}
+	if w.epoch() != 4 {
+		t.Errorf("epoch %d, want 4", w.epoch())
+	}
+}
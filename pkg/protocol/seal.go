@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+// Sealed packet is encrypted and authenticated by AES-128-CCM with 8 bytes
+// tag. The header is in the clear, the receiver needs it before decryption:
+//
+//	offset size field
+//	0      1    Version, 1
+//	1      1    Type of message, with the sealed flag
+//	2      1    Sender ID
+//	3      1    Target ID
+//	4      2    Seq
+//	6      2    Epoch, high 16 bits of the counter, see AuthSize
+//	8      10   Axes and Buttons, encrypted
+//	18     8    Tag
+//
+// Bytes 0 to 7 are associated data. The nonce is Type, Sender, Target,
+// Epoch and Seq, padded with zeros: it's unique while the counter isn't
+// reused, and messages of other types and directions don't share it.
+// There is no checksum, the tag covers it.
+const (
+	SealedSize = offSealedData + sealedDataSize + ccmTagSize
+
+	offSealedEpoch = offAxes
+	offSealedData  = offSealedEpoch + 2
+	sealedDataSize = 2*NumAxes + 2
+
+	// flagSealed in Type marks sealed packets.
+	flagSealed = 0x40
+)
+
+var ErrInvalidKey = errors.New("protocol: key must be 16 bytes or longer")
+
+// Cipher seals packets with a session key derived from the pre-shared key
+// (see bind.Binding). One Cipher is used by one side of a link: the sender
+// sets Epoch, the receiver keeps the replay window in it.
+type Cipher struct {
+	// Epoch of the sender, see AuthSize.
+	Epoch uint16
+
+	ccm    ccm
+	nonce  [ccmNonceSize]byte
+	data   [sealedDataSize]byte
+	window replayWindow
+}
+
+// NewCipher returns Cipher with the session key derived from key,
+// 16 bytes or longer. The key isn't used as is, the same key may be
+// used by Auth.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) < 16 {
+		return nil, ErrInvalidKey
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("joystick/protocol seal"))
+	session := mac.Sum(nil)
+
+	block, err := aes.NewCipher(session[:16])
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{ccm: ccm{block: block}}, nil
+}
+
+// Reset forgets the replay window, for example when the key is changed.
+func (c *Cipher) Reset() {
+	c.window = replayWindow{}
+}
+
+// Resume starts the replay window of the receiver after epoch,
+// see Auth.Resume.
+func (c *Cipher) Resume(epoch uint16) {
+	c.window.resume(epoch)
+}
+
+// LastEpoch returns the epoch of the newest packet accepted by the
+// receiver, see Auth.LastEpoch.
+func (c *Cipher) LastEpoch() uint16 {
+	return c.window.epoch()
+}
+
+// setNonce fills the nonce from the header of the sealed packet.
+func (c *Cipher) setNonce(header []byte) {
+	c.nonce[0] = header[offType]
+	c.nonce[1] = header[offSender]
+	c.nonce[2] = header[offTarget]
+	copy(c.nonce[3:7], header[offSealedEpoch:offSealedData])
+	copy(c.nonce[7:9], header[offSeq:offAxes])
+}
+
+// MarshalSealed writes sealed packet into buf, at least SealedSize bytes.
+// Returns number of written bytes, always SealedSize.
+func (p *Packet) MarshalSealed(buf []byte, c *Cipher) (int, error) {
+	if len(buf) < SealedSize {
+		return 0, ErrShortBuffer
+	}
+	buf[offVersion] = Version
+	buf[offType] = byte(p.Type) | flagSealed
+	buf[offSender] = p.Sender
+	buf[offTarget] = p.Target
+	binary.LittleEndian.PutUint16(buf[offSeq:], p.Seq)
+	binary.LittleEndian.PutUint16(buf[offSealedEpoch:], c.Epoch)
+
+	data := buf[offSealedData : offSealedData+sealedDataSize]
+	for i, v := range p.Axes {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	binary.LittleEndian.PutUint16(data[2*NumAxes:], p.Buttons)
+
+	c.setNonce(buf)
+	c.ccm.seal(c.nonce[:], buf[:offSealedData], data, data, buf[offSealedData+sealedDataSize:])
+	return SealedSize, nil
+}
+
+// UnmarshalSealed decrypts sealed packet from data. Packets with bad tag
+// return ErrAuth, already received packets ErrReplay. On error p isn't
+// changed.
+func (p *Packet) UnmarshalSealed(data []byte, c *Cipher) error {
+	if len(data) < SealedSize {
+		return ErrShortBuffer
+	}
+	if data[offType]&(flagAuth|flagSealed) != flagSealed {
+		return ErrMode
+	}
+	if data[offVersion] != Version {
+		return ErrVersion
+	}
+
+	c.setNonce(data)
+	sealed := data[offSealedData : offSealedData+sealedDataSize]
+	if !c.ccm.open(c.nonce[:], data[:offSealedData], c.data[:], sealed, data[offSealedData+sealedDataSize:]) {
+		return ErrAuth
+	}
+	seq := binary.LittleEndian.Uint16(data[offSeq:])
+	counter := uint32(binary.LittleEndian.Uint16(data[offSealedEpoch:]))<<16 | uint32(seq)
+	if !c.window.check(counter) {
+		return ErrReplay
+	}
+
+	p.Type = Type(data[offType] &^ flagSealed)
+	p.Sender = data[offSender]
+	p.Target = data[offTarget]
+	p.Seq = seq
+	for i := range p.Axes {
+		p.Axes[i] = int16(binary.LittleEndian.Uint16(c.data[2*i:]))
+	}
+	p.Buttons = binary.LittleEndian.Uint16(c.data[2*NumAxes:])
+	return nil
+}
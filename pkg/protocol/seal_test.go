@@ -0,0 +1,127 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCCM(t *testing.T) {
+	// RFC 3610 packet vectors #1 and #2: M = 8, L = 2, 8 bytes of header.
+	tests := []struct {
+		name             string
+		nonce, plaintext string
+		want             string // header, ciphertext and tag
+	}{
+		{
+			name:      "packet vector #1",
+			nonce:     "00000003020100a0a1a2a3a4a5",
+			plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+			want: "0001020304050607588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417" +
+				"e8d12cfdf926e0",
+		},
+		{
+			name:      "packet vector #2",
+			nonce:     "00000004030201a0a1a2a3a4a5",
+			plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+			want: "000102030405060772c91a36e135f8cf291ca894085c87e3cc15c439c9e43a3b" +
+				"a091d56e10400916",
+		},
+	}
+	key := mustHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf")
+	header := mustHex(t, "0001020304050607")
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := ccm{block: block}
+			nonce, plaintext := mustHex(t, tt.nonce), mustHex(t, tt.plaintext)
+			sealed := make([]byte, len(plaintext))
+			var tag [ccmTagSize]byte
+			c.seal(nonce, header, sealed, plaintext, tag[:])
+
+			got := hex.EncodeToString(header) + hex.EncodeToString(sealed) + hex.EncodeToString(tag[:])
+			if got != tt.want {
+				t.Fatalf("seal\n got %s\nwant %s", got, tt.want)
+			}
+
+			opened := make([]byte, len(sealed))
+			if !c.open(nonce, header, opened, sealed, tag[:]) || string(opened) != string(plaintext) {
+				t.Errorf("open = %x", opened)
+			}
+			for _, data := range [][]byte{header, sealed, tag[:], nonce} {
+				data[len(data)-1] ^= 1
+				if c.open(nonce, header, opened, sealed, tag[:]) {
+					t.Errorf("opened with %x changed", data)
+				}
+				data[len(data)-1] ^= 1
+			}
+		})
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSealedHidesData(t *testing.T) {
+	c, _ := NewCipher(testKey)
+	var sealed [SealedSize]byte
+	var plain [Size]byte
+	testPacket.MarshalSealed(sealed[:], c)
+	testPacket.Marshal(plain[:])
+
+	// Axes and buttons aren't in the clear, the header is.
+	if string(sealed[offSealedData:offSealedData+sealedDataSize]) == string(plain[offAxes:offChecksum]) {
+		t.Errorf("data in the clear: %x", sealed)
+	}
+	if string(sealed[offSender:offAxes]) != string(plain[offSender:offAxes]) {
+		t.Errorf("header %x, want %x", sealed[:offAxes], plain[:offAxes])
+	}
+}
+
+func TestNewCipher(t *testing.T) {
+	if _, err := NewCipher(testKey[:15]); err != ErrInvalidKey {
+		t.Errorf("15 bytes key: %v, want ErrInvalidKey", err)
+	}
+	for _, n := range []int{16, 32, 64} {
+		if _, err := NewCipher(make([]byte, n)); err != nil {
+			t.Errorf("%d bytes key: %v", n, err)
+		}
+	}
+}
+
+func BenchmarkSeal(b *testing.B) {
+	c, _ := NewCipher(testKey)
+	var buf [SealedSize]byte
+	p := testPacket
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Seq++
+		p.MarshalSealed(buf[:], c)
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	tx, _ := NewCipher(testKey)
+	rx, _ := NewCipher(testKey)
+	var buf [SealedSize]byte
+	testPacket.MarshalSealed(buf[:], tx)
+	var p Packet
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// The same packet again, the window would reject it.
+		rx.Reset()
+		err := p.UnmarshalSealed(buf[:], rx)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+// Telemetry packet from the vehicle, 16 bytes, sent back in ACK payloads:
+//
+//	offset size field
+//	0      1    Version, TelemetryVersion
+//	1      1    Type, TypeTelemetry
+//	2      1    Sender ID, the vehicle
+//	3      1    Target ID, the controller
+//	4      2    Seq
+//	6      2    Battery, mV
+//	8      1    Motors, motor A in bits 0-3, motor B in bits 4-7
+//	9      1    Failsafe, state of the failsafe
+//	10     1    Loss, rolling packet loss on the vehicle, %
+//	11     1    Strong, rolling share of packets over -64dBm, %
+//	12     1    Fault, the last fault code
+//	13     1    Control, ID of the controller in control, Broadcast if none
+//	14     2    Checksum, CRC-16/CCITT-FALSE of bytes 0 to 13
+//
+// Telemetry is not authenticated or encrypted, it has no commands.
+// Version 1 had 15 bytes, without Control, it's rejected with ErrVersion.
+const (
+	TelemetryVersion = 2
+	TelemetrySize    = offTelemetryChecksum + 2
+
+	offBattery           = offAxes
+	offMotors            = offBattery + 2
+	offFailsafe          = offMotors + 1
+	offLoss              = offFailsafe + 1
+	offStrong            = offLoss + 1
+	offFault             = offStrong + 1
+	offControl           = offFault + 1
+	offTelemetryChecksum = offControl + 1
+)
+
+const (
+	TypeTelemetry Type = 2 // state of the vehicle
+)
+
+// MotorState is the state of one motor.
+type MotorState byte
+
+const (
+	MotorStop MotorState = iota
+	MotorForward
+	MotorBackward
+	MotorBrake
+)
+
+func (m MotorState) String() string {
+	switch m {
+	case MotorForward:
+		return "fwd"
+	case MotorBackward:
+		return "back"
+	case MotorBrake:
+		return "brake"
+	}
+	return "stop"
+}
+
+// Fault codes of the vehicle.
+const (
+	FaultNone    = 0
+	FaultRadio   = 1 // radio error
+	FaultPacket  = 2 // bad packet: checksum, authentication, replay
+	FaultBattery = 3 // battery low
+)
+
+// FaultString returns name of the fault code.
+func FaultString(fault byte) string {
+	switch fault {
+	case FaultNone:
+		return "ok"
+	case FaultRadio:
+		return "radio"
+	case FaultPacket:
+		return "packet"
+	case FaultBattery:
+		return "battery"
+	}
+	return "fault " + strconv.Itoa(int(fault))
+}
+
+// Telemetry is the state of the vehicle.
+type Telemetry struct {
+	Sender  byte
+	Target  byte
+	Seq     uint16
+	Battery uint16        // mV
+	Motors  [2]MotorState // A, B
+	// Failsafe is failsafe.State of the vehicle.
+	Failsafe byte
+	Loss     byte // %
+	Strong   byte // %
+	Fault    byte
+	// Control is ID of the controller in control of the vehicle,
+	// Broadcast if none.
+	Control byte
+}
+
+// Marshal writes telemetry into buf, at least TelemetrySize bytes.
+// Returns number of written bytes, always TelemetrySize.
+func (t *Telemetry) Marshal(buf []byte) (int, error) {
+	if len(buf) < TelemetrySize {
+		return 0, ErrShortBuffer
+	}
+	buf[offVersion] = TelemetryVersion
+	buf[offType] = byte(TypeTelemetry)
+	buf[offSender] = t.Sender
+	buf[offTarget] = t.Target
+	binary.LittleEndian.PutUint16(buf[offSeq:], t.Seq)
+	binary.LittleEndian.PutUint16(buf[offBattery:], t.Battery)
+	buf[offMotors] = byte(t.Motors[0])&0x0F | byte(t.Motors[1])<<4
+	buf[offFailsafe] = t.Failsafe
+	buf[offLoss] = t.Loss
+	buf[offStrong] = t.Strong
+	buf[offFault] = t.Fault
+	buf[offControl] = t.Control
+	binary.LittleEndian.PutUint16(buf[offTelemetryChecksum:], Checksum(buf[:offTelemetryChecksum]))
+	return TelemetrySize, nil
+}
+
+// Unmarshal reads telemetry from data. On error t isn't changed.
+func (t *Telemetry) Unmarshal(data []byte) error {
+	// Version first, the old layout is shorter.
+	if len(data) > offVersion && data[offVersion] != TelemetryVersion {
+		return ErrVersion
+	}
+	if len(data) < TelemetrySize {
+		return ErrShortBuffer
+	}
+	if data[offType] != byte(TypeTelemetry) {
+		return ErrType
+	}
+	if binary.LittleEndian.Uint16(data[offTelemetryChecksum:]) != Checksum(data[:offTelemetryChecksum]) {
+		return ErrChecksum
+	}
+	t.Sender = data[offSender]
+	t.Target = data[offTarget]
+	t.Seq = binary.LittleEndian.Uint16(data[offSeq:])
+	t.Battery = binary.LittleEndian.Uint16(data[offBattery:])
+	t.Motors[0] = MotorState(data[offMotors] & 0x0F)
+	t.Motors[1] = MotorState(data[offMotors] >> 4)
+	t.Failsafe = data[offFailsafe]
+	t.Loss = data[offLoss]
+	t.Strong = data[offStrong]
+	t.Fault = data[offFault]
+	t.Control = data[offControl]
+	return nil
+}
+
+// String returns telemetry in one line for the serial log or a display.
+// failsafe - name of the failsafe state, see failsafe.State.
+func (t *Telemetry) String(failsafe string) string {
+	control := "none"
+	if t.Control != Broadcast {
+		control = strconv.Itoa(int(t.Control))
+	}
+	return "bat:" + strconv.Itoa(int(t.Battery)) + "mV" +
+		" A:" + t.Motors[0].String() +
+		" B:" + t.Motors[1].String() +
+		" " + failsafe +
+		" loss:" + strconv.Itoa(int(t.Loss)) + "%" +
+		" rpd:" + strconv.Itoa(int(t.Strong)) + "%" +
+		" " + FaultString(t.Fault) +
+		" control:" + control
+}
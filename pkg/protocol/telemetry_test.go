@@ -0,0 +1,112 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+var testTelemetry = Telemetry{
+	Sender:   0x02,
+	Target:   0x01,
+	Seq:      0xBEEF,
+	Battery:  7400,
+	Motors:   [2]MotorState{MotorForward, MotorBrake},
+	Failsafe: 2,
+	Loss:     12,
+	Strong:   97,
+	Fault:    FaultBattery,
+	Control:  0x01,
+}
+
+func TestTelemetryMarshal(t *testing.T) {
+	var buf [TelemetrySize]byte
+	n, err := testTelemetry.Marshal(buf[:])
+	if err != nil || n != TelemetrySize {
+		t.Fatalf("Marshal = %d, %v", n, err)
+	}
+	want := []byte{
+		TelemetryVersion, byte(TypeTelemetry), 0x02, 0x01,
+		0xEF, 0xBE,
+		0xE8, 0x1C,
+		0x31, 2, 12, 97, FaultBattery, 0x01,
+	}
+	if string(buf[:offTelemetryChecksum]) != string(want) {
+		t.Errorf("Marshal = %x, want %x", buf[:offTelemetryChecksum], want)
+	}
+
+	var got Telemetry
+	err = got.Unmarshal(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != testTelemetry {
+		t.Errorf("Unmarshal = %+v, want %+v", got, testTelemetry)
+	}
+}
+
+func TestTelemetryErrors(t *testing.T) {
+	var valid [TelemetrySize]byte
+	testTelemetry.Marshal(valid[:])
+
+	for i := 0; i < TelemetrySize; i++ {
+		for bit := 0; bit < 8; bit++ {
+			data := valid
+			data[i] ^= 1 << bit
+			got := Telemetry{Seq: 7}
+			if err := got.Unmarshal(data[:]); err == nil {
+				t.Fatalf("bit %d of byte %d changed, telemetry accepted: %+v", bit, i, got)
+			}
+			if got != (Telemetry{Seq: 7}) {
+				t.Fatalf("telemetry changed on error: %+v", got)
+			}
+		}
+	}
+
+	var got Telemetry
+	if err := got.Unmarshal(valid[:TelemetrySize-1]); err != ErrShortBuffer {
+		t.Errorf("short: %v, want ErrShortBuffer", err)
+	}
+	if _, err := testTelemetry.Marshal(make([]byte, TelemetrySize-1)); err != ErrShortBuffer {
+		t.Errorf("Marshal into short buffer: %v, want ErrShortBuffer", err)
+	}
+
+	bad := valid
+	bad[offType] = byte(TypeControl)
+	if err := got.Unmarshal(bad[:]); err != ErrType {
+		t.Errorf("type control: %v, want ErrType", err)
+	}
+	// A control packet in an ACK isn't telemetry.
+	var control [Size]byte
+	testPacket.Marshal(control[:])
+	if err := got.Unmarshal(control[:]); err != ErrVersion {
+		t.Errorf("control packet: %v, want ErrVersion", err)
+	}
+}
+
+func TestTelemetryVersion1(t *testing.T) {
+	// The layout of version 1: 15 bytes, the checksum at offset 13.
+	v1 := []byte{1, byte(TypeTelemetry), 0x02, 0x01, 0xEF, 0xBE, 0xE8, 0x1C, 0x31, 2, 12, 97, FaultBattery, 0, 0}
+	binary.LittleEndian.PutUint16(v1[13:], Checksum(v1[:13]))
+	for _, data := range [][]byte{v1, append(v1, 0xAA, 0x55, 0, 0)} {
+		got := Telemetry{Seq: 7}
+		if err := got.Unmarshal(data); err != ErrVersion {
+			t.Errorf("version 1 telemetry of %d bytes: %v, want ErrVersion", len(data), err)
+		}
+		if got != (Telemetry{Seq: 7}) {
+			t.Errorf("telemetry changed on error: %+v", got)
+		}
+	}
+}
+
+func TestTelemetryString(t *testing.T) {
+	tel := testTelemetry
+	want := "bat:7400mV A:fwd B:brake lost loss:12% rpd:97% battery control:1"
+	if got := tel.String("lost"); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+	tel.Control, tel.Fault = Broadcast, 9
+	want = "bat:7400mV A:fwd B:brake lost loss:12% rpd:97% fault 9 control:none"
+	if got := tel.String("lost"); got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+)
+
+var errOutOfRange = errors.New("storage: out of memory range")
+
+// Memory is a BlockDevice in RAM, for the host and the emulator.
+type Memory struct {
+	data       []byte
+	eraseBlock int64
+	writeBlock int64
+}
+
+// NewMemory returns erased memory of blocks erase blocks of eraseBlock bytes.
+// Writes are in blocks of 256 bytes, like RP2040 flash.
+func NewMemory(blocks int, eraseBlock int64) *Memory {
+	m := &Memory{
+		data:       make([]byte, int64(blocks)*eraseBlock),
+		eraseBlock: eraseBlock,
+		writeBlock: 256,
+	}
+	for i := range m.data {
+		m.data[i] = 0xFF
+	}
+	return m
+}
+
+func (m *Memory) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, errOutOfRange
+	}
+	return copy(p, m.data[off:]), nil
+}
+
+// WriteAt programs flash: bits can only be cleared, erase sets them.
+func (m *Memory) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(m.data)) {
+		return 0, errOutOfRange
+	}
+	for i, b := range p {
+		m.data[off+int64(i)] &= b
+	}
+	return len(p), nil
+}
+
+func (m *Memory) Size() int64 {
+	return int64(len(m.data))
+}
+
+func (m *Memory) WriteBlockSize() int64 {
+	return m.writeBlock
+}
+
+func (m *Memory) EraseBlockSize() int64 {
+	return m.eraseBlock
+}
+
+func (m *Memory) EraseBlocks(start, length int64) error {
+	from, to := start*m.eraseBlock, (start+length)*m.eraseBlock
+	if start < 0 || length < 0 || to > int64(len(m.data)) {
+		return errOutOfRange
+	}
+	for i := from; i < to; i++ {
+		m.data[i] = 0xFF
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package storage keeps small records in flash.
+//
+// A record takes one erase block of a BlockDevice, the layout is:
+//
+//	offset size field
+//	0      2    magic, little endian, identifies the record
+//	2      1    length of data
+//	3      n    data
+//	3+n    4    CRC-32 (IEEE) of bytes 0 to 3+n
+//
+// An erased block (0xFF) or a block with other magic or bad CRC has no
+// record.
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	ErrNoRecord     = errors.New("storage: no record")
+	ErrTooLarge     = errors.New("storage: record is larger than block")
+	ErrInvalidBlock = errors.New("storage: block is out of device")
+)
+
+// BlockDevice is flash memory, the same as machine.BlockDevice of TinyGo,
+// machine.Flash implements it.
+type BlockDevice interface {
+	ReadAt(p []byte, off int64) (n int, err error)
+	WriteAt(p []byte, off int64) (n int, err error)
+	Size() int64
+	WriteBlockSize() int64
+	EraseBlockSize() int64
+	EraseBlocks(start, len int64) error
+}
+
+const (
+	headerSize = 3
+	crcSize    = 4
+
+	// MaxData is the maximum length of record data.
+	MaxData = 255
+)
+
+// Load reads the record with magic from erase block number block into data.
+// The stored length must be equal to len(data).
+func Load(dev BlockDevice, block int64, magic uint16, data []byte) error {
+	off, err := offset(dev, block, len(data))
+	if err != nil {
+		return err
+	}
+
+	var buf [headerSize + MaxData + crcSize]byte
+	record := buf[:headerSize+len(data)+crcSize]
+	_, err = dev.ReadAt(record, off)
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint16(record) != magic || int(record[2]) != len(data) {
+		return ErrNoRecord
+	}
+	n := headerSize + len(data)
+	if binary.LittleEndian.Uint32(record[n:]) != crc32.ChecksumIEEE(record[:n]) {
+		return ErrNoRecord
+	}
+	copy(data, record[headerSize:n])
+	return nil
+}
+
+// Save erases block and writes the record with magic and data into it.
+func Save(dev BlockDevice, block int64, magic uint16, data []byte) error {
+	off, err := offset(dev, block, len(data))
+	if err != nil {
+		return err
+	}
+
+	// Writes must be in whole write blocks, the rest stays erased.
+	var buf [headerSize + MaxData + crcSize + 256]byte
+	n := headerSize + len(data) + crcSize
+	size := (int64(n) + dev.WriteBlockSize() - 1) / dev.WriteBlockSize() * dev.WriteBlockSize()
+	if size > int64(len(buf)) {
+		return ErrTooLarge
+	}
+	record := buf[:size]
+	for i := range record {
+		record[i] = 0xFF
+	}
+	binary.LittleEndian.PutUint16(record, magic)
+	record[2] = byte(len(data))
+	copy(record[headerSize:], data)
+	n -= crcSize
+	binary.LittleEndian.PutUint32(record[n:], crc32.ChecksumIEEE(record[:n]))
+
+	err = dev.EraseBlocks(block, 1)
+	if err != nil {
+		return err
+	}
+	_, err = dev.WriteAt(record, off)
+	return err
+}
+
+// Erase removes the record from erase block number block.
+func Erase(dev BlockDevice, block int64) error {
+	_, err := offset(dev, block, 0)
+	if err != nil {
+		return err
+	}
+	return dev.EraseBlocks(block, 1)
+}
+
+// offset returns the address of block and checks the record fits in it.
+func offset(dev BlockDevice, block int64, length int) (int64, error) {
+	if length > MaxData || int64(headerSize+length+crcSize) > dev.EraseBlockSize() {
+		return 0, ErrTooLarge
+	}
+	off := block * dev.EraseBlockSize()
+	if block < 0 || off+dev.EraseBlockSize() > dev.Size() {
+		return 0, ErrInvalidBlock
+	}
+	return off, nil
+}